@@ -0,0 +1,11 @@
+package admin
+
+import (
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Admin struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	*user.User `bson:"user,omitempty"`
+}
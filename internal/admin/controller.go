@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AdminController struct {
+	adminService IAdminService
+}
+
+func NewAdminController(adminService IAdminService) *AdminController {
+	return &AdminController{adminService: adminService}
+}
+
+func (ac *AdminController) Profile(c *gin.Context) {
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	admin, err := ac.adminService.GetAdmin(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(admin, "admin retrieved successfully"))
+}
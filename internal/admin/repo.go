@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AdminRepo struct {
+	db    db.IDatabase
+	users db.IDatabase
+}
+
+// NewAdminRepo stores the admin profiles in db and their identities in users.
+func NewAdminRepo(db db.IDatabase, users db.IDatabase) *AdminRepo {
+	return &AdminRepo{db: db, users: users}
+}
+
+// CreateAdmin stores the user and the admin profile linked to it. It returns
+// user.ErrEmailTaken if the email already belongs to an account.
+func (ar *AdminRepo) CreateAdmin(admin *Admin) error {
+	if admin.Id.IsZero() {
+		admin.Id = primitive.NewObjectID()
+	}
+	admin.User.Id = admin.Id
+	profile := *admin
+	profile.User = nil
+	return user.CreateWithProfile(ar.users, ar.db, admin.User, &profile)
+}
+
+func (ar *AdminRepo) AdminExists(filter interface{}) (bool, error) {
+	_, err := ar.GetAdmin(filter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (ar *AdminRepo) UpdateAdmin(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := ar.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ar *AdminRepo) GetAdmin(filter interface{}) (*Admin, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	admins := []*Admin{}
+	cursor, err := ar.db.Aggregate(ctx, user.JoinPipeline(filter, options.Find().SetLimit(1)))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &admins); err != nil {
+		return nil, err
+	}
+	if len(admins) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return admins[0], nil
+}
+
+type IAdminRepo interface {
+	CreateAdmin(admin *Admin) error
+	AdminExists(filter interface{}) (bool, error)
+	UpdateAdmin(filter interface{}, update interface{}) error
+	GetAdmin(filter interface{}) (*Admin, error)
+}
+
+type IMiddlewareAdminRepo interface {
+	GetAdmin(filter interface{}) (*Admin, error)
+}
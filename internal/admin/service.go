@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AdminService struct {
+	adminRepo      IAdminRepo
+	passwordPolicy utils.IPasswordPolicy
+}
+
+func NewAdminService(adminRepo IAdminRepo, passwordPolicy utils.IPasswordPolicy) *AdminService {
+	return &AdminService{adminRepo: adminRepo, passwordPolicy: passwordPolicy}
+}
+
+// BootstrapAdmin creates a verified admin account. It does nothing if an admin
+// with the same email already exists, so it is safe to run on every start.
+func (as *AdminService) BootstrapAdmin(email, password, firstname, lastname string) (bool, error) {
+	if email == "" || password == "" {
+		return false, errors.New("admin email and password are required")
+	}
+	email = user.NormalizeEmail(email)
+	exists, err := as.adminRepo.AdminExists(bson.M{"user.email": email})
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	if err := as.passwordPolicy.Check(password, email, firstname, lastname); err != nil {
+		return false, err
+	}
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	if passwordHash == "" {
+		return false, errors.New("password hash is empty")
+	}
+	admin := &Admin{
+		Id: primitive.NewObjectID(),
+		User: &user.User{
+			Email:      email,
+			Password:   passwordHash,
+			Firstname:  firstname,
+			Lastname:   lastname,
+			IsVerified: true,
+			Role:       user.Admin,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		},
+	}
+	if err := as.adminRepo.CreateAdmin(admin); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (as *AdminService) GetAdmin(id primitive.ObjectID) (*Admin, error) {
+	return as.adminRepo.GetAdmin(bson.M{"_id": id})
+}
+
+type IAdminService interface {
+	GetAdmin(id primitive.ObjectID) (*Admin, error)
+}
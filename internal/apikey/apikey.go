@@ -0,0 +1,37 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/rbac"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KeyPrefix starts every API key, so the middleware can tell them apart from
+// access tokens and leaked keys are easy to search for.
+const KeyPrefix = "edu_"
+
+// ApiKey lets scripts and other services call the API as a user without
+// logging in. The key itself is only shown when it is created; Hash is its
+// secret part hashed like a password. Scopes limit the key to some of the
+// permissions of the user.
+type ApiKey struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name       string             `json:"name" bson:"name"`
+	Hash       string             `json:"-" bson:"hash"`
+	Scopes     []rbac.Permission  `json:"scopes" bson:"scopes"`
+	CreatedBy  primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	LastUsedAt *time.Time         `json:"last_used_at" bson:"last_used_at,omitempty"`
+	LastUsedIp string             `json:"last_used_ip,omitempty" bson:"last_used_ip,omitempty"`
+}
+
+// ApiKeyAuth is who a request authenticated with an API key acts as.
+type ApiKeyAuth struct {
+	KeyId       primitive.ObjectID
+	UserId      primitive.ObjectID
+	Roles       []string
+	Permissions []string
+}
@@ -0,0 +1,119 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ayo-ajayi/edutech/internal/rbac"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultValidityDays = 90
+
+type ApiKeyController struct {
+	apiKeyService IApiKeyService
+}
+
+func NewApiKeyController(apiKeyService IApiKeyService) *ApiKeyController {
+	return &ApiKeyController{apiKeyService: apiKeyService}
+}
+
+func (akc *ApiKeyController) GetApiKeys(c *gin.Context) {
+	akc.getApiKeys(c, c.MustGet("user_id").(primitive.ObjectID))
+}
+
+func (akc *ApiKeyController) CreateApiKey(c *gin.Context) {
+	akc.createApiKey(c, c.MustGet("user_id").(primitive.ObjectID))
+}
+
+func (akc *ApiKeyController) RevokeApiKey(c *gin.Context) {
+	akc.revokeApiKey(c, c.MustGet("user_id").(primitive.ObjectID))
+}
+
+// GetUserApiKeys and the other user handlers let admins manage the keys of
+// another account, such as one set up for an integration.
+func (akc *ApiKeyController) GetUserApiKeys(c *gin.Context) {
+	if userId, ok := userIdParam(c); ok {
+		akc.getApiKeys(c, userId)
+	}
+}
+
+func (akc *ApiKeyController) CreateUserApiKey(c *gin.Context) {
+	if userId, ok := userIdParam(c); ok {
+		akc.createApiKey(c, userId)
+	}
+}
+
+func (akc *ApiKeyController) RevokeUserApiKey(c *gin.Context) {
+	if userId, ok := userIdParam(c); ok {
+		akc.revokeApiKey(c, userId)
+	}
+}
+
+func userIdParam(c *gin.Context) (primitive.ObjectID, bool) {
+	userId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return primitive.NilObjectID, false
+	}
+	return userId, true
+}
+
+func (akc *ApiKeyController) getApiKeys(c *gin.Context, userId primitive.ObjectID) {
+	apiKeys, err := akc.apiKeyService.GetApiKeys(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(apiKeys, "api keys retrieved successfully"))
+}
+
+func (akc *ApiKeyController) createApiKey(c *gin.Context, userId primitive.ObjectID) {
+	req := struct {
+		Name          string            `json:"name" binding:"required"`
+		Scopes        []rbac.Permission `json:"scopes" binding:"required"`
+		ExpiresInDays int               `json:"expires_in_days"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultValidityDays
+	}
+	apiKey, key, err := akc.apiKeyService.CreateApiKey(userId, c.MustGet("user_id").(primitive.ObjectID), req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, ErrTooManyApiKeys):
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	}, "api key created, copy it now as it will not be shown again"))
+}
+
+func (akc *ApiKeyController) revokeApiKey(c *gin.Context, userId primitive.ObjectID) {
+	keyId, err := primitive.ObjectIDFromHex(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid key id"}})
+		return
+	}
+	if err := akc.apiKeyService.RevokeApiKey(userId, keyId); err != nil {
+		if errors.Is(err, ErrApiKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "api key revoked successfully"))
+}
@@ -0,0 +1,96 @@
+package apikey
+
+import (
+	"errors"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ApiKeyRepo struct {
+	db db.IDatabase
+}
+
+func NewApiKeyRepo(db db.IDatabase) *ApiKeyRepo {
+	return &ApiKeyRepo{db: db}
+}
+
+// InitApiKeyExpiryIndex lets the database delete keys once they expire.
+func InitApiKeyExpiryIndex(database db.IDatabase) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := database.CreateIndex(ctx, indexModel)
+	if err != nil {
+		return errors.New("Error creating TTL index for api keys collection:" + err.Error())
+	}
+	return nil
+}
+
+func (akr *ApiKeyRepo) CreateApiKey(apiKey *ApiKey) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := akr.db.InsertOne(ctx, apiKey)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (akr *ApiKeyRepo) GetApiKey(filter interface{}) (*ApiKey, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var apiKey ApiKey
+	err := akr.db.FindOne(ctx, filter).Decode(&apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (akr *ApiKeyRepo) GetApiKeys(filter interface{}, opts ...*options.FindOptions) ([]*ApiKey, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	apiKeys := []*ApiKey{}
+	cursor, err := akr.db.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &apiKeys)
+	if err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func (akr *ApiKeyRepo) UpdateApiKey(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := akr.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (akr *ApiKeyRepo) DeleteApiKeys(filter interface{}) (int64, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	res, err := akr.db.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+type IApiKeyRepo interface {
+	CreateApiKey(apiKey *ApiKey) error
+	GetApiKey(filter interface{}) (*ApiKey, error)
+	GetApiKeys(filter interface{}, opts ...*options.FindOptions) ([]*ApiKey, error)
+	UpdateApiKey(filter interface{}, update interface{}) error
+	DeleteApiKeys(filter interface{}) (int64, error)
+}
@@ -0,0 +1,238 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/rbac"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxKeysPerUser   = 25
+	maxValidityDays  = 365
+	lastUsedInterval = time.Minute
+)
+
+var (
+	ErrApiKeyNotFound = errors.New("api key not found")
+	ErrInvalidApiKey  = errors.New("invalid or expired api key")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrTooManyApiKeys = errors.New("too many api keys, revoke one first")
+)
+
+// verifiedKey remembers a key that passed the bcrypt check, so requests with
+// it do not pay for the hash again.
+type verifiedKey struct {
+	hash string
+	sum  [32]byte
+}
+
+type ApiKeyService struct {
+	apiKeyRepo  IApiKeyRepo
+	userRepo    user.IUserRepo
+	roleService rbac.IAuthRoleService
+	verified    sync.Map
+}
+
+func NewApiKeyService(apiKeyRepo IApiKeyRepo, userRepo user.IUserRepo, roleService rbac.IAuthRoleService) *ApiKeyService {
+	return &ApiKeyService{apiKeyRepo: apiKeyRepo, userRepo: userRepo, roleService: roleService}
+}
+
+// CreateApiKey creates a key for userId that expires after validityDays. The
+// scopes must be permissions the user has. createdBy is the user themself or
+// the admin who set the key up for a service account. The returned key is not
+// stored and cannot be shown again.
+func (aks *ApiKeyService) CreateApiKey(userId, createdBy primitive.ObjectID, name string, scopes []rbac.Permission, validityDays int) (*ApiKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, "", errors.New("name must be between 1 and 64 characters")
+	}
+	if validityDays < 1 || validityDays > maxValidityDays {
+		return nil, "", errors.New("api keys must expire within 1 to 365 days")
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("an api key needs at least one scope")
+	}
+	u, err := aks.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, "", ErrUserNotFound
+		}
+		return nil, "", err
+	}
+	if u.Suspended {
+		return nil, "", errors.New("api keys cannot be created for a suspended account")
+	}
+	granted, err := aks.roleService.Permissions(u.GetRoles())
+	if err != nil {
+		return nil, "", err
+	}
+	if createdBy != userId {
+		// an admin cannot hand out permissions they do not have themselves
+		creator, err := aks.userRepo.GetUser(bson.M{"_id": createdBy})
+		if err != nil {
+			return nil, "", err
+		}
+		creatorGranted, err := aks.roleService.Permissions(creator.GetRoles())
+		if err != nil {
+			return nil, "", err
+		}
+		for _, scope := range scopes {
+			if !hasPermission(creatorGranted, scope) {
+				return nil, "", errors.New("you do not have permission " + string(scope))
+			}
+		}
+	}
+	unique := []rbac.Permission{}
+	for _, scope := range scopes {
+		if !hasPermission(granted, scope) {
+			return nil, "", errors.New("the account does not have permission " + string(scope))
+		}
+		if !hasPermission(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	existing, err := aks.apiKeyRepo.GetApiKeys(bson.M{"user_id": userId})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(existing) >= maxKeysPerUser {
+		return nil, "", ErrTooManyApiKeys
+	}
+
+	secret, err := utils.CreateSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+	hash, err := utils.HashPassword(secret)
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey := &ApiKey{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		Name:      name,
+		Hash:      hash,
+		Scopes:    unique,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().AddDate(0, 0, validityDays),
+	}
+	if err := aks.apiKeyRepo.CreateApiKey(apiKey); err != nil {
+		return nil, "", err
+	}
+	return apiKey, KeyPrefix + apiKey.Id.Hex() + "_" + secret, nil
+}
+
+// GetApiKeys lists the unexpired keys of a user, newest first.
+func (aks *ApiKeyService) GetApiKeys(userId primitive.ObjectID) ([]*ApiKey, error) {
+	return aks.apiKeyRepo.GetApiKeys(bson.M{"user_id": userId, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{primitive.E{Key: "created_at", Value: -1}}))
+}
+
+// RevokeApiKey deletes a key of userId. It stops working right away.
+func (aks *ApiKeyService) RevokeApiKey(userId, keyId primitive.ObjectID) error {
+	deleted, err := aks.apiKeyRepo.DeleteApiKeys(bson.M{"_id": keyId, "user_id": userId})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrApiKeyNotFound
+	}
+	aks.verified.Delete(keyId)
+	return nil
+}
+
+// Authenticate checks an API key presented by ip. The key acts with the
+// permissions in its scopes that the user still has, so taking a role away or
+// suspending the user restricts their keys too.
+func (aks *ApiKeyService) Authenticate(key, ip string) (*ApiKeyAuth, error) {
+	idHex, secret, ok := strings.Cut(strings.TrimPrefix(key, KeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, KeyPrefix) {
+		return nil, ErrInvalidApiKey
+	}
+	keyId, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return nil, ErrInvalidApiKey
+	}
+	apiKey, err := aks.apiKeyRepo.GetApiKey(bson.M{"_id": keyId, "expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidApiKey
+		}
+		return nil, err
+	}
+	if !aks.checkSecret(apiKey, secret) {
+		return nil, ErrInvalidApiKey
+	}
+	u, err := aks.userRepo.GetUser(bson.M{"_id": apiKey.UserId})
+	if err != nil || u.Suspended {
+		return nil, ErrInvalidApiKey
+	}
+	granted, err := aks.roleService.Permissions(u.GetRoles())
+	if err != nil {
+		return nil, err
+	}
+	auth := &ApiKeyAuth{KeyId: apiKey.Id, UserId: u.Id, Roles: []string{}, Permissions: []string{}}
+	for _, role := range u.GetRoles() {
+		auth.Roles = append(auth.Roles, string(role))
+	}
+	for _, scope := range apiKey.Scopes {
+		if hasPermission(granted, scope) {
+			auth.Permissions = append(auth.Permissions, string(scope))
+		}
+	}
+	// recording every request would write on each call, once a minute is
+	// precise enough to spot unused keys
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > lastUsedInterval {
+		if err := aks.apiKeyRepo.UpdateApiKey(bson.M{"_id": apiKey.Id}, bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": ip}}); err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
+}
+
+func (aks *ApiKeyService) checkSecret(apiKey *ApiKey, secret string) bool {
+	sum := sha256.Sum256([]byte(secret))
+	if v, ok := aks.verified.Load(apiKey.Id); ok {
+		verified := v.(verifiedKey)
+		if verified.hash == apiKey.Hash && subtle.ConstantTimeCompare(verified.sum[:], sum[:]) == 1 {
+			return true
+		}
+	}
+	if !utils.CheckPasswordHash(secret, apiKey.Hash) {
+		return false
+	}
+	aks.verified.Store(apiKey.Id, verifiedKey{hash: apiKey.Hash, sum: sum})
+	return true
+}
+
+func hasPermission(permissions []rbac.Permission, p rbac.Permission) bool {
+	for _, have := range permissions {
+		if have == p {
+			return true
+		}
+	}
+	return false
+}
+
+type IApiKeyService interface {
+	CreateApiKey(userId, createdBy primitive.ObjectID, name string, scopes []rbac.Permission, validityDays int) (*ApiKey, string, error)
+	GetApiKeys(userId primitive.ObjectID) ([]*ApiKey, error)
+	RevokeApiKey(userId, keyId primitive.ObjectID) error
+}
+
+type IMiddlewareApiKeyService interface {
+	Authenticate(key, ip string) (*ApiKeyAuth, error)
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"log"
+	"os"
+
+	"github.com/ayo-ajayi/edutech/internal/admin"
+	"github.com/ayo-ajayi/edutech/internal/user"
+)
+
+// BootstrapAdmin creates the first admin account in the configured database.
+func BootstrapAdmin(email, password, firstname, lastname string) error {
+	policy := loadPasswordPolicy()
+	collection := databaseBackend(os.Getenv("DB_BACKEND"), os.Getenv("MONGODB_URI"), os.Getenv("MONGODB_NAME"))
+	users := collection(user.Collection)
+	if err := user.InitUserEmailIndex(users); err != nil {
+		return err
+	}
+	adminService := admin.NewAdminService(admin.NewAdminRepo(collection("admins"), users), policy)
+	created, err := adminService.BootstrapAdmin(email, password, firstname, lastname)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Println("admin account created for", email)
+	} else {
+		log.Println("admin account already exists for", email)
+	}
+	return nil
+}
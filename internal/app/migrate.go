@@ -0,0 +1,82 @@
+package app
+
+import (
+	"log"
+	"os"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateUsers moves the user embedded in the student, tutor and admin
+// documents of older versions into the users collection, under the id of the
+// profile so existing sessions, bookings and reviews keep pointing at the right
+// account. It can be run again after a failure.
+//
+// An email can only belong to one user. When it was registered more than once,
+// the first account found keeps it, in the order admins, tutors, students; the
+// others are reported and left as they are to be resolved by hand.
+func MigrateUsers() error {
+	collection := databaseBackend(os.Getenv("DB_BACKEND"), os.Getenv("MONGODB_URI"), os.Getenv("MONGODB_NAME"))
+	users := collection(user.Collection)
+	if err := user.InitUserEmailIndex(users); err != nil {
+		return err
+	}
+	for _, profiles := range []struct {
+		name string
+		role user.Role
+	}{{"admins", user.Admin}, {"tutors", user.Tutor}, {"students", user.Student}} {
+		migrated, skipped, err := migrateProfiles(collection(profiles.name), users, profiles.role)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d users migrated, %d skipped\n", profiles.name, migrated, skipped)
+	}
+	return nil
+}
+
+func migrateProfiles(profiles, users db.IDatabase, role user.Role) (int, int, error) {
+	ctx, cancel := db.DBReqContext(60)
+	defer cancel()
+	cursor, err := profiles.Find(ctx, bson.M{"user": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, 0, err
+	}
+	docs := []struct {
+		Id   primitive.ObjectID `bson:"_id"`
+		User *user.User         `bson:"user"`
+	}{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, 0, err
+	}
+	migrated, skipped := 0, 0
+	for _, doc := range docs {
+		if doc.User == nil {
+			continue
+		}
+		u := doc.User
+		u.Id = doc.Id
+		u.Email = user.NormalizeEmail(u.Email)
+		u.Role = role
+		u.Roles = []user.Role{role}
+		if _, err := users.InsertOne(ctx, u); err != nil {
+			if !mongo.IsDuplicateKeyError(err) {
+				return migrated, skipped, err
+			}
+			// a duplicate _id means an earlier run stopped before the $unset
+			if users.FindOne(ctx, bson.M{"_id": doc.Id, "email": u.Email}).Err() != nil {
+				log.Printf("%s %s: email %s already belongs to another account, skipped\n", role, doc.Id.Hex(), u.Email)
+				skipped++
+				continue
+			}
+		}
+		if _, err := profiles.UpdateOne(ctx, bson.M{"_id": doc.Id}, bson.M{"$unset": bson.M{"user": ""}}); err != nil {
+			return migrated, skipped, err
+		}
+		migrated++
+	}
+	return migrated, skipped, nil
+}
@@ -1,11 +1,22 @@
 package app
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ayo-ajayi/edutech/internal/admin"
+	"github.com/ayo-ajayi/edutech/internal/apikey"
 	"github.com/ayo-ajayi/edutech/internal/auth"
+	"github.com/ayo-ajayi/edutech/internal/booking"
+	"github.com/ayo-ajayi/edutech/internal/common"
 	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/outbox"
+	"github.com/ayo-ajayi/edutech/internal/rbac"
+	"github.com/ayo-ajayi/edutech/internal/review"
 	"github.com/ayo-ajayi/edutech/internal/student"
 	"github.com/ayo-ajayi/edutech/internal/subject"
 	"github.com/ayo-ajayi/edutech/internal/tutor"
@@ -21,54 +32,186 @@ func Router() *gin.Engine {
 	emailSenderName := os.Getenv("EMAIL_SENDER_NAME")
 	emailSenderAddress := os.Getenv("EMAIL_SENDER_ADDRESS")
 	verifyEmailBaseUrl := os.Getenv("BASE_URL") + "/api/v1"
-	accessTokenSecret := os.Getenv("ACCESS_TOKEN_SECRET")
-	client, err := db.MongoClient(mongoDbUri)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	ctx, cancel := db.DBReqContext(10)
-	defer cancel()
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalln(err.Error())
+	collection := databaseBackend(os.Getenv("DB_BACKEND"), mongoDbUri, mongoDbName)
+
+	verificationTokenDatabase := collection("verification_tokens")
+	if err := utils.InitVerificationTokenExpiryIndex(verificationTokenDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
 	}
-	log.Println("mongodb connected")
+	verificationTokenManager := utils.NewVerificationTokenManager(verificationTokenDatabase, map[utils.TokenPurpose]uint{
+		utils.PurposeSignup:             60 * 60 * 24 * 7,
+		utils.PurposePasswordReset:      60 * 60,
+		utils.PurposePasswordResetGrant: 60 * 15,
+		utils.PurposeLoginChallenge:     60 * 5,
+		utils.PurposeAccountUnlock:      60 * 60 * 24,
+		utils.PurposeMagicLink:          60 * 15,
+		utils.PurposeEmailChange:        60 * 60 * 24,
+		utils.PurposeInvite:             60 * 60 * 24 * 7,
+	})
 
-	verificationTokenCollection := db.NewMongoCollection(client, mongoDbName, "verification_tokens")
-	verificationTokenDatabase := db.NewDatabase(verificationTokenCollection)
-	verificationTokenManager := utils.NewVerificationTokenManager(verificationTokenDatabase, 60*60*24*7, 60*60*24*7)
+	passwordPolicy := loadPasswordPolicy()
 
-	accessTokenCollection := db.NewMongoCollection(client, mongoDbName, "access_tokens")
-	accessTokenDatabase := db.NewDatabase(accessTokenCollection)
-	accessTokenManager := utils.NewTokenAccessManager(accessTokenSecret, 60*60*24*7, accessTokenDatabase)
+	accessTokenDatabase := collection("access_tokens")
+	allowEphemeralKey, _ := strconv.ParseBool(os.Getenv("ALLOW_EPHEMERAL_SIGNING_KEY"))
+	keyring := signingKeyring(os.Getenv("ACCESS_TOKEN_KEYS_DIR"), os.Getenv("ACCESS_TOKEN_SIGNING_KEY_ID"), allowEphemeralKey || os.Getenv("DB_BACKEND") == "memory")
+	accessTokenManager := utils.NewTokenAccessManager(keyring, os.Getenv("BASE_URL"), verifyEmailBaseUrl, 60*15, 60*60*24*7, accessTokenDatabase)
 
-	emailManager := utils.NewEmailManager(emailSenderAddress, emailSenderName, emailApiKey)
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	mailer, err := utils.NewMailer(os.Getenv("EMAIL_TRANSPORT"), utils.MailerConfig{
+		SendGridApiKey: emailApiKey,
+		SMTPHost:       os.Getenv("SMTP_HOST"),
+		SMTPPort:       smtpPort,
+		SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+		OutboxDir:      os.Getenv("EMAIL_OUTBOX_DIR"),
+	})
+	if err != nil {
+		log.Fatalln("error: email transport init error: ", err.Error())
+	}
+	outboxService := outbox.NewOutboxService(outbox.NewOutboxRepo(collection("email_outbox")), mailer, outbox.OutboxConfig{
+		PollInterval: 5 * time.Second,
+		BatchSize:    20,
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   time.Hour,
+		LockTimeout:  2 * time.Minute,
+	})
+	go outboxService.Run(context.Background())
+	outboxController := outbox.NewOutboxController(outboxService)
+	emailManager := utils.NewEmailManager(emailSenderAddress, emailSenderName, outboxService)
+
+	userDatabase := collection(user.Collection)
+	if err := user.InitUserEmailIndex(userDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
+	}
+	userRepo := user.NewUserRepo(userDatabase)
 
-	studentSubjectTutorRepo := subject.NewStudentSubjectTutorRepo(db.NewDatabase(db.NewMongoCollection(client, mongoDbName, "student_subject_tutor")))
-	subjectRepo := subject.NewSubjectRepo(db.NewDatabase(db.NewMongoCollection(client, mongoDbName, "subjects")))
+	roleService, err := rbac.NewRoleService(rbac.NewRoleRepo(collection("roles")), userRepo, accessTokenManager)
+	if err != nil {
+		log.Fatalln("error: role service init error: ", err.Error())
+	}
+	roleController := rbac.NewRoleController(roleService)
+
+	studentSubjectTutorRepo := subject.NewStudentSubjectTutorRepo(collection("student_subject_tutor"))
+	subjectRepo := subject.NewSubjectRepo(collection("subjects"))
 	subjectService, err := subject.NewSubjectService(subjectRepo, "English")
 	if err != nil {
 		log.Fatalln("error: subject service init error: ", err.Error())
 	}
 	subjectController := subject.NewSubjectController(subjectService)
 
-	tutorRepo := tutor.NewTutorRepo(db.NewDatabase(db.NewMongoCollection(client, mongoDbName, "tutors")))
-	tutorService := tutor.NewTutorService(tutorRepo, verificationTokenManager, accessTokenManager, emailManager, verifyEmailBaseUrl)
+	blobStore, err := utils.NewBlobStore(os.Getenv("BLOB_STORE"), utils.BlobStoreConfig{Dir: os.Getenv("BLOB_STORE_DIR")})
+	if err != nil {
+		log.Fatalln("error: blob store init error: ", err.Error())
+	}
+	avatarManager := utils.NewAvatarManager(blobStore, verifyEmailBaseUrl)
+
+	tutorRepo := tutor.NewTutorRepo(collection("tutors"), userDatabase)
+	tutorService := tutor.NewTutorService(tutorRepo, userRepo, subjectRepo, verificationTokenManager, accessTokenManager, emailManager, passwordPolicy, avatarManager, verifyEmailBaseUrl)
 	tutorController := tutor.NewTutorController(tutorService)
 
-	studentRepo := student.NewStudentRepo(db.NewDatabase(db.NewMongoCollection(client, mongoDbName, "students")))
-	studentService := student.NewStudentService(studentRepo, verificationTokenManager, accessTokenManager, emailManager, subjectRepo, tutorRepo, studentSubjectTutorRepo, verifyEmailBaseUrl)
+	studentRepo := student.NewStudentRepo(collection("students"), userDatabase)
+	studentService := student.NewStudentService(studentRepo, userRepo, verificationTokenManager, accessTokenManager, emailManager, subjectRepo, tutorRepo, studentSubjectTutorRepo, passwordPolicy, avatarManager, verifyEmailBaseUrl)
 	studentController := student.NewStudentController(studentService)
 
-	authService := auth.NewAuthService(tutorRepo, studentRepo, subjectRepo, accessTokenManager, verificationTokenManager, emailManager, verifyEmailBaseUrl)
-	authController := auth.NewAuthController(authService)
+	reviewDatabase := collection("reviews")
+	if err := review.InitReviewIndex(reviewDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
+	}
+	reviewRepo := review.NewReviewRepo(reviewDatabase)
+	reviewService := review.NewReviewService(reviewRepo, tutorRepo, studentSubjectTutorRepo)
+	reviewController := review.NewReviewController(reviewService)
+
+	lockDatabase := collection("locks")
+	if err := utils.InitLockExpiryIndex(lockDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
+	}
+	locker := utils.NewLocker(lockDatabase, 30*time.Second, 5*time.Second)
 
-	middleware := auth.NewAuthMiddleWare(accessTokenSecret, tutorRepo, studentRepo, accessTokenManager)
+	bookingRepo := booking.NewBookingRepo(collection("bookings"))
+	availabilityRepo := booking.NewAvailabilityRepo(collection("availabilities"))
+	bookingService := booking.NewBookingService(
+		bookingRepo,
+		availabilityRepo,
+		studentRepo, tutorRepo, subjectRepo, studentSubjectTutorRepo, emailManager, locker,
+		booking.BookingPolicy{
+			MinNotice:          time.Hour,
+			MaxAdvance:         90 * 24 * time.Hour,
+			MinDuration:        30 * time.Minute,
+			MaxDuration:        3 * time.Hour,
+			CancellationCutoff: 24 * time.Hour,
+			RescheduleCutoff:   24 * time.Hour,
+		})
+	bookingController := booking.NewBookingController(bookingService)
+	calendarService := booking.NewCalendarService(booking.NewCalendarFeedRepo(collection("calendar_feeds")), bookingRepo, availabilityRepo, studentRepo, tutorRepo, subjectRepo, verifyEmailBaseUrl)
+	calendarController := booking.NewCalendarController(calendarService)
+
+	adminRepo := admin.NewAdminRepo(collection("admins"), userDatabase)
+	adminService := admin.NewAdminService(adminRepo, passwordPolicy)
+	adminController := admin.NewAdminController(adminService)
+	if adminEmail, adminPassword := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD"); adminEmail != "" && adminPassword != "" {
+		created, err := adminService.BootstrapAdmin(adminEmail, adminPassword, "Admin", "")
+		if err != nil {
+			log.Fatalln("error: admin bootstrap error: ", err.Error())
+		}
+		if created {
+			log.Println("admin account created for", adminEmail)
+		}
+	}
+
+	userService := common.NewUserService(tutorRepo, studentRepo, avatarManager)
+	userController := common.NewUserController(userService)
+
+	rateLimiter := utils.NewRateLimiter(collection("rate_limits"))
+	loginAttemptsDatabase := collection("login_attempts")
+	if err := utils.InitLoginAttemptsExpiryIndex(loginAttemptsDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
+	}
+	loginThrottle := utils.NewLoginThrottle(loginAttemptsDatabase,
+		utils.LockoutPolicy{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			LockoutAfter: 10,
+			LockoutFor:   30 * time.Minute,
+			ResetAfter:   time.Hour,
+		},
+		utils.LockoutPolicy{
+			FreeAttempts: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			LockoutAfter: 100,
+			LockoutFor:   time.Hour,
+			ResetAfter:   time.Hour,
+		})
+	authService := auth.NewAuthService(userRepo, tutorRepo, studentRepo, adminRepo, subjectRepo, roleService, accessTokenManager, verificationTokenManager, emailManager, rateLimiter, loginThrottle, passwordPolicy, verifyEmailBaseUrl)
+	authController := auth.NewAuthController(authService, os.Getenv("RESET_PASSWORD_FORM_URL"))
+
+	oidcLoginDatabase := collection("oidc_logins")
+	if err := auth.InitOIDCLoginExpiryIndex(oidcLoginDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
+	}
+	oidcService := auth.NewOIDCService(authService, auth.NewOIDCLoginRepo(oidcLoginDatabase), oidcProviders(os.Getenv("OIDC_PROVIDERS"), verifyEmailBaseUrl)...)
+	oidcController := auth.NewOIDCController(oidcService, strings.HasPrefix(verifyEmailBaseUrl, "https://"))
+
+	apiKeyDatabase := collection("api_keys")
+	if err := apikey.InitApiKeyExpiryIndex(apiKeyDatabase); err != nil {
+		log.Fatalln("error: ", err.Error())
+	}
+	apiKeyService := apikey.NewApiKeyService(apikey.NewApiKeyRepo(apiKeyDatabase), userRepo, roleService)
+	apiKeyController := apikey.NewApiKeyController(apiKeyService)
+
+	middleware := auth.NewAuthMiddleWare(accessTokenManager, apiKeyService)
 
 	r := gin.Default()
 	r.Use(jsonMiddleware(), auth.NewCors())
 	r.GET("/favicon.ico", func(ctx *gin.Context) { ctx.File("./favicon.ico") })
 	r.NoRoute(func(ctx *gin.Context) { ctx.JSON(404, gin.H{"error": "endpoint not found"}) })
 	r.GET("/healthz", func(ctx *gin.Context) { ctx.JSON(200, gin.H{"message": "ok"}) })
+	r.GET("/.well-known/jwks.json", func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(200, accessTokenManager.JWKS())
+	})
 	r.GET("/", func(ctx *gin.Context) { ctx.JSON(200, gin.H{"message": "welcome to edutech"}) })
 
 	api := r.Group("/api/v1")
@@ -76,28 +219,248 @@ func Router() *gin.Engine {
 	api.POST("/login", authController.Login)
 	api.POST("/forgot-password", authController.ForgotPassword)
 	api.POST("/reset-password", authController.ResetPassword)
+	api.GET("/verify-reset-token/:token", authController.VerifyResetToken)
 	api.GET("/verify/:token", authController.Verify)
-	api.DELETE("/logout", authController.Logout)
+	api.POST("/verify/resend", authController.ResendVerification)
+	api.DELETE("/logout", middleware.Authentication(), middleware.RequireSession(), authController.Logout)
+	api.POST("/token/refresh", authController.RefreshToken)
+
+	api.POST("/login/2fa", authController.CompleteLogin)
+	api.GET("/unlock/:token", authController.UnlockAccount)
+	api.POST("/login/magic", authController.RequestMagicLink)
+	api.GET("/login/magic/:token", authController.MagicLinkLogin)
+	api.POST("/login/2fa/enroll", authController.EnrollTwoFactorAtLogin)
+	api.GET("/email-change/:token", authController.ConfirmEmailChange)
+
+	api.GET("/oidc/providers", oidcController.GetProviders)
+	api.GET("/oidc/:provider/login", oidcController.Login)
+	api.GET("/oidc/:provider/callback", oidcController.Callback)
+
+	twoFactorRouter := api.Group("/2fa")
+	twoFactorRouter.Use(middleware.Authentication(), middleware.RequireSession())
+	twoFactorRouter.POST("/enroll", authController.EnrollTwoFactor)
+	twoFactorRouter.POST("/confirm", authController.ConfirmTwoFactor)
+	twoFactorRouter.POST("/recovery-codes", authController.RegenerateRecoveryCodes)
+	twoFactorRouter.DELETE("", authController.DisableTwoFactor)
+
+	meRouter := api.Group("/me")
+	meRouter.Use(middleware.Authentication(), middleware.RequireSession())
+	meRouter.PUT("/password", authController.ChangePassword)
+	meRouter.POST("/email", authController.RequestEmailChange)
+
+	sessionRouter := api.Group("/sessions")
+	sessionRouter.Use(middleware.Authentication(), middleware.RequireSession())
+	sessionRouter.GET("", authController.Sessions)
+	sessionRouter.DELETE("", authController.RevokeAllSessions)
+	sessionRouter.DELETE("/:id", authController.RevokeSession)
+
+	apiKeyRouter := api.Group("/api-keys")
+	apiKeyRouter.Use(middleware.Authentication(), middleware.RequireSession())
+	apiKeyRouter.GET("", apiKeyController.GetApiKeys)
+	apiKeyRouter.POST("", apiKeyController.CreateApiKey)
+	apiKeyRouter.DELETE("/:key_id", apiKeyController.RevokeApiKey)
 
 	studentRouter := api.Group("/students")
 	studentRouter.POST("", studentController.SignUp)
-	studentRouter.Use(middleware.Authentication(), middleware.Authorization(user.Student))
+	studentRouter.Use(middleware.Authentication(), middleware.RequirePermissions(rbac.StudentPortal))
 	studentRouter.GET("/profile", studentController.Profile)
+	studentRouter.PATCH("/profile", studentController.UpdateProfile)
+	studentRouter.PUT("/profile/avatar", studentController.UploadAvatar)
+	studentRouter.DELETE("/profile/avatar", studentController.DeleteAvatar)
 	studentRouter.GET("/subjects", studentController.GetRegisteredSubjects)
 	studentRouter.POST("/subjects", studentController.RegisterSubject)
 	studentRouter.POST("/tutors/register", studentController.RegisterTutor)
 	studentRouter.GET("/tutors", studentController.GetRegisteredTutors)
+	studentRouter.POST("/tutors/:id/reviews", reviewController.CreateReview)
+	studentRouter.PUT("/reviews/:id", reviewController.UpdateReview)
+	studentRouter.DELETE("/reviews/:id", reviewController.DeleteReview)
+	studentRouter.POST("/bookings", bookingController.CreateBooking)
+	studentRouter.GET("/bookings", bookingController.GetStudentBookings)
+	studentRouter.PATCH("/bookings/:id/reschedule", bookingController.RescheduleBooking)
+	studentRouter.POST("/bookings/:id/cancel", bookingController.CancelBooking)
+	studentRouter.GET("/bookings/:id/ics", calendarController.GetStudentBookingCalendar)
+	studentRouter.POST("/calendar", calendarController.CreateStudentCalendarFeed)
+	studentRouter.DELETE("/calendar", calendarController.DeleteCalendarFeed)
 
 	tutorRouter := api.Group("/tutors")
 	tutorRouter.POST("", tutorController.SignUp)
-	tutorRouter.Use(middleware.Authentication(), middleware.Authorization(user.Tutor))
+	tutorRouter.GET("", userController.GetTutors)
+	tutorRouter.GET("/:id/reviews", reviewController.GetTutorReviews)
+	tutorRouter.GET("/:id/availability", bookingController.GetOpenSlots)
+	tutorRouter.Use(middleware.Authentication(), middleware.RequirePermissions(rbac.TutorPortal))
 	tutorRouter.GET("/profile", tutorController.Profile)
+	tutorRouter.PATCH("/profile", tutorController.UpdateProfile)
+	tutorRouter.PUT("/profile/avatar", tutorController.UploadAvatar)
+	tutorRouter.DELETE("/profile/avatar", tutorController.DeleteAvatar)
+	tutorRouter.PUT("/application", tutorController.SubmitApplication)
+	tutorRouter.PUT("/reviews/:id/reply", reviewController.ReplyToReview)
+	tutorRouter.PUT("/availability", bookingController.SaveAvailability)
+	tutorRouter.GET("/availability", bookingController.GetMyAvailability)
+	tutorRouter.GET("/bookings", bookingController.GetTutorBookings)
+	tutorRouter.PATCH("/bookings/:id/reschedule", bookingController.RescheduleBooking)
+	tutorRouter.POST("/bookings/:id/cancel", bookingController.CancelBooking)
+	tutorRouter.GET("/bookings/:id/ics", calendarController.GetTutorBookingCalendar)
+	tutorRouter.POST("/calendar", calendarController.CreateTutorCalendarFeed)
+	tutorRouter.DELETE("/calendar", calendarController.DeleteCalendarFeed)
+
+	api.GET("/subjects", subjectController.GetSubjects)
+	api.GET("/calendar/:token", calendarController.GetCalendarFeed)
+	api.GET("/avatars/:key", userController.GetAvatar)
 
-	api.POST("/subjects", subjectController.CreateSubject)
+	adminRouter := api.Group("/admin")
+	adminRouter.Use(middleware.Authentication())
+	adminRouter.GET("/profile", middleware.RequirePermissions(rbac.AdminPortal), adminController.Profile)
+	adminRouter.GET("/students", middleware.RequirePermissions(rbac.StudentsRead), studentController.GetStudents)
+	adminRouter.GET("/students/:id", middleware.RequirePermissions(rbac.StudentsRead), studentController.GetStudent)
+	adminRouter.PATCH("/students/:id/suspension", middleware.RequirePermissions(rbac.StudentsSuspend), studentController.SetStudentSuspended)
+	adminRouter.GET("/tutors", middleware.RequirePermissions(rbac.TutorsRead), tutorController.GetTutors)
+	adminRouter.GET("/tutors/applications", middleware.RequirePermissions(rbac.TutorsRead), tutorController.GetApplications)
+	adminRouter.GET("/tutors/directory", middleware.RequirePermissions(rbac.TutorsRead), userController.GetTutorDirectory)
+	adminRouter.GET("/tutors/:id", middleware.RequirePermissions(rbac.TutorsRead), tutorController.GetTutor)
+	adminRouter.PATCH("/tutors/:id/suspension", middleware.RequirePermissions(rbac.TutorsSuspend), tutorController.SetTutorSuspended)
+	adminRouter.PATCH("/tutors/:id/application", middleware.RequirePermissions(rbac.TutorsApprove), tutorController.ReviewApplication)
+	adminRouter.GET("/reviews", middleware.RequirePermissions(rbac.ReviewsRead), reviewController.GetReviews)
+	adminRouter.PATCH("/reviews/:id/visibility", middleware.RequirePermissions(rbac.ReviewsModerate), reviewController.SetReviewHidden)
+	adminRouter.GET("/emails", middleware.RequirePermissions(rbac.EmailsRead), outboxController.GetMessages)
+	adminRouter.GET("/emails/:id", middleware.RequirePermissions(rbac.EmailsRead), outboxController.GetMessage)
+	adminRouter.POST("/emails/:id/retry", middleware.RequirePermissions(rbac.EmailsRetry), outboxController.RetryMessage)
+	adminRouter.POST("/subjects", middleware.RequirePermissions(rbac.SubjectsCreate), subjectController.CreateSubject)
+	adminRouter.PATCH("/subjects/:id", middleware.RequirePermissions(rbac.SubjectsUpdate), subjectController.UpdateSubject)
+	adminRouter.GET("/locked-accounts", middleware.RequirePermissions(rbac.AccountsRead), authController.GetLockedAccounts)
+	adminRouter.DELETE("/locked-accounts/:email", middleware.RequirePermissions(rbac.AccountsUnlock), authController.ResetLoginAttempts)
+	adminRouter.GET("/roles", middleware.RequirePermissions(rbac.RolesManage), roleController.GetRoles)
+	adminRouter.PUT("/roles/:name", middleware.RequirePermissions(rbac.RolesManage), roleController.SaveRole)
+	adminRouter.PATCH("/roles/:name/two-factor", middleware.RequirePermissions(rbac.RolesManage), roleController.SetTwoFactorRequired)
+	adminRouter.PATCH("/roles/:name/magic-link", middleware.RequirePermissions(rbac.RolesManage), roleController.SetMagicLinkAllowed)
+	adminRouter.PUT("/users/:id/roles", middleware.RequirePermissions(rbac.RolesManage), roleController.SetUserRoles)
+	adminRouter.GET("/users/:id/api-keys", middleware.RequirePermissions(rbac.ApiKeysManage), apiKeyController.GetUserApiKeys)
+	adminRouter.POST("/users/:id/api-keys", middleware.RequireSession(), middleware.RequirePermissions(rbac.ApiKeysManage), apiKeyController.CreateUserApiKey)
+	adminRouter.DELETE("/users/:id/api-keys/:key_id", middleware.RequirePermissions(rbac.ApiKeysManage), apiKeyController.RevokeUserApiKey)
 
 	return r
 }
 
+// signingKeyring loads the keys that sign access and refresh tokens from dir.
+// Without a directory a key is generated on start if allowEphemeral is set,
+// which logs everyone out on every restart and cannot be shared between
+// instances, so it is only fit for development.
+func signingKeyring(dir, signingKeyId string, allowEphemeral bool) *utils.Keyring {
+	if dir == "" {
+		if !allowEphemeral {
+			log.Fatalln("error: ACCESS_TOKEN_KEYS_DIR is not set; set ALLOW_EPHEMERAL_SIGNING_KEY=true to sign tokens with a temporary key in development")
+		}
+		log.Println("warning: ACCESS_TOKEN_KEYS_DIR is not set, signing tokens with a temporary key")
+		keyring, err := utils.NewEphemeralKeyring()
+		if err != nil {
+			log.Fatalln("error: signing key init error: ", err.Error())
+		}
+		return keyring
+	}
+	keyring, err := utils.LoadKeyring(dir, signingKeyId)
+	if err != nil {
+		log.Fatalln("error: signing key init error: ", err.Error())
+	}
+	return keyring
+}
+
+// loadPasswordPolicy reads the policy new passwords have to meet from
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_CHARACTER_CLASSES,
+// PASSWORD_REJECT_PERSONAL_INFO and BREACHED_PASSWORDS_DIR, and sets the bcrypt
+// cost of new password hashes to BCRYPT_COST.
+func loadPasswordPolicy() *utils.PasswordPolicy {
+	policy := &utils.PasswordPolicy{MinLength: 10, MinCharacterClasses: 3, RejectPersonalInfo: true}
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		minLength, err := strconv.Atoi(v)
+		if err != nil || minLength < 1 {
+			log.Fatalln("error: PASSWORD_MIN_LENGTH must be a positive number")
+		}
+		policy.MinLength = minLength
+	}
+	if v := os.Getenv("PASSWORD_MIN_CHARACTER_CLASSES"); v != "" {
+		classes, err := strconv.Atoi(v)
+		if err != nil || classes < 0 || classes > 4 {
+			log.Fatalln("error: PASSWORD_MIN_CHARACTER_CLASSES must be between 0 and 4")
+		}
+		policy.MinCharacterClasses = classes
+	}
+	if v := os.Getenv("PASSWORD_REJECT_PERSONAL_INFO"); v != "" {
+		reject, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalln("error: PASSWORD_REJECT_PERSONAL_INFO must be true or false")
+		}
+		policy.RejectPersonalInfo = reject
+	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		breached, err := utils.NewBreachedPasswords(dir)
+		if err != nil {
+			log.Fatalln("error: breached passwords init error: ", err.Error())
+		}
+		policy.Breached = breached
+	}
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		cost, err := strconv.Atoi(v)
+		if err == nil {
+			err = utils.SetPasswordCost(cost)
+		}
+		if err != nil {
+			log.Fatalln("error: BCRYPT_COST must be a number between 4 and 31")
+		}
+	}
+	return policy
+}
+
+// oidcProviders configures the comma separated OpenID Connect providers in
+// names. Each is read from OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, the
+// optional space separated _SCOPES and _TRUST_EMAIL, and sends users back to
+// <apiUrl>/oidc/<name>/callback, which has to be registered with the provider.
+func oidcProviders(names, apiUrl string) []*auth.OIDCProvider {
+	providers := []*auth.OIDCProvider{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		env := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := auth.OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(env + "ISSUER"),
+			ClientId:     os.Getenv(env + "CLIENT_ID"),
+			ClientSecret: os.Getenv(env + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(env + "SCOPES")),
+		}
+		config.TrustEmail, _ = strconv.ParseBool(os.Getenv(env + "TRUST_EMAIL"))
+		if config.Issuer == "" || config.ClientId == "" {
+			log.Fatalln("error: " + env + "ISSUER and " + env + "CLIENT_ID are required for login provider " + name)
+		}
+		providers = append(providers, auth.NewOIDCProvider(config, apiUrl+"/oidc/"+name+"/callback"))
+	}
+	return providers
+}
+
+// databaseBackend returns a constructor for the collections used by the repos.
+// "memory" keeps everything in process and needs no MongoDB; anything else
+// connects to MONGODB_URI.
+func databaseBackend(backend, mongoDbUri, mongoDbName string) func(name string) db.IDatabase {
+	if backend == "memory" {
+		store := db.NewMemoryStore()
+		log.Println("using in-memory database")
+		return func(name string) db.IDatabase { return store.Collection(name) }
+	}
+	client, err := db.MongoClient(mongoDbUri)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	ctx, cancel := db.DBReqContext(10)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		log.Fatalln(err.Error())
+	}
+	log.Println("mongodb connected")
+	return func(name string) db.IDatabase {
+		return db.NewDatabase(db.NewMongoCollection(client, mongoDbName, name))
+	}
+}
+
 func jsonMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Content-Type", "application/json")
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrIncorrectPassword  = errors.New("current password is incorrect")
+	ErrNoPassword         = errors.New("account has no password, set one with forgot password")
+	ErrSameEmail          = errors.New("new email is the current email")
+	ErrInvalidEmailChange = errors.New("invalid or expired email change link")
+)
+
+// checkCurrentPassword confirms a logged-in user knows their password before
+// changing their credentials. A stolen session gets 5 guesses per 15 minutes.
+func (as *AuthService) checkCurrentPassword(u *user.User, password string) error {
+	if u.Password == "" {
+		return ErrNoPassword
+	}
+	key := "current-password:" + u.Id.Hex()
+	if err := as.rateLimiter.Allow(key, 5, 15*time.Minute); err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(password, u.Password) {
+		return ErrIncorrectPassword
+	}
+	return as.rateLimiter.Reset(key)
+}
+
+// ChangePassword replaces the password of a logged-in user and logs out every
+// other session, keeping the one identified by accessUuid.
+func (as *AuthService) ChangePassword(userId primitive.ObjectID, accessUuid, currentPassword, newPassword string) error {
+	u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return err
+	}
+	if err := as.checkCurrentPassword(u, currentPassword); err != nil {
+		return err
+	}
+	if err := as.passwordPolicy.Check(newPassword, u.Email, u.Firstname, u.Lastname); err != nil {
+		return err
+	}
+	passwordHash, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if passwordHash == "" {
+		return errors.New("password hash is empty")
+	}
+	if err := as.userRepo.UpdateUser(bson.M{"_id": u.Id}, bson.M{"$set": bson.M{"password": passwordHash, "updated_at": time.Now()}}); err != nil {
+		return err
+	}
+	_, err = as.accessTokenManager.DeleteAccessTokens(bson.M{"user_id": u.Id, "access_uuid": bson.M{"$ne": accessUuid}})
+	return err
+}
+
+// RequestEmailChange starts moving a logged-in user to newEmail. The new
+// address gets a link that confirms it and the current address is told about
+// the change, so the owner can react before it takes effect. Only the latest
+// request of a user, and of an address, can be confirmed.
+func (as *AuthService) RequestEmailChange(userId primitive.ObjectID, password, newEmail string) error {
+	u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return err
+	}
+	if err := as.checkCurrentPassword(u, password); err != nil {
+		return err
+	}
+	newEmail = user.NormalizeEmail(newEmail)
+	if newEmail == u.Email {
+		return ErrSameEmail
+	}
+	if err := as.rateLimiter.Allow("email-change:"+u.Id.Hex(), 5, 24*time.Hour); err != nil {
+		return err
+	}
+	if _, err := as.userRepo.GetUser(bson.M{"email": newEmail}); err == nil {
+		return user.ErrEmailTaken
+	}
+
+	// every request takes the address over from whoever asked for it before,
+	// so only one account can be waiting for it when the link is opened
+	if err := as.userRepo.UpdateUser(bson.M{"pending_email": newEmail}, bson.M{"$unset": bson.M{"pending_email": ""}}); err != nil {
+		return err
+	}
+	if u.PendingEmail != "" {
+		if err := as.verificationTokenManager.InvalidateVerificationTokens(u.PendingEmail, utils.PurposeEmailChange); err != nil {
+			return err
+		}
+	}
+	if err := as.verificationTokenManager.InvalidateVerificationTokens(newEmail, utils.PurposeEmailChange); err != nil {
+		return err
+	}
+	if err := as.userRepo.UpdateUser(bson.M{"_id": u.Id}, bson.M{"$set": bson.M{"pending_email": newEmail, "updated_at": time.Now()}}); err != nil {
+		return err
+	}
+	token, err := utils.CreateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := as.verificationTokenManager.SaveVerificationToken(newEmail, utils.PurposeEmailChange, token); err != nil {
+		return err
+	}
+	link, err := utils.ConstructVerificationLink(as.baseUrl, "email-change", token, newEmail)
+	if err != nil {
+		return err
+	}
+	if err := as.emailManager.SendEmailChangeNotice(u.Email, u.Firstname, newEmail); err != nil {
+		return err
+	}
+	return as.emailManager.SendEmailChangeVerification(newEmail, u.Firstname, link)
+}
+
+// ConfirmEmailChange switches the account waiting for newEmail over to it with
+// the link sent to that address.
+func (as *AuthService) ConfirmEmailChange(newEmail, token string) error {
+	newEmail = user.NormalizeEmail(newEmail)
+	valid, err := as.verificationTokenManager.ConsumeVerificationToken(newEmail, utils.PurposeEmailChange, token)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidEmailChange
+	}
+	u, err := as.userRepo.GetUser(bson.M{"pending_email": newEmail})
+	if err != nil {
+		return ErrInvalidEmailChange
+	}
+	// links sent to the old address and logins waiting for a second factor
+	// under it must not outlive it
+	for _, purpose := range []utils.TokenPurpose{utils.PurposePasswordReset, utils.PurposePasswordResetGrant, utils.PurposeMagicLink, utils.PurposeAccountUnlock, utils.PurposeLoginChallenge} {
+		if err := as.verificationTokenManager.InvalidateVerificationTokens(u.Email, purpose); err != nil {
+			return err
+		}
+	}
+	if err := as.userRepo.UpdateUser(bson.M{"_id": u.Id, "pending_email": newEmail}, bson.M{
+		"$set":   bson.M{"email": newEmail, "updated_at": time.Now()},
+		"$unset": bson.M{"pending_email": ""},
+	}); err != nil {
+		return err
+	}
+	// failed logins are counted per email; the old address no longer belongs
+	// to the account and the new one starts without the failures of whoever
+	// tried it before
+	if err := as.loginThrottle.Reset(u.Email); err != nil {
+		return err
+	}
+	return as.loginThrottle.Reset(newEmail)
+}
@@ -1,19 +1,28 @@
 package auth
 
 import (
+	"errors"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
 	"github.com/ayo-ajayi/edutech/internal/utils"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 )
 
 type AuthController struct {
-	authService IAuthService
+	authService  IAuthService
+	resetFormUrl string
 }
 
-func NewAuthController(authService IAuthService) *AuthController {
+func NewAuthController(authService IAuthService, resetFormUrl string) *AuthController {
 	return &AuthController{
 		authService,
+		resetFormUrl,
 	}
 }
 func (ac *AuthController) Verify(c *gin.Context) {
@@ -29,21 +38,279 @@ func (ac *AuthController) Verify(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "user verified successfully"))
 }
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	req := struct {
+		Email string `json:"email" binding:"required,email"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := ac.authService.ResendVerification(req.Email, c.ClientIP()); err != nil {
+		var rateLimitErr *utils.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "if the email belongs to an unverified account, a new verification link has been sent"))
+}
+
+// loginResponse answers a login of any kind: with the two-factor challenge
+// when there is one, or with the user and their tokens.
+func loginResponse(c *gin.Context, user interface{}, tokenDetails *utils.AccessTokenDetails, challenge *LoginChallenge) {
+	if challenge != nil {
+		message := "two-factor authentication required"
+		if challenge.EnrollmentRequired {
+			message = "two-factor authentication must be set up to log in"
+		}
+		c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+			"two_factor_required": true,
+			"challenge":           challenge,
+		}, message))
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"user":          user,
+		"token_details": tokenDetails,
+	}, "user successfully logged in"))
+}
+
 func (ac *AuthController) Login(c *gin.Context) {
 	req := utils.LoginReq{}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	user, tokenDetails, err := ac.authService.Login(req.Email, req.Password)
+	user, tokenDetails, challenge, err := ac.authService.Login(req.Email, req.Password, clientInfo(c))
 	if err != nil {
+		var rateLimitErr *utils.RateLimitError
+		switch {
+		case errors.As(err, &rateLimitErr):
+			retryAfter := strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds())))
+			c.Header("Retry-After", retryAfter)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": "too many failed login attempts, try again in " + retryAfter + " seconds"}})
+		case errors.Is(err, ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, ErrAccountNotVerified), errors.Is(err, ErrAccountSuspended):
+			c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		}
+		return
+	}
+	loginResponse(c, user, tokenDetails, challenge)
+}
+
+func (ac *AuthController) RequestMagicLink(c *gin.Context) {
+	req := struct {
+		Email string `json:"email" binding:"required,email"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := ac.authService.RequestMagicLink(req.Email, c.ClientIP()); err != nil {
+		var rateLimitErr *utils.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "if the email belongs to an account that can log in with a link, one has been sent"))
+}
+
+func (ac *AuthController) MagicLinkLogin(c *gin.Context) {
+	token := c.Param("token")
+	email, err := url.QueryUnescape(c.Query("email"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid email"}})
+		return
+	}
+	user, tokenDetails, challenge, err := ac.authService.MagicLinkLogin(email, token, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMagicLink):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, ErrAccountSuspended):
+			c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		}
+		return
+	}
+	loginResponse(c, user, tokenDetails, challenge)
+}
+
+func (ac *AuthController) UnlockAccount(c *gin.Context) {
+	token := c.Param("token")
+	email, err := url.QueryUnescape(c.Query("email"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid email"}})
+		return
+	}
+	if err := ac.authService.UnlockAccount(email, token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "account unlocked, you can log in again"))
+}
+
+func (ac *AuthController) GetLockedAccounts(c *gin.Context) {
+	accounts, err := ac.authService.GetLockedAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(accounts, "locked accounts retrieved successfully"))
+}
+
+func (ac *AuthController) ResetLoginAttempts(c *gin.Context) {
+	if err := ac.authService.ResetLoginAttempts(c.Param("email")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "account unlocked successfully"))
+}
+
+func (ac *AuthController) CompleteLogin(c *gin.Context) {
+	req := struct {
+		Email          string `json:"email" binding:"required"`
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		utils.TwoFactorCodeReq
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if !hasTwoFactorCode(c, &req.TwoFactorCodeReq) {
+		return
+	}
+	user, tokenDetails, recoveryCodes, err := ac.authService.CompleteLogin(req.Email, req.ChallengeToken, &req.TwoFactorCodeReq, clientInfo(c))
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	data := gin.H{
 		"user":          user,
 		"token_details": tokenDetails,
-	}, "user successfully logged in"))
+	}
+	if recoveryCodes != nil {
+		data["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(data, "user successfully logged in"))
+}
+
+func (ac *AuthController) EnrollTwoFactorAtLogin(c *gin.Context) {
+	req := struct {
+		Email          string `json:"email" binding:"required"`
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	enrollment, err := ac.authService.EnrollTwoFactorAtLogin(req.Email, req.ChallengeToken)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(enrollment, "add the account to your authenticator app, then log in with a code from it"))
+}
+
+func (ac *AuthController) EnrollTwoFactor(c *gin.Context) {
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	enrollment, err := ac.authService.EnrollTwoFactor(userId)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(enrollment, "add the account to your authenticator app, then confirm with a code from it"))
+}
+
+func (ac *AuthController) ConfirmTwoFactor(c *gin.Context) {
+	req := struct {
+		Code string `json:"code" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	recoveryCodes, err := ac.authService.ConfirmTwoFactor(userId, req.Code)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"recovery_codes": recoveryCodes,
+	}, "two-factor authentication enabled, store the recovery codes somewhere safe"))
+}
+
+func (ac *AuthController) DisableTwoFactor(c *gin.Context) {
+	req := utils.TwoFactorCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if !hasTwoFactorCode(c, &req) {
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := ac.authService.DisableTwoFactor(userId, &req); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "two-factor authentication disabled"))
+}
+
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	req := utils.TwoFactorCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if !hasTwoFactorCode(c, &req) {
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	recoveryCodes, err := ac.authService.RegenerateRecoveryCodes(userId, &req)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"recovery_codes": recoveryCodes,
+	}, "recovery codes replaced, the old ones no longer work"))
+}
+
+func hasTwoFactorCode(c *gin.Context, req *utils.TwoFactorCodeReq) bool {
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "either code or recovery_code is required"}})
+		return false
+	}
+	return true
+}
+
+func twoFactorError(c *gin.Context, err error) {
+	var rateLimitErr *utils.RateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, ErrInvalidChallenge), errors.Is(err, ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "unauthorized: " + err.Error()}})
+	case errors.Is(err, ErrTwoFactorEnabled), errors.Is(err, ErrTwoFactorNotEnabled), errors.Is(err, ErrTwoFactorRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+	}
 }
 
 func (ac *AuthController) Logout(c *gin.Context) {
@@ -56,6 +323,65 @@ func (ac *AuthController) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "user successfully logged out"))
 }
 
+func (ac *AuthController) Sessions(c *gin.Context) {
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	sessions, err := ac.authService.GetSessions(userId, c.GetString("access_uuid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(sessions, "sessions retrieved successfully"))
+}
+
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	sessionId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid session id"}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := ac.authService.RevokeSession(userId, sessionId); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "session revoked successfully"))
+}
+
+func (ac *AuthController) RevokeAllSessions(c *gin.Context) {
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := ac.authService.RevokeAllSessions(userId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "logged out of all sessions successfully"))
+}
+
+func (ac *AuthController) RefreshToken(c *gin.Context) {
+	req := struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	tokenDetails, err := ac.authService.RefreshToken(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidRefreshToken) || errors.Is(err, utils.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "unauthorized: " + err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"token_details": tokenDetails,
+	}, "token refreshed successfully"))
+}
+
 func (ac *AuthController) ForgotPassword(c *gin.Context) {
 	req := struct {
 		Email string `json:"email" binding:"required"`
@@ -64,12 +390,57 @@ func (ac *AuthController) ForgotPassword(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	err := ac.authService.ForgotPassword(req.Email)
-	if err != nil {
+	if err := ac.authService.ForgotPassword(req.Email, c.ClientIP()); err != nil {
+		var rateLimitErr *utils.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "password reset token sent successfully"))
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "if the email belongs to an account, a password reset link has been sent"))
+}
+
+// VerifyResetToken is the target of the link in the password reset email. It
+// hands a reset grant to the reset form at resetFormUrl, or returns it as JSON
+// when no form is configured.
+func (ac *AuthController) VerifyResetToken(c *gin.Context) {
+	token := c.Param("token")
+	email := c.Query("email")
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid email"}})
+		return
+	}
+	grant, err := ac.authService.VerifyResetToken(email, token, c.ClientIP())
+	if err != nil {
+		var rateLimitErr *utils.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if ac.resetFormUrl != "" {
+		u, err := url.Parse(ac.resetFormUrl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		q := u.Query()
+		q.Set("email", email)
+		q.Set("token", grant)
+		u.RawQuery = q.Encode()
+		c.Redirect(http.StatusSeeOther, u.String())
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"email": email,
+		"token": grant,
+	}, "reset token verified, submit the new password with this token to /reset-password"))
 }
 
 func (ac *AuthController) ResetPassword(c *gin.Context) {
@@ -82,10 +453,173 @@ func (ac *AuthController) ResetPassword(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	err := ac.authService.ResetPassword(req.Email, req.Password, req.Token)
+	err := ac.authService.ResetPassword(req.Email, req.Password, req.Token, c.ClientIP())
 	if err != nil {
+		var policyErr *utils.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "password does not meet the policy", "violations": policyErr.Violations}})
+			return
+		}
+		var rateLimitErr *utils.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "password reset successfully"))
 }
+
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	req := struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := ac.authService.ChangePassword(userId, c.GetString("access_uuid"), req.CurrentPassword, req.NewPassword); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "password changed successfully, other sessions have been logged out"))
+}
+
+func (ac *AuthController) RequestEmailChange(c *gin.Context) {
+	req := struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := ac.authService.RequestEmailChange(userId, req.Password, req.Email); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "check the new email for a link to confirm it"))
+}
+
+func (ac *AuthController) ConfirmEmailChange(c *gin.Context) {
+	token := c.Param("token")
+	email, err := url.QueryUnescape(c.Query("email"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid email"}})
+		return
+	}
+	if err := ac.authService.ConfirmEmailChange(email, token); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidEmailChange):
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, user.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "email changed successfully, log in with the new email from now on"))
+}
+
+func accountError(c *gin.Context, err error) {
+	var rateLimitErr *utils.RateLimitError
+	var policyErr *utils.PasswordPolicyError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.As(err, &policyErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "password does not meet the policy", "violations": policyErr.Violations}})
+	case errors.Is(err, ErrIncorrectPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, ErrNoPassword), errors.Is(err, ErrSameEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, user.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+	}
+}
+
+func clientInfo(c *gin.Context) utils.ClientInfo {
+	return utils.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		Ip:        c.ClientIP(),
+	}
+}
+
+const oidcStateCookie = "oidc_state"
+
+type OIDCController struct {
+	oidcService   IOIDCService
+	secureCookies bool
+}
+
+// NewOIDCController sets its cookies Secure when secureCookies is set, which it
+// should be whenever the API is served over HTTPS.
+func NewOIDCController(oidcService IOIDCService, secureCookies bool) *OIDCController {
+	return &OIDCController{oidcService, secureCookies}
+}
+
+func (oc *OIDCController) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(oc.oidcService.GetProviders(), "login providers retrieved successfully"))
+}
+
+// Login redirects to the provider. The state is also kept in a cookie, so the
+// callback is only accepted in the browser that started the login.
+func (oc *OIDCController) Login(c *gin.Context) {
+	authUrl, state, err := oc.oidcService.StartLogin(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		if errors.Is(err, ErrOIDCProvider) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcLoginValidity.Seconds()), path.Dir(c.Request.URL.Path), "", oc.secureCookies, true)
+	c.Redirect(http.StatusFound, authUrl)
+}
+
+func (oc *OIDCController) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "login was not completed at the provider: " + providerErr}})
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || code == "" || cookie != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": ErrInvalidOIDCState.Error()}})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, path.Dir(c.Request.URL.Path), "", oc.secureCookies, true)
+	user, tokenDetails, challenge, err := oc.oidcService.FinishLogin(c.Param("provider"), state, code, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, ErrInvalidOIDCState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, ErrOIDCEmailNotVerified), errors.Is(err, ErrIdentityConflict), errors.Is(err, ErrAccountSuspended):
+			c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error()}})
+		case errors.Is(err, ErrOIDCProvider):
+			c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		}
+		return
+	}
+	loginResponse(c, user, tokenDetails, challenge)
+}
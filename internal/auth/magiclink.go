@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+// RequestMagicLink emails a single-use login link, replacing any link sent
+// before. Like ResendVerification it is rate limited and quietly does nothing
+// for emails that cannot use it: unknown, unverified or suspended accounts and
+// roles without magic link login.
+func (as *AuthService) RequestMagicLink(email, ip string) error {
+	if err := as.rateLimiter.Allow("magic-link:ip:"+ip, 10, time.Hour); err != nil {
+		return err
+	}
+	email = user.NormalizeEmail(email)
+	if err := as.rateLimiter.Allow("magic-link:email:"+email, 1, time.Minute); err != nil {
+		return err
+	}
+	if err := as.rateLimiter.Allow("magic-link:email-daily:"+email, 10, 24*time.Hour); err != nil {
+		return err
+	}
+
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil || !u.IsVerified || u.Suspended {
+		return nil
+	}
+	allowed, err := as.roleService.MagicLinkAllowed(u.GetRoles())
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
+	}
+
+	if err := as.verificationTokenManager.InvalidateVerificationTokens(email, utils.PurposeMagicLink); err != nil {
+		return err
+	}
+	// the link signs in on its own, so it must not be guessable from other ids
+	token, err := utils.CreateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := as.verificationTokenManager.SaveVerificationToken(email, utils.PurposeMagicLink, token); err != nil {
+		return err
+	}
+	link, err := utils.ConstructVerificationLink(as.baseUrl, "login/magic", token, email)
+	if err != nil {
+		return err
+	}
+	return as.emailManager.SendMagicLink(email, u.Firstname, link)
+}
+
+// MagicLinkLogin exchanges a login link for a session, or for a login
+// challenge when the user has to pass two-factor authentication, as Login does.
+func (as *AuthService) MagicLinkLogin(email, token string, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, *LoginChallenge, error) {
+	email = user.NormalizeEmail(email)
+	valid, err := as.verificationTokenManager.ConsumeVerificationToken(email, utils.PurposeMagicLink, token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !valid {
+		return nil, nil, nil, ErrInvalidMagicLink
+	}
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil {
+		return nil, nil, nil, ErrInvalidMagicLink
+	}
+	if u.Suspended {
+		return nil, nil, nil, ErrAccountSuspended
+	}
+	// the role may have been switched off since the link was sent
+	allowed, err := as.roleService.MagicLinkAllowed(u.GetRoles())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, nil, ErrInvalidMagicLink
+	}
+	challenge, err := as.loginChallenge(u)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if challenge != nil {
+		return nil, nil, challenge, nil
+	}
+	profile, accessTokenDetails, err := as.signIn(u, client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return profile, accessTokenDetails, nil, nil
+}
@@ -7,30 +7,23 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/ayo-ajayi/edutech/internal/student"
-	"github.com/ayo-ajayi/edutech/internal/tutor"
-	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/apikey"
+	"github.com/ayo-ajayi/edutech/internal/rbac"
 	"github.com/ayo-ajayi/edutech/internal/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthMiddleware struct {
-	accessTokenSecret  string
-	tutorRepo          tutor.IMiddlewareTutorRepo
-	studentRepo        student.IMiddlewareStudentRepo
 	accessTokenManager utils.IMiddlewareAccessTokenManager
+	apiKeyService      apikey.IMiddlewareApiKeyService
 }
 
-func NewAuthMiddleWare(accessTokenSecret string, tutorRepo tutor.IMiddlewareTutorRepo, studentRepo student.IMiddlewareStudentRepo, accessTokenManager utils.IMiddlewareAccessTokenManager) *AuthMiddleware {
+func NewAuthMiddleWare(accessTokenManager utils.IMiddlewareAccessTokenManager, apiKeyService apikey.IMiddlewareApiKeyService) *AuthMiddleware {
 	return &AuthMiddleware{
-		accessTokenSecret:  accessTokenSecret,
-		tutorRepo:          tutorRepo,
-		studentRepo:        studentRepo,
 		accessTokenManager: accessTokenManager,
+		apiKeyService:      apiKeyService,
 	}
 }
 
@@ -42,19 +35,20 @@ func (amw *AuthMiddleware) Authentication() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		jwtToken, err := amw.accessTokenManager.ValidateAccessToken(token, amw.accessTokenSecret)
+		if strings.HasPrefix(token, apikey.KeyPrefix) {
+			amw.apiKeyAuthentication(c, token)
+			return
+		}
+		jwtToken, err := amw.accessTokenManager.ValidateAccessToken(token)
 		if err != nil {
-			if errors.Is(err, jwt.ErrSignatureInvalid) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "unauthorized: invalid token"}})
-				c.Abort()
-				return
-			}
 			if errors.Is(err, jwt.ErrTokenExpired) {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "unauthorized: token expired"}})
 				c.Abort()
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": "internal server error"}})
+			// a wrong signature, unknown key, issuer or audience all mean the
+			// token is not one of ours
+			c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "unauthorized: invalid token"}})
 			c.Abort()
 			return
 		}
@@ -78,11 +72,47 @@ func (amw *AuthMiddleware) Authentication() gin.HandlerFunc {
 		}
 		c.Set("access_uuid", td.AccessUuid)
 		c.Set("user_id", accessDetails.UserId)
+		c.Set("roles", td.Roles)
+		c.Set("permissions", td.Permissions)
 		c.Next()
 	}
 
 }
 
+// apiKeyAuthentication lets a request with an API key in place of the access
+// token through as the owner of the key, limited to the scopes of the key.
+func (amw *AuthMiddleware) apiKeyAuthentication(c *gin.Context, key string) {
+	auth, err := amw.apiKeyService.Authenticate(key, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, apikey.ErrInvalidApiKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{"message": "unauthorized: invalid api key"}})
+			c.Abort()
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": "internal server error"}})
+		c.Abort()
+		return
+	}
+	c.Set("api_key_id", auth.KeyId)
+	c.Set("user_id", auth.UserId)
+	c.Set("roles", auth.Roles)
+	c.Set("permissions", auth.Permissions)
+	c.Next()
+}
+
+// RequireSession turns away requests made with an API key, for endpoints that
+// manage the account itself such as sessions, two-factor authentication and
+// API keys. It must run after Authentication.
+func (amw *AuthMiddleware) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": gin.H{"message": "Forbidden: this endpoint cannot be used with an api key"}})
+			return
+		}
+		c.Next()
+	}
+}
+
 func (amw *AuthMiddleware) extractToken(r *http.Request) string {
 	token := r.Header.Get("Authorization")
 	ttoken := strings.Split(token, " ")
@@ -92,38 +122,25 @@ func (amw *AuthMiddleware) extractToken(r *http.Request) string {
 	return ttoken[1]
 }
 
-func (amw *AuthMiddleware) Authorization(role user.Role) gin.HandlerFunc {
+// RequirePermissions lets the request through only if the access token or API
+// key grants every one of permissions. It must run after Authentication.
+// Suspending a user or taking roles away ends their sessions, so the claims can
+// be trusted without looking the user up.
+func (amw *AuthMiddleware) RequirePermissions(permissions ...rbac.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userId := c.MustGet("user_id").(primitive.ObjectID)
-		var currentUserRole user.Role
-
-		if role == user.Tutor {
-			tutor, err := amw.tutorRepo.GetTutor(bson.M{
-				"_id": userId})
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error() + ": you are not authorized to access this resource"}})
-				return
+		granted := c.GetStringSlice("permissions")
+		for _, permission := range permissions {
+			allowed := false
+			for _, p := range granted {
+				if p == string(permission) {
+					allowed = true
+					break
+				}
 			}
-			currentUserRole = tutor.Role
-		} else if role == user.Student {
-			student, err := amw.studentRepo.GetStudent(bson.M{
-				"_id": userId})
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error() + ": you are not authorized to access this resource"}})
+			if !allowed {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": gin.H{"message": "Forbidden: You are not authorized to access this resource"}})
 				return
 			}
-			currentUserRole = student.Role
-		} else {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": gin.H{"message": "invalid role"}})
-			return
-		}
-		allowed := false
-		if role == currentUserRole {
-			allowed = true
-		}
-		if !allowed {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": gin.H{"message": "Forbidden: You are not authorized to access this resource"}})
-			return
 		}
 		c.Next()
 	}
@@ -0,0 +1,453 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/student"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OIDCProviderConfig configures an OpenID Connect provider, for example Google
+// with the issuer https://accounts.google.com or a Microsoft tenant with
+// https://login.microsoftonline.com/<tenant id>/v2.0. TrustEmail accepts the
+// email of an ID token without an email_verified claim, which Microsoft does
+// not send; only set it for providers that own the email domains they sign in.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+	TrustEmail   bool
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// OIDCClaims are the ID token claims used to find or create the user.
+type OIDCClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// OIDCProvider runs the authorization code flow against one provider. The
+// discovery document is fetched on first use and the signing keys again
+// whenever a token is signed with a key that is not known yet.
+type OIDCProvider struct {
+	config      OIDCProviderConfig
+	redirectUrl string
+	client      *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+// NewOIDCProvider returns a provider that sends users back to redirectUrl.
+func NewOIDCProvider(config OIDCProviderConfig, redirectUrl string) *OIDCProvider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{
+		config:      config,
+		redirectUrl: redirectUrl,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (op *OIDCProvider) Name() string {
+	return op.config.Name
+}
+
+func (op *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.discovery != nil {
+		return op.discovery, nil
+	}
+	var discovery oidcDiscovery
+	if err := op.getJSON(op.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != op.config.Issuer {
+		return nil, errors.New(op.config.Name + " discovery document is for issuer " + discovery.Issuer)
+	}
+	op.discovery = &discovery
+	return op.discovery, nil
+}
+
+func (op *OIDCProvider) getJSON(url string, v interface{}) error {
+	res, err := op.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("GET " + url + ": " + res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// AuthorizationUrl is where the user is sent to sign in. codeVerifier is the
+// PKCE secret that the token request has to present again.
+func (op *OIDCProvider) AuthorizationUrl(state, nonce, codeVerifier string) (string, error) {
+	discovery, err := op.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", op.config.ClientId)
+	q.Set("redirect_uri", op.redirectUrl)
+	q.Set("scope", strings.Join(op.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for the ID token and verifies it.
+func (op *OIDCProvider) Exchange(code, codeVerifier, nonce string) (*OIDCClaims, error) {
+	discovery, err := op.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	res, err := op.client.PostForm(discovery.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {op.redirectUrl},
+		"client_id":     {op.config.ClientId},
+		"client_secret": {op.config.ClientSecret},
+		"code_verifier": {codeVerifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	token := struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, errors.New("invalid token response: " + err.Error())
+	}
+	if token.Error != "" {
+		return nil, errors.New(token.Error + ": " + token.ErrorDescription)
+	}
+	if res.StatusCode != http.StatusOK || token.IdToken == "" {
+		return nil, errors.New("token request failed: " + res.Status)
+	}
+	return op.verifyIdToken(token.IdToken, nonce)
+}
+
+func (op *OIDCProvider) verifyIdToken(idToken, nonce string) (*OIDCClaims, error) {
+	claims := &OIDCClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return op.key(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(op.config.Issuer),
+		jwt.WithAudience(op.config.ClientId),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, errors.New("invalid id token: " + err.Error())
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("id token has no expiry")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return claims, nil
+}
+
+// key returns the signing key kid, refreshing the key set once if it is not
+// known, since providers rotate their keys.
+func (op *OIDCProvider) key(kid string) (*rsa.PublicKey, error) {
+	op.mu.Lock()
+	key, ok := op.keys[kid]
+	op.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	discovery, err := op.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	jwks := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := op.getJSON(discovery.JwksUri, &jwks); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	op.mu.Lock()
+	op.keys = keys
+	op.mu.Unlock()
+	key, ok = keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key " + kid)
+	}
+	return key, nil
+}
+
+// email returns the verified email of claims, or "" if the provider did not
+// vouch for it.
+func (op *OIDCProvider) email(claims *OIDCClaims) string {
+	if claims.Email == "" || !(claims.EmailVerified || op.config.TrustEmail) {
+		return ""
+	}
+	return claims.Email
+}
+
+var (
+	ErrUnknownProvider      = errors.New("unknown login provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login, start again")
+	ErrOIDCEmailNotVerified = errors.New("the provider did not confirm your email address")
+	ErrIdentityConflict     = errors.New("the email is linked to another account at this provider")
+	ErrOIDCProvider         = errors.New("login provider error")
+)
+
+const oidcLoginValidity = 10 * time.Minute
+
+// OIDCService signs users in with OpenID Connect providers. A provider
+// account is linked to the user with the same verified email, and a student
+// account is created for emails that do not have one yet.
+type OIDCService struct {
+	authService   *AuthService
+	oidcLoginRepo IOIDCLoginRepo
+	providers     map[string]*OIDCProvider
+}
+
+func NewOIDCService(authService *AuthService, oidcLoginRepo IOIDCLoginRepo, providers ...*OIDCProvider) *OIDCService {
+	ois := &OIDCService{authService: authService, oidcLoginRepo: oidcLoginRepo, providers: map[string]*OIDCProvider{}}
+	for _, provider := range providers {
+		ois.providers[provider.Name()] = provider
+	}
+	return ois
+}
+
+// GetProviders returns the names of the configured providers.
+func (ois *OIDCService) GetProviders() []string {
+	names := []string{}
+	for name := range ois.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartLogin returns the URL to send the user to and the state the callback
+// has to come back with.
+func (ois *OIDCService) StartLogin(providerName string) (string, string, error) {
+	provider, ok := ois.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	secrets := make([]string, 3)
+	for i := range secrets {
+		secret, err := utils.CreateSecretToken()
+		if err != nil {
+			return "", "", err
+		}
+		secrets[i] = secret
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+	authUrl, err := provider.AuthorizationUrl(state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrOIDCProvider, err)
+	}
+	err = ois.oidcLoginRepo.CreateOIDCLogin(&OIDCLogin{
+		State:        utils.HashSecretToken(state),
+		Provider:     providerName,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginValidity),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authUrl, state, nil
+}
+
+// FinishLogin exchanges the code the provider sent the user back with for a
+// session, or for a login challenge if the user has to pass two-factor
+// authentication as with Login.
+func (ois *OIDCService) FinishLogin(providerName, state, code string, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, *LoginChallenge, error) {
+	provider, ok := ois.providers[providerName]
+	if !ok {
+		return nil, nil, nil, ErrUnknownProvider
+	}
+	login, err := ois.oidcLoginRepo.ConsumeOIDCLogin(bson.M{
+		"_id":        utils.HashSecretToken(state),
+		"provider":   providerName,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, nil, ErrInvalidOIDCState
+		}
+		return nil, nil, nil, err
+	}
+	claims, err := provider.Exchange(code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrOIDCProvider, err)
+	}
+	u, err := ois.findOrCreateUser(provider, claims)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if u.Suspended {
+		return nil, nil, nil, ErrAccountSuspended
+	}
+	challenge, err := ois.authService.loginChallenge(u)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if challenge != nil {
+		return nil, nil, challenge, nil
+	}
+	profile, accessTokenDetails, err := ois.authService.signIn(u, client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return profile, accessTokenDetails, nil, nil
+}
+
+func (ois *OIDCService) findOrCreateUser(provider *OIDCProvider, claims *OIDCClaims) (*user.User, error) {
+	userRepo := ois.authService.userRepo
+	u, err := userRepo.GetUser(bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider.Name(), "subject": claims.Subject}}})
+	if err == nil {
+		return u, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	email := user.NormalizeEmail(provider.email(claims))
+	if email == "" {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	identity := user.Identity{Provider: provider.Name(), Subject: claims.Subject, Email: email, LinkedAt: time.Now()}
+	u, err = userRepo.GetUser(bson.M{"email": email})
+	if err == mongo.ErrNoDocuments {
+		return ois.createStudent(claims, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, linked := range u.Identities {
+		if linked.Provider == provider.Name() {
+			return nil, ErrIdentityConflict
+		}
+	}
+	set := bson.M{"updated_at": time.Now()}
+	if !u.IsVerified {
+		// the provider has just proven the email belongs to this user, so a
+		// password set by whoever signed up with it before must not work
+		set["is_verified"] = true
+		set["password"] = ""
+		if u.Role == user.Student {
+			if err := ois.authService.registerCompulsorySubjects(u.Id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := userRepo.UpdateUser(bson.M{"_id": u.Id}, bson.M{"$set": set, "$push": bson.M{"identities": identity}}); err != nil {
+		return nil, err
+	}
+	return userRepo.GetUser(bson.M{"_id": u.Id})
+}
+
+// createStudent provisions a verified student without a password. They can
+// set one with the password reset flow.
+func (ois *OIDCService) createStudent(claims *OIDCClaims, identity user.Identity) (*user.User, error) {
+	firstname, lastname := claims.GivenName, claims.FamilyName
+	if firstname == "" && lastname == "" {
+		firstname, lastname, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+	s := &student.Student{
+		User: &user.User{
+			Email:      identity.Email,
+			Firstname:  firstname,
+			Lastname:   lastname,
+			IsVerified: true,
+			Role:       user.Student,
+			Identities: []user.Identity{identity},
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		},
+		Subjects: []primitive.ObjectID{},
+	}
+	if err := ois.authService.studentRepo.CreateStudent(s); err != nil {
+		return nil, err
+	}
+	if err := ois.authService.registerCompulsorySubjects(s.Id); err != nil {
+		return nil, err
+	}
+	return s.User, nil
+}
+
+type IOIDCService interface {
+	GetProviders() []string
+	StartLogin(providerName string) (string, string, error)
+	FinishLogin(providerName, state, code string, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, *LoginChallenge, error)
+}
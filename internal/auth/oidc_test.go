@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testClientId = "edutech-test"
+
+// mockIssuer is a minimal OpenID Connect provider. It remembers the nonce and
+// PKCE challenge of the last authorization request and issues an ID token for
+// them, after claims has had the chance to tamper with it.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	claims func(claims jwt.MapClaims)
+
+	mu        sync.Mutex
+	nonce     string
+	challenge string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := &mockIssuer{key: key, kid: "key-1", claims: func(jwt.MapClaims) {}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mi.server.URL,
+			"authorization_endpoint": mi.server.URL + "/authorize",
+			"token_endpoint":         mi.server.URL + "/token",
+			"jwks_uri":               mi.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", mi.token)
+	mi.server = httptest.NewServer(mux)
+	t.Cleanup(mi.server.Close)
+	return mi
+}
+
+// authorize stands in for the user signing in at the provider.
+func (mi *mockIssuer) authorize(t *testing.T, authUrl string) {
+	t.Helper()
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientId || q.Get("code_challenge_method") != "S256" || q.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request %s", authUrl)
+	}
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mi.nonce, mi.challenge = q.Get("nonce"), q.Get("code_challenge")
+}
+
+func (mi *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	mi.mu.Lock()
+	nonce, challenge := mi.nonce, mi.challenge
+	mi.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != "the-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code or verifier"})
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":            mi.server.URL,
+		"aud":            testClientId,
+		"sub":            "provider-user-1",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "Ada@X.io",
+		"email_verified": true,
+		"given_name":     "Ada",
+		"family_name":    "Lovelace",
+	}
+	mi.claims(claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mi.kid
+	idToken, err := token.SignedString(mi.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func newTestOIDCService(t *testing.T, mi *mockIssuer, config OIDCProviderConfig) (*OIDCService, db.IDatabase) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	users := store.Collection(user.Collection)
+	config.Name = "mock"
+	config.Issuer = mi.server.URL
+	config.ClientId = testClientId
+	provider := NewOIDCProvider(config, "http://localhost/api/v1/oidc/mock/callback")
+	return NewOIDCService(&AuthService{userRepo: user.NewUserRepo(users)}, NewOIDCLoginRepo(store.Collection("oidc_logins")), provider), users
+}
+
+// login runs the whole flow and returns the error of FinishLogin.
+func login(t *testing.T, ois *OIDCService, mi *mockIssuer) error {
+	t.Helper()
+	authUrl, state, err := ois.StartLogin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi.authorize(t, authUrl)
+	_, _, _, err = ois.FinishLogin("mock", state, "the-code", utils.ClientInfo{})
+	return err
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   func(claims jwt.MapClaims)
+		verifier string
+		ok       bool
+	}{
+		{"valid token", func(jwt.MapClaims) {}, "", true},
+		{"nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "someone else's nonce" }, "", false},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, "", false},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, "", false},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "", false},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, "", false},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, "", false},
+		{"wrong verifier", func(jwt.MapClaims) {}, "wrong", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi := newMockIssuer(t)
+			mi.claims = tt.claims
+			provider := NewOIDCProvider(OIDCProviderConfig{Name: "mock", Issuer: mi.server.URL, ClientId: testClientId}, "http://localhost/callback")
+			authUrl, err := provider.AuthorizationUrl("state", "nonce", "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			mi.authorize(t, authUrl)
+			verifier := "verifier"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			claims, err := provider.Exchange("the-code", verifier, "nonce")
+			if tt.ok != (err == nil) {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && (claims.Subject != "provider-user-1" || provider.email(claims) != "Ada@X.io") {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderRejectsUnknownKey(t *testing.T) {
+	mi := newMockIssuer(t)
+	provider := NewOIDCProvider(OIDCProviderConfig{Name: "mock", Issuer: mi.server.URL, ClientId: testClientId}, "http://localhost/callback")
+	authUrl, err := provider.AuthorizationUrl("state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi.authorize(t, authUrl)
+	// signed with a key the JWKS does not publish
+	mi.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	mi.kid = "key-2"
+	if _, err := provider.Exchange("the-code", "verifier", "nonce"); err == nil {
+		t.Error("a token signed with an unpublished key was accepted")
+	}
+}
+
+func TestOIDCProviderEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustEmail bool
+		verified   bool
+		want       string
+	}{
+		{"verified", false, true, "ada@x.io"},
+		{"unverified", false, false, ""},
+		{"trusted provider", true, false, "ada@x.io"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewOIDCProvider(OIDCProviderConfig{TrustEmail: tt.trustEmail}, "")
+			if got := provider.email(&OIDCClaims{Email: "ada@x.io", EmailVerified: tt.verified}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	mi := newMockIssuer(t)
+	mi.claims = func(c jwt.MapClaims) { c["email_verified"] = false }
+	ois, _ := newTestOIDCService(t, mi, OIDCProviderConfig{})
+	if err := login(t, ois, mi); !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Errorf("got %v, want %v", err, ErrOIDCEmailNotVerified)
+	}
+}
+
+func TestOIDCLoginRejectsBadTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims jwt.MapClaims)
+	}{
+		{"nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi := newMockIssuer(t)
+			mi.claims = tt.claims
+			ois, _ := newTestOIDCService(t, mi, OIDCProviderConfig{})
+			if err := login(t, ois, mi); !errors.Is(err, ErrOIDCProvider) {
+				t.Errorf("got %v, want %v", err, ErrOIDCProvider)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	mi := newMockIssuer(t)
+	ois, _ := newTestOIDCService(t, mi, OIDCProviderConfig{})
+	authUrl, state, err := ois.StartLogin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi.authorize(t, authUrl)
+	if _, _, _, err := ois.FinishLogin("mock", "forged", "the-code", utils.ClientInfo{}); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("unknown state: got %v, want %v", err, ErrInvalidOIDCState)
+	}
+	if _, _, _, err := ois.FinishLogin("other", state, "the-code", utils.ClientInfo{}); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("unknown provider: got %v, want %v", err, ErrUnknownProvider)
+	}
+	// a failed exchange still uses the state up
+	if _, _, _, err := ois.FinishLogin("mock", state, "wrong-code", utils.ClientInfo{}); !errors.Is(err, ErrOIDCProvider) {
+		t.Errorf("wrong code: got %v, want %v", err, ErrOIDCProvider)
+	}
+	if _, _, _, err := ois.FinishLogin("mock", state, "the-code", utils.ClientInfo{}); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("reused state: got %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+// A linked, suspended account stops the login right after the ID token was
+// verified and the account found, which shows the whole exchange worked.
+func TestOIDCLoginFindsLinkedAccount(t *testing.T) {
+	mi := newMockIssuer(t)
+	ois, users := newTestOIDCService(t, mi, OIDCProviderConfig{})
+	u := &user.User{
+		Id:         primitive.NewObjectID(),
+		Email:      "other@x.io",
+		IsVerified: true,
+		Suspended:  true,
+		Identities: []user.Identity{{Provider: "mock", Subject: "provider-user-1", Email: "other@x.io"}},
+	}
+	if _, err := users.InsertOne(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	if err := login(t, ois, mi); !errors.Is(err, ErrAccountSuspended) {
+		t.Errorf("got %v, want %v", err, ErrAccountSuspended)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OIDCLogin is a login that was sent to a provider and has not come back yet.
+// It is keyed by the hash of the state parameter.
+type OIDCLogin struct {
+	State        string    `bson:"_id"`
+	Provider     string    `bson:"provider"`
+	CodeVerifier string    `bson:"code_verifier"`
+	Nonce        string    `bson:"nonce"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
+
+type OIDCLoginRepo struct {
+	db db.IDatabase
+}
+
+func NewOIDCLoginRepo(db db.IDatabase) *OIDCLoginRepo {
+	return &OIDCLoginRepo{db: db}
+}
+
+// InitOIDCLoginExpiryIndex lets the database delete logins that were never
+// finished.
+func InitOIDCLoginExpiryIndex(database db.IDatabase) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := database.CreateIndex(ctx, indexModel)
+	if err != nil {
+		return errors.New("Error creating TTL index for oidc logins collection:" + err.Error())
+	}
+	return nil
+}
+
+func (olr *OIDCLoginRepo) CreateOIDCLogin(login *OIDCLogin) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := olr.db.InsertOne(ctx, login)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeOIDCLogin returns the login matching filter and deletes it, so a
+// state can only be used once.
+func (olr *OIDCLoginRepo) ConsumeOIDCLogin(filter interface{}) (*OIDCLogin, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var login OIDCLogin
+	if err := olr.db.FindOne(ctx, filter).Decode(&login); err != nil {
+		return nil, err
+	}
+	res, err := olr.db.DeleteOne(ctx, bson.M{"_id": login.State})
+	if err != nil {
+		return nil, err
+	}
+	if res.DeletedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &login, nil
+}
+
+type IOIDCLoginRepo interface {
+	CreateOIDCLogin(login *OIDCLogin) error
+	ConsumeOIDCLogin(filter interface{}) (*OIDCLogin, error)
+}
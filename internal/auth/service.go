@@ -2,157 +2,478 @@ package auth
 
 import (
 	"errors"
+	"log"
 	"time"
 
+	"github.com/ayo-ajayi/edutech/internal/admin"
+	"github.com/ayo-ajayi/edutech/internal/rbac"
 	"github.com/ayo-ajayi/edutech/internal/student"
 	"github.com/ayo-ajayi/edutech/internal/subject"
 	"github.com/ayo-ajayi/edutech/internal/tutor"
+	"github.com/ayo-ajayi/edutech/internal/user"
 	"github.com/ayo-ajayi/edutech/internal/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAccountNotVerified = errors.New("account not verified")
+	ErrAccountSuspended   = errors.New("account suspended")
+)
+
 type AuthService struct {
 	baseUrl                  string
 	emailManager             utils.IEmailManager
 	accessTokenManager       utils.IAccessTokenManager
 	verificationTokenManager utils.IVerificationTokenManager
+	userRepo                 user.IUserRepo
 	tutorRepo                tutor.ITutorRepo
 	studentRepo              student.IStudentRepo
+	adminRepo                admin.IAdminRepo
 	subjectRepo              subject.IStudentSubjectRepo
+	rateLimiter              utils.IRateLimiter
+	loginThrottle            utils.ILoginThrottle
+	roleService              rbac.IAuthRoleService
+	passwordPolicy           utils.IPasswordPolicy
+	// dummyPasswordHash is checked against when no account has the email, so
+	// those logins take as long as ones with a wrong password.
+	dummyPasswordHash string
 }
 
-func NewAuthService(tutorRepo tutor.ITutorRepo, studentRepo student.IStudentRepo, subjectRepo subject.ISubjectRepo, accessTokenManager utils.IAccessTokenManager, verificationTokenManager utils.IVerificationTokenManager, emailManager utils.IEmailManager, baseUrl string) *AuthService {
-	return &AuthService{tutorRepo: tutorRepo,
+func NewAuthService(userRepo user.IUserRepo, tutorRepo tutor.ITutorRepo, studentRepo student.IStudentRepo, adminRepo admin.IAdminRepo, subjectRepo subject.ISubjectRepo, roleService rbac.IAuthRoleService, accessTokenManager utils.IAccessTokenManager, verificationTokenManager utils.IVerificationTokenManager, emailManager utils.IEmailManager, rateLimiter utils.IRateLimiter, loginThrottle utils.ILoginThrottle, passwordPolicy utils.IPasswordPolicy, baseUrl string) *AuthService {
+	dummyPasswordHash, _ := utils.HashPassword("dummy password for unknown emails")
+	return &AuthService{userRepo: userRepo,
+		tutorRepo:                tutorRepo,
+		rateLimiter:              rateLimiter,
+		loginThrottle:            loginThrottle,
 		studentRepo:              studentRepo,
+		adminRepo:                adminRepo,
 		accessTokenManager:       accessTokenManager,
 		verificationTokenManager: verificationTokenManager,
 		emailManager:             emailManager,
 		baseUrl:                  baseUrl,
 		subjectRepo:              subjectRepo,
+		roleService:              roleService,
+		passwordPolicy:           passwordPolicy,
+		dummyPasswordHash:        dummyPasswordHash,
 	}
 }
 
 func (as *AuthService) Verify(email, token string) error {
-	valid, err := as.verificationTokenManager.ValidateVerificationToken(email, token)
+	email = user.NormalizeEmail(email)
+	valid, err := as.verificationTokenManager.ConsumeVerificationToken(email, utils.PurposeSignup, token)
 	if err != nil {
 		return err
 	}
 	if !valid {
 		return errors.New("invalid token")
 	}
-	tutor, err := as.tutorRepo.GetTutor(bson.M{"user.email": email})
-	if err == nil && tutor != nil {
-		if err := as.tutorRepo.UpdateTutor(bson.M{"user.email": email}, bson.M{"$set": bson.M{"user.is_verified": true}}); err != nil {
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil {
+		return errors.New("invalid email")
+	}
+	if u.Role == user.Student {
+		if err := as.registerCompulsorySubjects(u.Id); err != nil {
 			return err
 		}
+	}
+	return as.userRepo.UpdateUser(bson.M{"_id": u.Id}, bson.M{"$set": bson.M{"is_verified": true, "updated_at": time.Now()}})
+}
+
+func (as *AuthService) registerCompulsorySubjects(studentId primitive.ObjectID) error {
+	subjects, err := as.subjectRepo.GetSubjects(bson.M{"compulsory": true})
+	if err != nil {
+		return err
+	}
+	compulsorySubjects := []primitive.ObjectID{}
+	for _, subject := range subjects {
+		compulsorySubjects = append(compulsorySubjects, subject.Id)
+	}
+	return as.studentRepo.UpdateStudent(bson.M{"_id": studentId}, bson.M{"$set": bson.M{"subjects": compulsorySubjects}})
+}
+
+// ResendVerification emails a fresh verification link to an unverified
+// account, invalidating the previous links. Unknown and already verified
+// emails are ignored silently so the endpoint does not reveal which emails
+// are registered.
+func (as *AuthService) ResendVerification(email, ip string) error {
+	if err := as.rateLimiter.Allow("verify-resend:ip:"+ip, 10, time.Hour); err != nil {
+		return err
+	}
+	email = user.NormalizeEmail(email)
+	if err := as.rateLimiter.Allow("verify-resend:email:"+email, 1, time.Minute); err != nil {
+		return err
+	}
+	if err := as.rateLimiter.Allow("verify-resend:email-daily:"+email, 5, 24*time.Hour); err != nil {
+		return err
+	}
+
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil || u.IsVerified {
 		return nil
 	}
 
-	student, err := as.studentRepo.GetStudent(bson.M{"user.email": email})
-	if err == nil && student != nil {
-		subjects, err := as.subjectRepo.GetSubjects(bson.M{"compulsory": true})
+	if err := as.verificationTokenManager.InvalidateVerificationTokens(email, utils.PurposeSignup); err != nil {
+		return err
+	}
+	verificationToken, err := utils.CreateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := as.verificationTokenManager.SaveVerificationToken(email, utils.PurposeSignup, verificationToken); err != nil {
+		return err
+	}
+	link, err := utils.ConstructVerificationLink(as.baseUrl, "verify", verificationToken, email)
+	if err != nil {
+		return err
+	}
+	return as.emailManager.SendSignUpVerificationToken(email, u.Firstname, link)
+}
+
+// Login checks the password of a user. Users who have enabled two-factor
+// authentication, or whose role requires it, get a challenge to complete with
+// CompleteLogin instead of an access token. Failed attempts slow down and
+// eventually lock further logins for the email and the IP address; unknown
+// emails and wrong passwords fail the same way.
+func (as *AuthService) Login(email, password string, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, *LoginChallenge, error) {
+	email = user.NormalizeEmail(email)
+	if err := as.loginThrottle.Check(email, client.Ip); err != nil {
+		return nil, nil, nil, err
+	}
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil {
+		utils.CheckPasswordHash(password, as.dummyPasswordHash)
+		return nil, nil, nil, as.loginFailed(email, client.Ip, nil)
+	}
+	if !utils.CheckPasswordHash(password, u.Password) {
+		return nil, nil, nil, as.loginFailed(email, client.Ip, u)
+	}
+	as.rehashPassword(u, password)
+	if err := as.loginThrottle.Reset(email); err != nil {
+		return nil, nil, nil, err
+	}
+	if !u.IsVerified {
+		return nil, nil, nil, ErrAccountNotVerified
+	}
+	if u.Suspended {
+		return nil, nil, nil, ErrAccountSuspended
+	}
+	challenge, err := as.loginChallenge(u)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if challenge != nil {
+		return nil, nil, challenge, nil
+	}
+	profile, accessTokenDetails, err := as.signIn(u, client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return profile, accessTokenDetails, nil, nil
+}
+
+// rehashPassword upgrades a password hash made with a lower bcrypt cost than
+// new hashes use. It only runs while the plain password is at hand, after a
+// successful check, and a failure leaves the old hash working.
+func (as *AuthService) rehashPassword(u *user.User, password string) {
+	if !utils.PasswordNeedsRehash(u.Password) {
+		return
+	}
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Println("password rehash error: ", err)
+		return
+	}
+	if err := as.userRepo.UpdateUser(bson.M{"_id": u.Id, "password": u.Password}, bson.M{"$set": bson.M{"password": passwordHash}}); err != nil {
+		log.Println("password rehash error: ", err)
+		return
+	}
+	u.Password = passwordHash
+}
+
+// loginFailed records a failed login and returns ErrInvalidCredentials. When
+// the failure locks the account, its owner is emailed a link to unlock it.
+func (as *AuthService) loginFailed(email, ip string, u *user.User) error {
+	lockedOut, err := as.loginThrottle.Failed(email, ip)
+	if err != nil {
+		return err
+	}
+	if lockedOut && u != nil {
+		if err := as.verificationTokenManager.InvalidateVerificationTokens(email, utils.PurposeAccountUnlock); err != nil {
+			return err
+		}
+		token, err := utils.CreateSecretToken()
 		if err != nil {
 			return err
 		}
-		compulsorySubjects := []primitive.ObjectID{}
-		for _, subject := range subjects {
-			compulsorySubjects = append(compulsorySubjects, subject.Id)
+		if err := as.verificationTokenManager.SaveVerificationToken(email, utils.PurposeAccountUnlock, token); err != nil {
+			return err
 		}
-		if err := as.studentRepo.UpdateStudent(bson.M{"user.email": email}, bson.M{"$set": bson.M{"user.is_verified": true, "subjects": compulsorySubjects}}); err != nil {
+		link, err := utils.ConstructVerificationLink(as.baseUrl, "unlock", token, email)
+		if err != nil {
+			return err
+		}
+		if err := as.emailManager.SendAccountLocked(email, u.Firstname, link); err != nil {
 			return err
 		}
-		//delete token after user is updated
-		return nil
 	}
-	return errors.New("invalid email")
+	return ErrInvalidCredentials
 }
 
-func (as *AuthService) Login(email, password string) (interface{}, *utils.AccessTokenDetails, error) {
-	tutor, err := as.tutorRepo.GetTutor(bson.M{"user.email": email})
-	if err == nil && tutor != nil {
-		if !tutor.IsVerified {
-			return nil, nil, errors.New("tutor not verified")
-		}
-		if !utils.CheckPasswordHash(password, tutor.Password) {
-			return nil, nil, errors.New("invalid username or password")
-		}
-		accessTokenDetails, err := as.accessToken(tutor.Id)
-		if err != nil {
-			return nil, nil, err
-		}
-		return tutor, accessTokenDetails, nil
+// UnlockAccount lifts a lockout with the link from the account locked email.
+func (as *AuthService) UnlockAccount(email, token string) error {
+	email = user.NormalizeEmail(email)
+	valid, err := as.verificationTokenManager.ConsumeVerificationToken(email, utils.PurposeAccountUnlock, token)
+	if err != nil {
+		return err
 	}
+	if !valid {
+		return errors.New("invalid token")
+	}
+	return as.loginThrottle.Reset(email)
+}
 
-	student, err := as.studentRepo.GetStudent(bson.M{"user.email": email})
-	if err == nil && student != nil {
-		if !student.IsVerified {
-			return nil, nil, errors.New("student not verified")
-		}
-		if !utils.CheckPasswordHash(password, student.Password) {
-			return nil, nil, errors.New("invalid username or password")
-		}
-		accessTokenDetails, err := as.accessToken(student.Id)
-		if err != nil {
-			return nil, nil, err
-		}
-		return student, accessTokenDetails, nil
+func (as *AuthService) GetLockedAccounts() ([]*utils.LoginAttempts, error) {
+	return as.loginThrottle.GetLockedAccounts()
+}
+
+// ResetLoginAttempts lets an admin unlock an email.
+func (as *AuthService) ResetLoginAttempts(email string) error {
+	return as.loginThrottle.Reset(user.NormalizeEmail(email))
+}
+
+// signIn starts a session for u and returns their profile with the tokens.
+func (as *AuthService) signIn(u *user.User, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, error) {
+	var profile interface{}
+	var err error
+	switch u.Role {
+	case user.Tutor:
+		profile, err = as.tutorRepo.GetTutor(bson.M{"_id": u.Id})
+	case user.Student:
+		profile, err = as.studentRepo.GetStudent(bson.M{"_id": u.Id})
+	case user.Admin:
+		profile, err = as.adminRepo.GetAdmin(bson.M{"_id": u.Id})
+	default:
+		err = errors.New("invalid role")
+	}
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil, nil, errors.New("invalid username or password")
+	accessTokenDetails, err := as.accessToken(u, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return profile, accessTokenDetails, nil
 }
 
-func (as *AuthService) accessToken(id primitive.ObjectID) (*utils.AccessTokenDetails, error) {
-	accessToken, err := as.accessTokenManager.GenerateAccessToken(id)
+func (as *AuthService) accessToken(u *user.User, client utils.ClientInfo) (*utils.AccessTokenDetails, error) {
+	claims, err := as.claims(u)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := as.accessTokenManager.GenerateAccessToken(u.Id, claims)
 	if err != nil {
 		return nil, err
 	}
-	if err := as.accessTokenManager.SaveAccessToken(id, accessToken); err != nil {
+	if err := as.accessTokenManager.SaveAccessToken(u.Id, accessToken, client); err != nil {
 		return nil, err
 	}
 	if accessToken == nil {
 		return nil, errors.New("access token is empty")
 	}
 	return &utils.AccessTokenDetails{
-		AccessToken: accessToken.AccessToken,
-		AtExpires:   accessToken.AtExpires,
+		AccessToken:  accessToken.AccessToken,
+		AtExpires:    accessToken.AtExpires,
+		RefreshToken: accessToken.RefreshToken,
+		RtExpires:    accessToken.RtExpires,
 	}, nil
 }
 
+// claims puts the roles of u and the permissions they grant in the access token.
+func (as *AuthService) claims(u *user.User) (utils.AccessClaims, error) {
+	roles := u.GetRoles()
+	permissions, err := as.roleService.Permissions(roles)
+	if err != nil {
+		return utils.AccessClaims{}, err
+	}
+	claims := utils.AccessClaims{Roles: []string{}, Permissions: []string{}}
+	for _, role := range roles {
+		claims.Roles = append(claims.Roles, string(role))
+	}
+	for _, permission := range permissions {
+		claims.Permissions = append(claims.Permissions, string(permission))
+	}
+	return claims, nil
+}
+
+// RefreshToken issues a new token pair with the current roles and permissions
+// of the user.
+func (as *AuthService) RefreshToken(refreshToken string) (*utils.AccessTokenDetails, error) {
+	return as.accessTokenManager.RefreshAccessToken(refreshToken, func(userId primitive.ObjectID) (utils.AccessClaims, error) {
+		u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+		if err != nil || u.Suspended {
+			return utils.AccessClaims{}, utils.ErrInvalidRefreshToken
+		}
+		if !u.TwoFactorEnabled() {
+			// a role that now requires two-factor authentication sends the
+			// user back to login to enroll
+			required, err := as.roleService.TwoFactorRequired(u.GetRoles())
+			if err != nil {
+				return utils.AccessClaims{}, err
+			}
+			if required {
+				return utils.AccessClaims{}, utils.ErrInvalidRefreshToken
+			}
+		}
+		return as.claims(u)
+	})
+}
+
 func (as *AuthService) Logout(accessUuid string) error {
 	return as.accessTokenManager.DeleteAccessToken(bson.M{"access_uuid": accessUuid})
 }
-func (as *AuthService) ForgotPassword(email string) error {
-	resetToken := utils.CreateVerificationToken()
-	if err := as.verificationTokenManager.SaveVerificationToken(email, resetToken); err != nil {
-		return err
+func (as *AuthService) GetSessions(userId primitive.ObjectID, currentAccessUuid string) ([]*utils.SessionRes, error) {
+	accessTokens, err := as.accessTokenManager.GetAccessTokens(bson.M{"user_id": userId, "refresh_expire_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, err
 	}
-	link, err := utils.ConstructVerificationLink(as.baseUrl, "verify-reset-token", resetToken, email)
+	sessions := []*utils.SessionRes{}
+	for _, accessToken := range accessTokens {
+		sessions = append(sessions, &utils.SessionRes{
+			Id:        accessToken.ID,
+			UserAgent: accessToken.UserAgent,
+			Ip:        accessToken.Ip,
+			Current:   accessToken.AccessUuid == currentAccessUuid,
+			CreatedAt: accessToken.CreatedAt,
+			ExpiresAt: accessToken.RefreshExpireAt,
+		})
+	}
+	return sessions, nil
+}
+
+func (as *AuthService) RevokeSession(userId primitive.ObjectID, sessionId primitive.ObjectID) error {
+	deleted, err := as.accessTokenManager.DeleteAccessTokens(bson.M{"_id": sessionId, "user_id": userId})
 	if err != nil {
 		return err
 	}
-	tutor, err := as.tutorRepo.GetTutor(bson.M{"user.email": email})
-	if err == nil && tutor != nil {
-		if err := as.emailManager.SendResetPasswordToken(email, tutor.Firstname, link); err != nil {
-			return err
-		}
-		return nil
+	if deleted == 0 {
+		return ErrSessionNotFound
 	}
-	student, err := as.studentRepo.GetStudent(bson.M{"user.email": email})
-	if err == nil && student != nil {
-		if err := as.emailManager.SendResetPasswordToken(email, student.Firstname, link); err != nil {
-			return err
-		}
+	return nil
+}
+
+func (as *AuthService) RevokeAllSessions(userId primitive.ObjectID) error {
+	_, err := as.accessTokenManager.DeleteAccessTokens(bson.M{"user_id": userId})
+	return err
+}
+
+// ForgotPassword emails a password reset link. Like ResendVerification it is
+// rate limited and quietly does nothing for unknown emails, so it cannot be
+// used to find out which emails have an account.
+func (as *AuthService) ForgotPassword(email, ip string) error {
+	if err := as.rateLimiter.Allow("forgot-password:ip:"+ip, 10, time.Hour); err != nil {
+		return err
+	}
+	email = user.NormalizeEmail(email)
+	if err := as.rateLimiter.Allow("forgot-password:email:"+email, 1, time.Minute); err != nil {
+		return err
+	}
+	if err := as.rateLimiter.Allow("forgot-password:email-daily:"+email, 5, 24*time.Hour); err != nil {
+		return err
+	}
+
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil {
 		return nil
 	}
-	return errors.New("invalid email")
+	// only the most recently requested reset link works
+	if err := as.verificationTokenManager.InvalidateVerificationTokens(email, utils.PurposePasswordReset); err != nil {
+		return err
+	}
+	resetToken, err := utils.CreateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := as.verificationTokenManager.SaveVerificationToken(email, utils.PurposePasswordReset, resetToken); err != nil {
+		return err
+	}
+	link, err := utils.ConstructVerificationLink(as.baseUrl, "verify-reset-token", resetToken, email)
+	if err != nil {
+		return err
+	}
+	return as.emailManager.SendResetPasswordToken(email, u.Firstname, link)
+}
 
+// checkResetAttempt limits how many reset tokens can be tried per email and
+// per IP address, so they cannot be guessed. Attempts for an email are
+// forgotten once a token is accepted; those of an IP address are not, so a
+// reset of one's own account does not buy more guesses at another.
+func (as *AuthService) checkResetAttempt(email, ip string) error {
+	if err := as.rateLimiter.Allow("reset-password:ip:"+ip, 20, time.Hour); err != nil {
+		return err
+	}
+	return as.rateLimiter.Allow("reset-password:email:"+email, 5, 15*time.Minute)
 }
 
-func (as *AuthService) ResetPassword(email, password, token string) error {
-	valid, err := as.verificationTokenManager.ValidateVerificationToken(email, token)
+// VerifyResetToken exchanges the token from a password reset email for a
+// short-lived reset grant, so the emailed link stops working once it has been
+// opened.
+func (as *AuthService) VerifyResetToken(email, token, ip string) (string, error) {
+	email = user.NormalizeEmail(email)
+	if err := as.checkResetAttempt(email, ip); err != nil {
+		return "", err
+	}
+	valid, err := as.verificationTokenManager.ConsumeVerificationToken(email, utils.PurposePasswordReset, token)
+	if err != nil || !valid {
+		return "", errors.New("invalid or expired token")
+	}
+	if err := as.rateLimiter.Reset("reset-password:email:" + email); err != nil {
+		return "", err
+	}
+	grant, err := utils.CreateSecretToken()
+	if err != nil {
+		return "", err
+	}
+	if err := as.verificationTokenManager.SaveVerificationToken(email, utils.PurposePasswordResetGrant, grant); err != nil {
+		return "", err
+	}
+	return grant, nil
+}
+
+// ResetPassword sets a new password with either a reset grant or the token
+// from the reset email, and logs the user out of every session.
+func (as *AuthService) ResetPassword(email, password, token, ip string) error {
+	email = user.NormalizeEmail(email)
+	if err := as.checkResetAttempt(email, ip); err != nil {
+		return err
+	}
+	purpose := utils.PurposePasswordResetGrant
+	valid, err := as.verificationTokenManager.ValidateVerificationToken(email, purpose, token)
+	if err == nil && !valid {
+		purpose = utils.PurposePasswordReset
+		valid, err = as.verificationTokenManager.ValidateVerificationToken(email, purpose, token)
+	}
+	if err != nil || !valid {
+		return errors.New("invalid or expired token")
+	}
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil {
+		return errors.New("invalid email")
+	}
+	// the token is only consumed once the password is accepted, so a rejected
+	// one can be replaced without asking for another reset email
+	if err := as.passwordPolicy.Check(password, u.Email, u.Firstname, u.Lastname); err != nil {
+		return err
+	}
+	valid, err = as.verificationTokenManager.ConsumeVerificationToken(email, purpose, token)
 	if err != nil || !valid {
 		return errors.New("invalid or expired token")
 	}
+	if err := as.rateLimiter.Reset("reset-password:email:" + email); err != nil {
+		return err
+	}
 	passwordHash, err := utils.HashPassword(password)
 	if err != nil {
 		return err
@@ -160,28 +481,38 @@ func (as *AuthService) ResetPassword(email, password, token string) error {
 	if passwordHash == "" {
 		return errors.New("password hash is empty")
 	}
-	tutor, err := as.tutorRepo.GetTutor(bson.M{"user.email": email})
-	if err == nil && tutor != nil {
-		if err := as.tutorRepo.UpdateTutor(bson.M{"user.email": email}, bson.M{"$set": bson.M{"user.password": passwordHash, "user.updated_at": time.Now()}}); err != nil {
-			return err
-		}
-		return nil
-	}
-
-	student, err := as.studentRepo.GetStudent(bson.M{"user.email": email})
-	if err == nil && student != nil {
-		if err := as.studentRepo.UpdateStudent(bson.M{"user.email": email}, bson.M{"$set": bson.M{"user.password": passwordHash, "user.updated_at": time.Now()}}); err != nil {
-			return err
-		}
-		return nil
+	if err := as.userRepo.UpdateUser(bson.M{"_id": u.Id}, bson.M{"$set": bson.M{"password": passwordHash, "updated_at": time.Now()}}); err != nil {
+		return err
 	}
-	return errors.New("invalid email")
+	// whoever knew the old password may still hold a session
+	_, err = as.accessTokenManager.DeleteAccessTokens(bson.M{"user_id": u.Id})
+	return err
 }
 
 type IAuthService interface {
 	Verify(email, token string) error
-	Login(email, password string) (interface{}, *utils.AccessTokenDetails, error)
+	ResendVerification(email, ip string) error
+	Login(email, password string, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, *LoginChallenge, error)
+	RequestMagicLink(email, ip string) error
+	MagicLinkLogin(email, token string, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, *LoginChallenge, error)
+	UnlockAccount(email, token string) error
+	GetLockedAccounts() ([]*utils.LoginAttempts, error)
+	ResetLoginAttempts(email string) error
+	CompleteLogin(email, challengeToken string, req *utils.TwoFactorCodeReq, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, []string, error)
+	EnrollTwoFactorAtLogin(email, challengeToken string) (*TwoFactorEnrollment, error)
+	EnrollTwoFactor(userId primitive.ObjectID) (*TwoFactorEnrollment, error)
+	ConfirmTwoFactor(userId primitive.ObjectID, code string) ([]string, error)
+	DisableTwoFactor(userId primitive.ObjectID, req *utils.TwoFactorCodeReq) error
+	RegenerateRecoveryCodes(userId primitive.ObjectID, req *utils.TwoFactorCodeReq) ([]string, error)
 	Logout(accessUuid string) error
-	ForgotPassword(email string) error
-	ResetPassword(email, password, token string) error
+	RefreshToken(refreshToken string) (*utils.AccessTokenDetails, error)
+	GetSessions(userId primitive.ObjectID, currentAccessUuid string) ([]*utils.SessionRes, error)
+	RevokeSession(userId primitive.ObjectID, sessionId primitive.ObjectID) error
+	RevokeAllSessions(userId primitive.ObjectID) error
+	ForgotPassword(email, ip string) error
+	VerifyResetToken(email, token, ip string) (string, error)
+	ResetPassword(email, password, token, ip string) error
+	ChangePassword(userId primitive.ObjectID, accessUuid, currentPassword, newPassword string) error
+	RequestEmailChange(userId primitive.ObjectID, password, newEmail string) error
+	ConfirmEmailChange(newEmail, token string) error
 }
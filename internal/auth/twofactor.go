@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	totpIssuer        = "Edutech"
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication is required for your role")
+)
+
+// LoginChallenge is returned by Login instead of tokens when the user still
+// has to pass the second factor. EnrollmentRequired is set when their role
+// requires two-factor authentication and they have not enabled it yet. Email
+// identifies the user when completing the challenge, for logins where they did
+// not type it in.
+type LoginChallenge struct {
+	Email              string `json:"email"`
+	ChallengeToken     string `json:"challenge_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+// TwoFactorEnrollment is what an authenticator app needs to add the account,
+// either typed in as the secret or scanned from the URI as a QR code.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"otpauth_uri"`
+}
+
+func (as *AuthService) loginChallenge(u *user.User) (*LoginChallenge, error) {
+	if !u.TwoFactorEnabled() {
+		required, err := as.roleService.TwoFactorRequired(u.GetRoles())
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			return nil, nil
+		}
+	}
+	token, err := utils.CreateSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := as.verificationTokenManager.InvalidateVerificationTokens(u.Email, utils.PurposeLoginChallenge); err != nil {
+		return nil, err
+	}
+	if err := as.verificationTokenManager.SaveVerificationToken(u.Email, utils.PurposeLoginChallenge, token); err != nil {
+		return nil, err
+	}
+	return &LoginChallenge{Email: u.Email, ChallengeToken: token, EnrollmentRequired: !u.TwoFactorEnabled()}, nil
+}
+
+// challengeUser returns the user a login challenge was issued to, without
+// using the challenge up.
+func (as *AuthService) challengeUser(email, challengeToken string) (*user.User, error) {
+	email = user.NormalizeEmail(email)
+	valid, err := as.verificationTokenManager.ValidateVerificationToken(email, utils.PurposeLoginChallenge, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidChallenge
+	}
+	u, err := as.userRepo.GetUser(bson.M{"email": email})
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	return u, nil
+}
+
+// CompleteLogin exchanges a login challenge and a code from the authenticator
+// app, or a recovery code, for an access token. Users who enrolled during
+// login have two-factor authentication enabled here and get their recovery
+// codes.
+func (as *AuthService) CompleteLogin(email, challengeToken string, req *utils.TwoFactorCodeReq, client utils.ClientInfo) (interface{}, *utils.AccessTokenDetails, []string, error) {
+	u, err := as.challengeUser(email, challengeToken)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if u.Suspended {
+		return nil, nil, nil, ErrAccountSuspended
+	}
+	if err := as.checkSecondFactor(u, req); err != nil {
+		return nil, nil, nil, err
+	}
+	valid, err := as.verificationTokenManager.ConsumeVerificationToken(u.Email, utils.PurposeLoginChallenge, challengeToken)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !valid {
+		return nil, nil, nil, ErrInvalidChallenge
+	}
+	var recoveryCodes []string
+	if !u.TwoFactorEnabled() {
+		if recoveryCodes, err = as.enableTwoFactor(u.Id); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	profile, accessTokenDetails, err := as.signIn(u, client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return profile, accessTokenDetails, recoveryCodes, nil
+}
+
+// EnrollTwoFactorAtLogin starts enrollment for a user whose role requires
+// two-factor authentication, using their login challenge in place of an access
+// token. It is refused once two-factor authentication is enabled, so a
+// password alone cannot replace the authenticator.
+func (as *AuthService) EnrollTwoFactorAtLogin(email, challengeToken string) (*TwoFactorEnrollment, error) {
+	u, err := as.challengeUser(email, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return as.startEnrollment(u)
+}
+
+// EnrollTwoFactor starts enrollment for a signed in user. It is completed by
+// ConfirmTwoFactor with a code from the authenticator app.
+func (as *AuthService) EnrollTwoFactor(userId primitive.ObjectID) (*TwoFactorEnrollment, error) {
+	u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return nil, err
+	}
+	return as.startEnrollment(u)
+}
+
+func (as *AuthService) startEnrollment(u *user.User) (*TwoFactorEnrollment, error) {
+	if u.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := utils.CreateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = as.userRepo.UpdateUser(bson.M{"_id": u.Id}, bson.M{"$set": bson.M{
+		"two_factor": &user.TwoFactor{Secret: secret, RecoveryCodes: []string{}},
+		"updated_at": time.Now(),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{Secret: secret, Uri: utils.TOTPURI(totpIssuer, u.Email, secret)}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves
+// their app generates the right codes, and returns the recovery codes. They
+// are only shown this once.
+func (as *AuthService) ConfirmTwoFactor(userId primitive.ObjectID, code string) ([]string, error) {
+	u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return nil, err
+	}
+	if u.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{Code: code}); err != nil {
+		return nil, err
+	}
+	return as.enableTwoFactor(u.Id)
+}
+
+func (as *AuthService) enableTwoFactor(userId primitive.ObjectID) ([]string, error) {
+	codes, hashes, err := utils.CreateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	err = as.userRepo.UpdateUser(bson.M{"_id": userId}, bson.M{"$set": bson.M{
+		"two_factor.enabled":        true,
+		"two_factor.recovery_codes": hashes,
+		"two_factor.enabled_at":     time.Now(),
+		"updated_at":                time.Now(),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off, unless a role of the
+// user requires it.
+func (as *AuthService) DisableTwoFactor(userId primitive.ObjectID, req *utils.TwoFactorCodeReq) error {
+	u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return err
+	}
+	if !u.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+	required, err := as.roleService.TwoFactorRequired(u.GetRoles())
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	if err := as.checkSecondFactor(u, req); err != nil {
+		return err
+	}
+	return as.userRepo.UpdateUser(bson.M{"_id": userId}, bson.M{
+		"$unset": bson.M{"two_factor": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user.
+func (as *AuthService) RegenerateRecoveryCodes(userId primitive.ObjectID, req *utils.TwoFactorCodeReq) ([]string, error) {
+	u, err := as.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		return nil, err
+	}
+	if !u.TwoFactorEnabled() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := as.checkSecondFactor(u, req); err != nil {
+		return nil, err
+	}
+	return as.enableTwoFactor(u.Id)
+}
+
+// checkSecondFactor accepts a current code from the authenticator app that
+// was not used before, or an unused recovery code, which is then used up.
+// Attempts are limited per user so codes cannot be guessed.
+func (as *AuthService) checkSecondFactor(u *user.User, req *utils.TwoFactorCodeReq) error {
+	if u.TwoFactor == nil || u.TwoFactor.Secret == "" {
+		return ErrTwoFactorNotEnabled
+	}
+	limitKey := "2fa:user:" + u.Id.Hex()
+	if err := as.rateLimiter.Allow(limitKey, 5, 15*time.Minute); err != nil {
+		return err
+	}
+	if req.RecoveryCode != "" {
+		if !u.TwoFactor.Enabled {
+			return ErrInvalidTwoFactorCode
+		}
+		// the code is only accepted by the request that removes it, so two
+		// requests with the same code cannot both pass
+		hash := utils.HashRecoveryCode(req.RecoveryCode)
+		used, err := as.userRepo.UpdateUserCount(
+			bson.M{"_id": u.Id, "two_factor.recovery_codes": hash},
+			bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}})
+		if err != nil {
+			return err
+		}
+		if used != 1 {
+			return ErrInvalidTwoFactorCode
+		}
+		return as.rateLimiter.Reset(limitKey)
+	}
+	step, ok := utils.ValidateTOTP(u.TwoFactor.Secret, req.Code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	// likewise only the request that moves last_step past the code's step
+	// gets to use it
+	used, err := as.userRepo.UpdateUserCount(
+		bson.M{"_id": u.Id, "two_factor.last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"two_factor.last_step": step}})
+	if err != nil {
+		return err
+	}
+	if used != 1 {
+		return ErrInvalidTwoFactorCode
+	}
+	return as.rateLimiter.Reset(limitKey)
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// currentCode computes the code an authenticator app shows for secret now.
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// newTwoFactorUser stores a user with two-factor authentication enabled and
+// returns them with their recovery codes.
+func newTwoFactorUser(t *testing.T) (*AuthService, *user.User, []string) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	users := store.Collection(user.Collection)
+	as := &AuthService{
+		userRepo:    user.NewUserRepo(users),
+		rateLimiter: utils.NewRateLimiter(store.Collection("rate_limits")),
+	}
+	secret, err := utils.CreateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := utils.CreateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &user.User{
+		Id:        primitive.NewObjectID(),
+		Email:     "ada@x.io",
+		TwoFactor: &user.TwoFactor{Enabled: true, Secret: secret, RecoveryCodes: hashes},
+	}
+	if _, err := users.InsertOne(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return as, u, codes
+}
+
+func TestCheckSecondFactorRejectsReplayedCode(t *testing.T) {
+	as, u, _ := newTwoFactorUser(t)
+	code := currentCode(t, u.TwoFactor.Secret)
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{Code: code}); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{Code: code}); err != ErrInvalidTwoFactorCode {
+		t.Errorf("second use: got %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{Code: "000000"}); err != ErrInvalidTwoFactorCode {
+		t.Errorf("wrong code: got %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+}
+
+func TestCheckSecondFactorRecoveryCodeWorksOnce(t *testing.T) {
+	as, u, codes := newTwoFactorUser(t)
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{RecoveryCode: codes[0]}); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{RecoveryCode: codes[0]}); err != ErrInvalidTwoFactorCode {
+		t.Errorf("second use: got %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+	if err := as.checkSecondFactor(u, &utils.TwoFactorCodeReq{RecoveryCode: codes[1]}); err != nil {
+		t.Errorf("another code: %v", err)
+	}
+}
+
+// Requests that read the user before any of them used the code must still
+// let only one of them through.
+func TestCheckSecondFactorConcurrentUse(t *testing.T) {
+	tests := []struct {
+		name string
+		req  func(u *user.User, codes []string) *utils.TwoFactorCodeReq
+	}{
+		{"authenticator code", func(u *user.User, _ []string) *utils.TwoFactorCodeReq {
+			return &utils.TwoFactorCodeReq{Code: currentCode(t, u.TwoFactor.Secret)}
+		}},
+		{"recovery code", func(_ *user.User, codes []string) *utils.TwoFactorCodeReq {
+			return &utils.TwoFactorCodeReq{RecoveryCode: codes[0]}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, u, codes := newTwoFactorUser(t)
+			req := tt.req(u, codes)
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			accepted := 0
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := as.checkSecondFactor(u, req); err == nil {
+						mu.Lock()
+						accepted++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if accepted != 1 {
+				t.Errorf("%d requests accepted the code, want 1", accepted)
+			}
+		})
+	}
+}
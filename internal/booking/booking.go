@@ -0,0 +1,218 @@
+package booking
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookingStatus string
+
+const (
+	BookingConfirmed BookingStatus = "confirmed"
+	BookingCancelled BookingStatus = "cancelled"
+)
+
+// Booking is a scheduled lesson between a student and one of their registered
+// tutors. Times are stored in UTC.
+type Booking struct {
+	Id           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	StudentId    primitive.ObjectID  `json:"student_id" bson:"student_id"`
+	TutorId      primitive.ObjectID  `json:"tutor_id" bson:"tutor_id"`
+	SubjectId    primitive.ObjectID  `json:"subject_id" bson:"subject_id"`
+	StartsAt     time.Time           `json:"starts_at" bson:"starts_at"`
+	EndsAt       time.Time           `json:"ends_at" bson:"ends_at"`
+	Status       BookingStatus       `json:"status" bson:"status"`
+	Rescheduled  int                 `json:"rescheduled" bson:"rescheduled"`
+	CancelledBy  *primitive.ObjectID `json:"cancelled_by,omitempty" bson:"cancelled_by,omitempty"`
+	CancelReason string              `json:"cancel_reason,omitempty" bson:"cancel_reason,omitempty"`
+	CancelledAt  *time.Time          `json:"cancelled_at,omitempty" bson:"cancelled_at,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// CalendarFeed is a user's secret iCalendar subscription. Only the hash of the
+// token in the feed URL is stored.
+type CalendarFeed struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserId    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role      user.Role          `json:"role" bson:"role"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Availability is a tutor's recurring weekly schedule plus date specific
+// exceptions, expressed in the tutor's own timezone.
+type Availability struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TutorId    primitive.ObjectID `json:"tutor_id" bson:"tutor_id"`
+	Timezone   string             `json:"timezone" bson:"timezone"`
+	Weekly     []WeeklySlot       `json:"weekly" bson:"weekly"`
+	Exceptions []Exception        `json:"exceptions" bson:"exceptions"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// WeeklySlot is a recurring window, e.g. every Monday (1) from "09:00" to "12:00".
+type WeeklySlot struct {
+	Weekday time.Weekday `json:"weekday" bson:"weekday"`
+	Start   string       `json:"start" bson:"start"`
+	End     string       `json:"end" bson:"end"`
+}
+
+// Exception replaces the weekly schedule on one date ("2006-01-02"). An
+// exception with no slots marks the tutor unavailable for the whole day.
+type Exception struct {
+	Date  string      `json:"date" bson:"date"`
+	Slots []TimeRange `json:"slots" bson:"slots"`
+}
+
+type TimeRange struct {
+	Start string `json:"start" bson:"start"`
+	End   string `json:"end" bson:"end"`
+}
+
+// Window is a concrete period of time in UTC.
+type Window struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+const clockLayout = "15:04"
+const dateLayout = "2006-01-02"
+
+func parseRange(start, end string) (time.Duration, time.Duration, error) {
+	s, err := time.Parse(clockLayout, start)
+	if err != nil {
+		return 0, 0, errors.New("invalid time " + start + ": use HH:MM")
+	}
+	e, err := time.Parse(clockLayout, end)
+	if err != nil {
+		return 0, 0, errors.New("invalid time " + end + ": use HH:MM")
+	}
+	if !e.After(s) {
+		return 0, 0, errors.New("slot end must be after its start")
+	}
+	return time.Duration(s.Hour())*time.Hour + time.Duration(s.Minute())*time.Minute,
+		time.Duration(e.Hour())*time.Hour + time.Duration(e.Minute())*time.Minute, nil
+}
+
+func (a *Availability) Validate() error {
+	if _, err := time.LoadLocation(a.Timezone); err != nil {
+		return errors.New("invalid timezone")
+	}
+	for _, slot := range a.Weekly {
+		if slot.Weekday < time.Sunday || slot.Weekday > time.Saturday {
+			return errors.New("weekday must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		if _, _, err := parseRange(slot.Start, slot.End); err != nil {
+			return err
+		}
+	}
+	seen := map[string]bool{}
+	for _, exception := range a.Exceptions {
+		if _, err := time.Parse(dateLayout, exception.Date); err != nil {
+			return errors.New("invalid exception date " + exception.Date + ": use YYYY-MM-DD")
+		}
+		if seen[exception.Date] {
+			return errors.New("duplicate exception for " + exception.Date)
+		}
+		seen[exception.Date] = true
+		for _, slot := range exception.Slots {
+			if _, _, err := parseRange(slot.Start, slot.End); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Windows expands the schedule into the UTC windows that fall between from and
+// to. Touching or overlapping windows are merged.
+func (a *Availability) Windows(from, to time.Time) ([]Window, error) {
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	exceptions := map[string]Exception{}
+	for _, exception := range a.Exceptions {
+		exceptions[exception.Date] = exception
+	}
+	windows := []Window{}
+	first := from.In(loc)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		ranges := []TimeRange{}
+		if exception, ok := exceptions[day.Format(dateLayout)]; ok {
+			ranges = exception.Slots
+		} else {
+			for _, slot := range a.Weekly {
+				if slot.Weekday == day.Weekday() {
+					ranges = append(ranges, TimeRange{Start: slot.Start, End: slot.End})
+				}
+			}
+		}
+		for _, r := range ranges {
+			start, end, err := parseRange(r.Start, r.End)
+			if err != nil {
+				return nil, err
+			}
+			w := Window{StartsAt: wallClock(day, start), EndsAt: wallClock(day, end)}
+			if w.StartsAt.Before(from) {
+				w.StartsAt = from.UTC()
+			}
+			if w.EndsAt.After(to) {
+				w.EndsAt = to.UTC()
+			}
+			if w.EndsAt.After(w.StartsAt) {
+				windows = append(windows, w)
+			}
+		}
+	}
+	return mergeWindows(windows), nil
+}
+
+// wallClock returns the UTC instant of a time of day on the given local date,
+// keeping the wall clock time correct across daylight saving changes.
+func wallClock(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, day.Location()).UTC()
+}
+
+func mergeWindows(windows []Window) []Window {
+	sort.Slice(windows, func(i, j int) bool { return windows[i].StartsAt.Before(windows[j].StartsAt) })
+	merged := []Window{}
+	for _, w := range windows {
+		if n := len(merged); n > 0 && !w.StartsAt.After(merged[n-1].EndsAt) {
+			if w.EndsAt.After(merged[n-1].EndsAt) {
+				merged[n-1].EndsAt = w.EndsAt
+			}
+			continue
+		}
+		merged = append(merged, w)
+	}
+	return merged
+}
+
+// subtractWindows removes the busy periods from the free windows.
+func subtractWindows(free []Window, busy []Window) []Window {
+	result := free
+	for _, b := range busy {
+		next := []Window{}
+		for _, f := range result {
+			if !b.StartsAt.Before(f.EndsAt) || !b.EndsAt.After(f.StartsAt) {
+				next = append(next, f)
+				continue
+			}
+			if b.StartsAt.After(f.StartsAt) {
+				next = append(next, Window{StartsAt: f.StartsAt, EndsAt: b.StartsAt})
+			}
+			if b.EndsAt.Before(f.EndsAt) {
+				next = append(next, Window{StartsAt: b.EndsAt, EndsAt: f.EndsAt})
+			}
+		}
+		result = next
+	}
+	return result
+}
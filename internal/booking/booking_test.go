@@ -0,0 +1,205 @@
+package booking
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func utc(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestAvailabilityWindows(t *testing.T) {
+	tests := []struct {
+		name         string
+		availability Availability
+		from, to     time.Time
+		want         []Window
+	}{
+		{
+			name: "weekly slots",
+			availability: Availability{Timezone: "UTC", Weekly: []WeeklySlot{
+				{Weekday: time.Monday, Start: "09:00", End: "12:00"},
+				{Weekday: time.Wednesday, Start: "14:00", End: "16:00"},
+			}},
+			// Monday 6 May to Thursday 9 May 2024
+			from: utc(2024, 5, 6, 0, 0), to: utc(2024, 5, 9, 0, 0),
+			want: []Window{
+				{StartsAt: utc(2024, 5, 6, 9, 0), EndsAt: utc(2024, 5, 6, 12, 0)},
+				{StartsAt: utc(2024, 5, 8, 14, 0), EndsAt: utc(2024, 5, 8, 16, 0)},
+			},
+		},
+		{
+			name: "back to back slots are merged",
+			availability: Availability{Timezone: "UTC", Weekly: []WeeklySlot{
+				{Weekday: time.Monday, Start: "10:00", End: "11:00"},
+				{Weekday: time.Monday, Start: "09:00", End: "10:00"},
+				{Weekday: time.Monday, Start: "10:30", End: "12:00"},
+			}},
+			from: utc(2024, 5, 6, 0, 0), to: utc(2024, 5, 7, 0, 0),
+			want: []Window{{StartsAt: utc(2024, 5, 6, 9, 0), EndsAt: utc(2024, 5, 6, 12, 0)}},
+		},
+		{
+			name: "windows are clipped to the range",
+			availability: Availability{Timezone: "UTC", Weekly: []WeeklySlot{
+				{Weekday: time.Monday, Start: "09:00", End: "12:00"},
+			}},
+			from: utc(2024, 5, 6, 10, 0), to: utc(2024, 5, 6, 11, 0),
+			want: []Window{{StartsAt: utc(2024, 5, 6, 10, 0), EndsAt: utc(2024, 5, 6, 11, 0)}},
+		},
+		{
+			name: "exception replaces the weekly slots of its date",
+			availability: Availability{Timezone: "UTC",
+				Weekly: []WeeklySlot{
+					{Weekday: time.Monday, Start: "09:00", End: "12:00"},
+				},
+				Exceptions: []Exception{
+					{Date: "2024-05-06", Slots: []TimeRange{{Start: "15:00", End: "16:00"}}},
+					{Date: "2024-05-13", Slots: []TimeRange{}},
+				},
+			},
+			from: utc(2024, 5, 6, 0, 0), to: utc(2024, 5, 21, 0, 0),
+			want: []Window{
+				{StartsAt: utc(2024, 5, 6, 15, 0), EndsAt: utc(2024, 5, 6, 16, 0)},
+				{StartsAt: utc(2024, 5, 20, 9, 0), EndsAt: utc(2024, 5, 20, 12, 0)},
+			},
+		},
+		{
+			name: "tutor timezone ahead of UTC",
+			availability: Availability{Timezone: "Africa/Lagos", Weekly: []WeeklySlot{
+				{Weekday: time.Monday, Start: "00:30", End: "02:00"},
+			}},
+			// Monday 00:30 in Lagos is still Sunday in UTC
+			from: utc(2024, 5, 5, 0, 0), to: utc(2024, 5, 7, 0, 0),
+			want: []Window{{StartsAt: utc(2024, 5, 5, 23, 30), EndsAt: utc(2024, 5, 6, 1, 0)}},
+		},
+		{
+			name: "clocks go forward",
+			availability: Availability{Timezone: "America/New_York", Weekly: []WeeklySlot{
+				{Weekday: time.Saturday, Start: "09:00", End: "10:00"},
+				{Weekday: time.Sunday, Start: "09:00", End: "10:00"},
+			}},
+			// New York moved from UTC-5 to UTC-4 on Sunday 10 March 2024
+			from: utc(2024, 3, 9, 0, 0), to: utc(2024, 3, 11, 0, 0),
+			want: []Window{
+				{StartsAt: utc(2024, 3, 9, 14, 0), EndsAt: utc(2024, 3, 9, 15, 0)},
+				{StartsAt: utc(2024, 3, 10, 13, 0), EndsAt: utc(2024, 3, 10, 14, 0)},
+			},
+		},
+		{
+			name: "slot across the skipped hour is shorter",
+			availability: Availability{Timezone: "America/New_York", Weekly: []WeeklySlot{
+				{Weekday: time.Sunday, Start: "01:00", End: "04:00"},
+			}},
+			// 01:00 is still UTC-5, 04:00 already UTC-4: two hours, not three
+			from: utc(2024, 3, 10, 0, 0), to: utc(2024, 3, 11, 0, 0),
+			want: []Window{{StartsAt: utc(2024, 3, 10, 6, 0), EndsAt: utc(2024, 3, 10, 8, 0)}},
+		},
+		{
+			name: "clocks go back",
+			availability: Availability{Timezone: "Europe/London", Weekly: []WeeklySlot{
+				{Weekday: time.Saturday, Start: "09:00", End: "10:00"},
+				{Weekday: time.Sunday, Start: "09:00", End: "10:00"},
+			}},
+			// London moved from UTC+1 to UTC on Sunday 27 October 2024
+			from: utc(2024, 10, 26, 0, 0), to: utc(2024, 10, 28, 0, 0),
+			want: []Window{
+				{StartsAt: utc(2024, 10, 26, 8, 0), EndsAt: utc(2024, 10, 26, 9, 0)},
+				{StartsAt: utc(2024, 10, 27, 9, 0), EndsAt: utc(2024, 10, 27, 10, 0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.availability.Windows(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtractWindows(t *testing.T) {
+	free := []Window{
+		{StartsAt: utc(2024, 5, 6, 9, 0), EndsAt: utc(2024, 5, 6, 12, 0)},
+		{StartsAt: utc(2024, 5, 6, 14, 0), EndsAt: utc(2024, 5, 6, 16, 0)},
+	}
+	tests := []struct {
+		name string
+		busy []Window
+		want []Window
+	}{
+		{
+			name: "nothing booked",
+			busy: []Window{},
+			want: free,
+		},
+		{
+			name: "booking in the middle splits the window",
+			busy: []Window{{StartsAt: utc(2024, 5, 6, 10, 0), EndsAt: utc(2024, 5, 6, 11, 0)}},
+			want: []Window{
+				{StartsAt: utc(2024, 5, 6, 9, 0), EndsAt: utc(2024, 5, 6, 10, 0)},
+				{StartsAt: utc(2024, 5, 6, 11, 0), EndsAt: utc(2024, 5, 6, 12, 0)},
+				{StartsAt: utc(2024, 5, 6, 14, 0), EndsAt: utc(2024, 5, 6, 16, 0)},
+			},
+		},
+		{
+			name: "back to back bookings fill the window",
+			busy: []Window{
+				{StartsAt: utc(2024, 5, 6, 9, 0), EndsAt: utc(2024, 5, 6, 10, 30)},
+				{StartsAt: utc(2024, 5, 6, 10, 30), EndsAt: utc(2024, 5, 6, 12, 0)},
+			},
+			want: []Window{{StartsAt: utc(2024, 5, 6, 14, 0), EndsAt: utc(2024, 5, 6, 16, 0)}},
+		},
+		{
+			name: "bookings touching a window leave it whole",
+			busy: []Window{
+				{StartsAt: utc(2024, 5, 6, 8, 0), EndsAt: utc(2024, 5, 6, 9, 0)},
+				{StartsAt: utc(2024, 5, 6, 12, 0), EndsAt: utc(2024, 5, 6, 14, 0)},
+			},
+			want: free,
+		},
+		{
+			name: "booking across two windows trims both",
+			busy: []Window{{StartsAt: utc(2024, 5, 6, 11, 0), EndsAt: utc(2024, 5, 6, 15, 0)}},
+			want: []Window{
+				{StartsAt: utc(2024, 5, 6, 9, 0), EndsAt: utc(2024, 5, 6, 11, 0)},
+				{StartsAt: utc(2024, 5, 6, 15, 0), EndsAt: utc(2024, 5, 6, 16, 0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subtractWindows(free, tt.busy); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvailabilityValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		availability Availability
+		wantErr      bool
+	}{
+		{"valid", Availability{Timezone: "Europe/London", Weekly: []WeeklySlot{{Weekday: time.Monday, Start: "09:00", End: "12:00"}}}, false},
+		{"unknown timezone", Availability{Timezone: "Mars/Olympus"}, true},
+		{"weekday out of range", Availability{Timezone: "UTC", Weekly: []WeeklySlot{{Weekday: 7, Start: "09:00", End: "12:00"}}}, true},
+		{"end before start", Availability{Timezone: "UTC", Weekly: []WeeklySlot{{Weekday: time.Monday, Start: "12:00", End: "09:00"}}}, true},
+		{"empty slot", Availability{Timezone: "UTC", Weekly: []WeeklySlot{{Weekday: time.Monday, Start: "09:00", End: "09:00"}}}, true},
+		{"bad exception date", Availability{Timezone: "UTC", Exceptions: []Exception{{Date: "06/05/2024"}}}, true},
+		{"duplicate exception", Availability{Timezone: "UTC", Exceptions: []Exception{{Date: "2024-05-06"}, {Date: "2024-05-06"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.availability.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
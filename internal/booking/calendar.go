@@ -0,0 +1,162 @@
+package booking
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/student"
+	"github.com/ayo-ajayi/edutech/internal/subject"
+	"github.com/ayo-ajayi/edutech/internal/tutor"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+const (
+	// feedHistory is how far back a feed keeps past lessons.
+	feedHistory  = 90 * 24 * time.Hour
+	feedMaxItems = 500
+)
+
+type CalendarService struct {
+	calendarFeedRepo ICalendarFeedRepo
+	bookingRepo      IBookingRepo
+	availabilityRepo IAvailabilityRepo
+	studentRepo      student.IBookingStudentRepo
+	tutorRepo        tutor.IBookingTutorRepo
+	subjectRepo      subject.IBookingSubjectRepo
+	feedBaseUrl      string
+}
+
+func NewCalendarService(calendarFeedRepo ICalendarFeedRepo, bookingRepo IBookingRepo, availabilityRepo IAvailabilityRepo, studentRepo student.IBookingStudentRepo, tutorRepo tutor.IBookingTutorRepo, subjectRepo subject.IBookingSubjectRepo, feedBaseUrl string) *CalendarService {
+	return &CalendarService{calendarFeedRepo: calendarFeedRepo, bookingRepo: bookingRepo, availabilityRepo: availabilityRepo, studentRepo: studentRepo, tutorRepo: tutorRepo, subjectRepo: subjectRepo, feedBaseUrl: feedBaseUrl}
+}
+
+// CreateCalendarFeed issues a new secret feed URL for the user. Any previous
+// URL stops working.
+func (cs *CalendarService) CreateCalendarFeed(userId primitive.ObjectID, role user.Role) (string, error) {
+	token, err := utils.CreateSecretToken()
+	if err != nil {
+		return "", err
+	}
+	err = cs.calendarFeedRepo.SaveCalendarFeed(bson.M{"user_id": userId}, bson.M{"$set": bson.M{
+		"role":       role,
+		"token_hash": utils.HashSecretToken(token),
+		"created_at": time.Now(),
+	}})
+	if err != nil {
+		return "", err
+	}
+	return cs.feedBaseUrl + "/calendar/" + token + ".ics", nil
+}
+
+func (cs *CalendarService) DeleteCalendarFeed(userId primitive.ObjectID) error {
+	return cs.calendarFeedRepo.DeleteCalendarFeed(bson.M{"user_id": userId})
+}
+
+// GetCalendarFeed renders the lessons of the feed's owner, including recently
+// cancelled ones so subscribed calendars remove them.
+func (cs *CalendarService) GetCalendarFeed(token string) ([]byte, error) {
+	feed, err := cs.calendarFeedRepo.GetCalendarFeed(bson.M{"token_hash": utils.HashSecretToken(token)})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCalendarFeedNotFound
+		}
+		return nil, err
+	}
+	filter := bson.M{"student_id": feed.UserId, "ends_at": bson.M{"$gte": time.Now().Add(-feedHistory)}}
+	if feed.Role == user.Tutor {
+		filter = bson.M{"tutor_id": feed.UserId, "ends_at": bson.M{"$gte": time.Now().Add(-feedHistory)}}
+	}
+	bookings, err := cs.bookingRepo.GetBookings(filter, options.Find().SetSort(bson.D{{Key: "starts_at", Value: 1}}).SetLimit(feedMaxItems))
+	if err != nil {
+		return nil, err
+	}
+	events, err := cs.calendarEvents(bookings, feed.Role)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeCalendar(CalendarPublish, "Edutech lessons", events), nil
+}
+
+// GetBookingCalendar renders a single booking as an invitation, or as a
+// cancellation once the booking has been cancelled.
+func (cs *CalendarService) GetBookingCalendar(userId primitive.ObjectID, role user.Role, bookingId primitive.ObjectID) ([]byte, error) {
+	filter := bson.M{"_id": bookingId, "student_id": userId}
+	if role == user.Tutor {
+		filter = bson.M{"_id": bookingId, "tutor_id": userId}
+	}
+	booking, err := cs.bookingRepo.GetBooking(filter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrBookingNotFound
+		}
+		return nil, err
+	}
+	events, err := cs.calendarEvents([]*Booking{booking}, role)
+	if err != nil {
+		return nil, err
+	}
+	method := CalendarRequest
+	if booking.Status == BookingCancelled {
+		method = CalendarCancel
+	}
+	return EncodeCalendar(method, "", events), nil
+}
+
+// calendarEvents looks up the people, subject and timezone of each booking.
+// The tutor is the organizer and the student the attendee.
+func (cs *CalendarService) calendarEvents(bookings []*Booking, viewer user.Role) ([]*CalendarEvent, error) {
+	students := map[primitive.ObjectID]*user.User{}
+	tutors := map[primitive.ObjectID]*user.User{}
+	subjects := map[primitive.ObjectID]string{}
+	timezones := map[primitive.ObjectID]string{}
+	events := []*CalendarEvent{}
+	for _, b := range bookings {
+		if _, ok := students[b.StudentId]; !ok {
+			s, err := cs.studentRepo.GetStudent(bson.M{"_id": b.StudentId})
+			if err != nil {
+				return nil, err
+			}
+			students[b.StudentId] = s.User
+		}
+		if _, ok := tutors[b.TutorId]; !ok {
+			t, err := cs.tutorRepo.GetTutor(bson.M{"_id": b.TutorId})
+			if err != nil {
+				return nil, err
+			}
+			tutors[b.TutorId] = t.User
+			timezones[b.TutorId] = "UTC"
+			if availability, err := cs.availabilityRepo.GetAvailability(bson.M{"tutor_id": b.TutorId}); err == nil {
+				timezones[b.TutorId] = availability.Timezone
+			}
+		}
+		if _, ok := subjects[b.SubjectId]; !ok {
+			subjects[b.SubjectId] = "Tutoring"
+			if sub, err := cs.subjectRepo.GetSubject(bson.M{"_id": b.SubjectId}); err == nil {
+				subjects[b.SubjectId] = sub.Name
+			}
+		}
+		events = append(events, &CalendarEvent{
+			Booking:     b,
+			SubjectName: subjects[b.SubjectId],
+			Timezone:    timezones[b.TutorId],
+			Organizer:   tutors[b.TutorId],
+			Attendee:    students[b.StudentId],
+			Viewer:      viewer,
+		})
+	}
+	return events, nil
+}
+
+type ICalendarService interface {
+	CreateCalendarFeed(userId primitive.ObjectID, role user.Role) (string, error)
+	DeleteCalendarFeed(userId primitive.ObjectID) error
+	GetCalendarFeed(token string) ([]byte, error)
+	GetBookingCalendar(userId primitive.ObjectID, role user.Role, bookingId primitive.ObjectID) ([]byte, error)
+}
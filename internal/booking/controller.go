@@ -0,0 +1,291 @@
+package booking
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookingController struct {
+	bookingService IBookingService
+}
+
+func NewBookingController(bookingService IBookingService) *BookingController {
+	return &BookingController{bookingService: bookingService}
+}
+
+func bookingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrBookingNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, ErrBookingConflict), errors.Is(err, utils.ErrLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, ErrPastCutoff):
+		c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error()}})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+	}
+}
+
+func (bc *BookingController) SaveAvailability(c *gin.Context) {
+	req := struct {
+		Timezone   string       `json:"timezone" binding:"required"`
+		Weekly     []WeeklySlot `json:"weekly"`
+		Exceptions []Exception  `json:"exceptions"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	tutorId := c.MustGet("user_id").(primitive.ObjectID)
+	availability, err := bc.bookingService.SaveAvailability(tutorId, &Availability{
+		TutorId:    tutorId,
+		Timezone:   req.Timezone,
+		Weekly:     req.Weekly,
+		Exceptions: req.Exceptions,
+	})
+	if err != nil {
+		bookingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(availability, "availability saved successfully"))
+}
+
+func (bc *BookingController) GetMyAvailability(c *gin.Context) {
+	tutorId := c.MustGet("user_id").(primitive.ObjectID)
+	availability, err := bc.bookingService.GetAvailability(tutorId)
+	if err != nil {
+		bookingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(availability, "availability retrieved successfully"))
+}
+
+// GetOpenSlots lists a tutor's bookable windows. from defaults to now and days
+// to 7.
+func (bc *BookingController) GetOpenSlots(c *gin.Context) {
+	tutorId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid tutor id"}})
+		return
+	}
+	from := time.Now()
+	if f := c.Query("from"); f != "" {
+		from, err = time.Parse(time.RFC3339, f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid from: use RFC 3339"}})
+			return
+		}
+	}
+	days := 7
+	if d := c.Query("days"); d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid days"}})
+			return
+		}
+	}
+	slots, err := bc.bookingService.GetOpenSlots(tutorId, from, from.AddDate(0, 0, days))
+	if err != nil {
+		bookingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(slots, "open slots retrieved successfully"))
+}
+
+func (bc *BookingController) CreateBooking(c *gin.Context) {
+	req := struct {
+		TutorId   string    `json:"tutor_id" binding:"required"`
+		SubjectId string    `json:"subject_id" binding:"required"`
+		StartsAt  time.Time `json:"starts_at" binding:"required"`
+		Minutes   int       `json:"duration_minutes" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	tutorId, err := primitive.ObjectIDFromHex(req.TutorId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid tutor id"}})
+		return
+	}
+	subjectId, err := primitive.ObjectIDFromHex(req.SubjectId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid subject id"}})
+		return
+	}
+	booking := &Booking{
+		StudentId: c.MustGet("user_id").(primitive.ObjectID),
+		TutorId:   tutorId,
+		SubjectId: subjectId,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.StartsAt.Add(time.Duration(req.Minutes) * time.Minute),
+	}
+	if err := bc.bookingService.CreateBooking(booking); err != nil {
+		bookingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(booking, "booking created successfully"))
+}
+
+func (bc *BookingController) getBookings(c *gin.Context, role user.Role) {
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	status := BookingStatus(c.Query("status"))
+	if status != "" && status != BookingConfirmed && status != BookingCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid status"}})
+		return
+	}
+	upcoming := c.Query("upcoming") == "true"
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	bookings, err := bc.bookingService.GetBookings(userId, role, status, upcoming, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"bookings": bookings,
+		"page":     req.Page,
+		"limit":    req.Limit,
+	}, "bookings retrieved successfully"))
+}
+
+func (bc *BookingController) GetStudentBookings(c *gin.Context) {
+	bc.getBookings(c, user.Student)
+}
+
+func (bc *BookingController) GetTutorBookings(c *gin.Context) {
+	bc.getBookings(c, user.Tutor)
+}
+
+func (bc *BookingController) RescheduleBooking(c *gin.Context) {
+	bookingId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid booking id"}})
+		return
+	}
+	req := struct {
+		StartsAt time.Time `json:"starts_at" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	booking, err := bc.bookingService.RescheduleBooking(userId, bookingId, req.StartsAt)
+	if err != nil {
+		bookingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(booking, "booking rescheduled successfully"))
+}
+
+func (bc *BookingController) CancelBooking(c *gin.Context) {
+	bookingId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid booking id"}})
+		return
+	}
+	req := struct {
+		Reason string `json:"reason"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	booking, err := bc.bookingService.CancelBooking(userId, bookingId, req.Reason)
+	if err != nil {
+		bookingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(booking, "booking cancelled successfully"))
+}
+
+type CalendarController struct {
+	calendarService ICalendarService
+}
+
+func NewCalendarController(calendarService ICalendarService) *CalendarController {
+	return &CalendarController{calendarService: calendarService}
+}
+
+func calendarResponse(c *gin.Context, filename string, data []byte) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+func (cc *CalendarController) createCalendarFeed(c *gin.Context, role user.Role) {
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	feedUrl, err := cc.calendarService.CreateCalendarFeed(userId, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{"url": feedUrl}, "calendar feed created successfully"))
+}
+
+func (cc *CalendarController) CreateStudentCalendarFeed(c *gin.Context) {
+	cc.createCalendarFeed(c, user.Student)
+}
+
+func (cc *CalendarController) CreateTutorCalendarFeed(c *gin.Context) {
+	cc.createCalendarFeed(c, user.Tutor)
+}
+
+func (cc *CalendarController) DeleteCalendarFeed(c *gin.Context) {
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := cc.calendarService.DeleteCalendarFeed(userId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "calendar feed deleted successfully"))
+}
+
+func (cc *CalendarController) GetCalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	data, err := cc.calendarService.GetCalendarFeed(token)
+	if err != nil {
+		if errors.Is(err, ErrCalendarFeedNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	calendarResponse(c, "edutech.ics", data)
+}
+
+func (cc *CalendarController) getBookingCalendar(c *gin.Context, role user.Role) {
+	bookingId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid booking id"}})
+		return
+	}
+	userId := c.MustGet("user_id").(primitive.ObjectID)
+	data, err := cc.calendarService.GetBookingCalendar(userId, role, bookingId)
+	if err != nil {
+		bookingError(c, err)
+		return
+	}
+	calendarResponse(c, "booking-"+bookingId.Hex()+".ics", data)
+}
+
+func (cc *CalendarController) GetStudentBookingCalendar(c *gin.Context) {
+	cc.getBookingCalendar(c, user.Student)
+}
+
+func (cc *CalendarController) GetTutorBookingCalendar(c *gin.Context) {
+	cc.getBookingCalendar(c, user.Tutor)
+}
@@ -0,0 +1,217 @@
+package booking
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+)
+
+// iCalendar (RFC 5545) output for bookings.
+
+const (
+	CalendarPublish = "PUBLISH"
+	CalendarRequest = "REQUEST"
+	CalendarCancel  = "CANCEL"
+)
+
+const (
+	icalDateTime     = "20060102T150405"
+	icalDateTimeUTC  = "20060102T150405Z"
+	icalLineLimit    = 75
+	icalProductId    = "-//edutech//bookings//EN"
+	icalUidDomain    = "edutech"
+	timezoneScanStep = 24 * time.Hour
+)
+
+// CalendarEvent is a booking together with the people and subject needed to
+// describe it.
+type CalendarEvent struct {
+	Booking     *Booking
+	SubjectName string
+	Timezone    string
+	Organizer   *user.User
+	Attendee    *user.User
+	// Viewer is the role of the user the calendar is generated for and decides
+	// whose name goes into the summary.
+	Viewer user.Role
+}
+
+type icalWriter struct {
+	b strings.Builder
+}
+
+// line writes a content line, folding it at 75 octets without splitting UTF-8
+// sequences.
+func (w *icalWriter) line(name, value string) {
+	l := name + ":" + value
+	for len(l) > icalLineLimit {
+		cut := icalLineLimit
+		for cut > 0 && l[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(l[:cut] + "\r\n")
+		l = " " + l[cut:]
+	}
+	w.b.WriteString(l + "\r\n")
+}
+
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func icalParam(s string) string {
+	return `"` + strings.NewReplacer(`"`, "", "\r", "", "\n", " ").Replace(s) + `"`
+}
+
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	hh, mm := seconds/3600, seconds%3600/60
+	return sign + pad2(hh) + pad2(mm)
+}
+
+func pad2(n int) string {
+	if n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+func fullName(u *user.User) string {
+	return strings.TrimSpace(u.Firstname + " " + u.Lastname)
+}
+
+// writeTimezone writes a VTIMEZONE covering from to to. Offset changes are
+// found by scanning the zone database, so any IANA zone is supported.
+func (w *icalWriter) writeTimezone(loc *time.Location, from, to time.Time) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", loc.String())
+	component := func(at time.Time, offsetFrom int) {
+		name, offset := at.In(loc).Zone()
+		kind := "STANDARD"
+		if at.In(loc).IsDST() {
+			kind = "DAYLIGHT"
+		}
+		w.line("BEGIN", kind)
+		// DTSTART of an observance is local time in the offset being left
+		w.line("DTSTART", at.In(time.FixedZone("", offsetFrom)).Format(icalDateTime))
+		w.line("TZOFFSETFROM", icalOffset(offsetFrom))
+		w.line("TZOFFSETTO", icalOffset(offset))
+		w.line("TZNAME", icalText(name))
+		w.line("END", kind)
+	}
+	_, offset := from.In(loc).Zone()
+	component(from, offset)
+	for t := from; t.Before(to); t = t.Add(timezoneScanStep) {
+		next := t.Add(timezoneScanStep)
+		_, before := t.In(loc).Zone()
+		if _, after := next.In(loc).Zone(); before == after {
+			continue
+		}
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		component(hi.Truncate(time.Second), before)
+	}
+	w.line("END", "VTIMEZONE")
+}
+
+func (w *icalWriter) writeEvent(event *CalendarEvent, stamp time.Time) {
+	b := event.Booking
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", b.Id.Hex()+"@"+icalUidDomain)
+	w.line("DTSTAMP", stamp.UTC().Format(icalDateTimeUTC))
+	if loc, err := time.LoadLocation(event.Timezone); err == nil && loc != time.UTC {
+		w.line("DTSTART;TZID="+loc.String(), b.StartsAt.In(loc).Format(icalDateTime))
+		w.line("DTEND;TZID="+loc.String(), b.EndsAt.In(loc).Format(icalDateTime))
+	} else {
+		w.line("DTSTART", b.StartsAt.UTC().Format(icalDateTimeUTC))
+		w.line("DTEND", b.EndsAt.UTC().Format(icalDateTimeUTC))
+	}
+	// every reschedule and the cancellation are new revisions of the event
+	sequence := b.Rescheduled
+	if b.Status == BookingCancelled {
+		sequence++
+	}
+	w.line("SEQUENCE", strconv.Itoa(sequence))
+	with := event.Organizer
+	if event.Viewer == user.Tutor {
+		with = event.Attendee
+	}
+	w.line("SUMMARY", icalText(event.SubjectName+" lesson with "+fullName(with)))
+	if b.Status == BookingCancelled {
+		w.line("STATUS", "CANCELLED")
+		if b.CancelReason != "" {
+			w.line("DESCRIPTION", icalText("Cancelled: "+b.CancelReason))
+		}
+	} else {
+		w.line("STATUS", "CONFIRMED")
+	}
+	w.line("ORGANIZER;CN="+icalParam(fullName(event.Organizer)), "mailto:"+event.Organizer.Email)
+	// the attendee accepted by booking; a cancellation by either party is told
+	// by STATUS and SEQUENCE, not by the attendee declining (RFC 5546 3.2.5)
+	w.line("ATTENDEE;CN="+icalParam(fullName(event.Attendee))+";ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED", "mailto:"+event.Attendee.Email)
+	w.line("CREATED", b.CreatedAt.UTC().Format(icalDateTimeUTC))
+	w.line("LAST-MODIFIED", b.UpdatedAt.UTC().Format(icalDateTimeUTC))
+	w.line("END", "VEVENT")
+}
+
+// EncodeCalendar renders the events as an iCalendar object. name, when set, is
+// the display name calendar apps use for subscribed feeds.
+func EncodeCalendar(method, name string, events []*CalendarEvent) []byte {
+	w := &icalWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", icalProductId)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", method)
+	if name != "" {
+		w.line("X-WR-CALNAME", icalText(name))
+	}
+
+	type span struct {
+		loc      *time.Location
+		from, to time.Time
+	}
+	zones := []*span{}
+	byName := map[string]*span{}
+	for _, event := range events {
+		loc, err := time.LoadLocation(event.Timezone)
+		if err != nil || loc == time.UTC {
+			continue
+		}
+		z, ok := byName[loc.String()]
+		if !ok {
+			z = &span{loc: loc, from: event.Booking.StartsAt, to: event.Booking.EndsAt}
+			byName[loc.String()] = z
+			zones = append(zones, z)
+		}
+		if event.Booking.StartsAt.Before(z.from) {
+			z.from = event.Booking.StartsAt
+		}
+		if event.Booking.EndsAt.After(z.to) {
+			z.to = event.Booking.EndsAt
+		}
+	}
+	for _, z := range zones {
+		w.writeTimezone(z.loc, z.from.AddDate(0, 0, -1), z.to.AddDate(0, 0, 1))
+	}
+
+	stamp := time.Now()
+	for _, event := range events {
+		w.writeEvent(event, stamp)
+	}
+	w.line("END", "VCALENDAR")
+	return []byte(w.b.String())
+}
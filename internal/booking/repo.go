@@ -0,0 +1,161 @@
+package booking
+
+import (
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BookingRepo struct {
+	db db.IDatabase
+}
+
+func NewBookingRepo(db db.IDatabase) *BookingRepo {
+	return &BookingRepo{db: db}
+}
+
+func (br *BookingRepo) CreateBooking(booking *Booking) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := br.db.InsertOne(ctx, booking)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (br *BookingRepo) BookingExists(filter interface{}) (bool, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	err := br.db.FindOne(ctx, filter).Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (br *BookingRepo) UpdateBooking(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := br.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (br *BookingRepo) GetBooking(filter interface{}) (*Booking, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var booking Booking
+	err := br.db.FindOne(ctx, filter).Decode(&booking)
+	if err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func (br *BookingRepo) GetBookings(filter interface{}, opts ...*options.FindOptions) ([]*Booking, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	bookings := []*Booking{}
+	cursor, err := br.db.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &bookings)
+	if err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+type IBookingRepo interface {
+	CreateBooking(booking *Booking) error
+	BookingExists(filter interface{}) (bool, error)
+	UpdateBooking(filter interface{}, update interface{}) error
+	GetBooking(filter interface{}) (*Booking, error)
+	GetBookings(filter interface{}, opts ...*options.FindOptions) ([]*Booking, error)
+}
+
+type AvailabilityRepo struct {
+	db db.IDatabase
+}
+
+func NewAvailabilityRepo(db db.IDatabase) *AvailabilityRepo {
+	return &AvailabilityRepo{db: db}
+}
+
+func (ar *AvailabilityRepo) SaveAvailability(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := ar.db.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ar *AvailabilityRepo) GetAvailability(filter interface{}) (*Availability, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var availability Availability
+	err := ar.db.FindOne(ctx, filter).Decode(&availability)
+	if err != nil {
+		return nil, err
+	}
+	return &availability, nil
+}
+
+type IAvailabilityRepo interface {
+	SaveAvailability(filter interface{}, update interface{}) error
+	GetAvailability(filter interface{}) (*Availability, error)
+}
+
+type CalendarFeedRepo struct {
+	db db.IDatabase
+}
+
+func NewCalendarFeedRepo(db db.IDatabase) *CalendarFeedRepo {
+	return &CalendarFeedRepo{db: db}
+}
+
+func (cr *CalendarFeedRepo) SaveCalendarFeed(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := cr.db.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cr *CalendarFeedRepo) GetCalendarFeed(filter interface{}) (*CalendarFeed, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var feed CalendarFeed
+	err := cr.db.FindOne(ctx, filter).Decode(&feed)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (cr *CalendarFeedRepo) DeleteCalendarFeed(filter interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := cr.db.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type ICalendarFeedRepo interface {
+	SaveCalendarFeed(filter interface{}, update interface{}) error
+	GetCalendarFeed(filter interface{}) (*CalendarFeed, error)
+	DeleteCalendarFeed(filter interface{}) error
+}
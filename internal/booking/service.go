@@ -0,0 +1,378 @@
+package booking
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/student"
+	"github.com/ayo-ajayi/edutech/internal/subject"
+	"github.com/ayo-ajayi/edutech/internal/tutor"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrBookingNotFound = errors.New("booking not found")
+	ErrBookingConflict = errors.New("the requested time conflicts with another booking")
+	ErrPastCutoff      = errors.New("it is too late to change this booking")
+)
+
+// BookingPolicy holds the scheduling rules applied to every booking.
+type BookingPolicy struct {
+	MinNotice          time.Duration
+	MaxAdvance         time.Duration
+	MinDuration        time.Duration
+	MaxDuration        time.Duration
+	CancellationCutoff time.Duration
+	RescheduleCutoff   time.Duration
+}
+
+type BookingService struct {
+	bookingRepo             IBookingRepo
+	availabilityRepo        IAvailabilityRepo
+	studentRepo             student.IBookingStudentRepo
+	tutorRepo               tutor.IBookingTutorRepo
+	subjectRepo             subject.IBookingSubjectRepo
+	studentSubjectTutorRepo subject.IBookingStudentSubjectTutorRepo
+	emailManager            utils.IEmailManager
+	locker                  utils.ILocker
+	policy                  BookingPolicy
+}
+
+func NewBookingService(
+	bookingRepo IBookingRepo,
+	availabilityRepo IAvailabilityRepo,
+	studentRepo student.IBookingStudentRepo,
+	tutorRepo tutor.IBookingTutorRepo,
+	subjectRepo subject.IBookingSubjectRepo,
+	studentSubjectTutorRepo subject.IBookingStudentSubjectTutorRepo,
+	emailManager utils.IEmailManager,
+	locker utils.ILocker,
+	policy BookingPolicy,
+) *BookingService {
+	return &BookingService{bookingRepo: bookingRepo, availabilityRepo: availabilityRepo, studentRepo: studentRepo, tutorRepo: tutorRepo, subjectRepo: subjectRepo, studentSubjectTutorRepo: studentSubjectTutorRepo, emailManager: emailManager, locker: locker, policy: policy}
+}
+
+// lockSchedules keeps other bookings of the tutor and the student from being
+// made or moved until unlock is called, so checkSlot and the write after it
+// see the same lessons.
+func (bs *BookingService) lockSchedules(tutorId, studentId primitive.ObjectID) (func(), error) {
+	return bs.locker.Lock("schedule:"+tutorId.Hex(), "schedule:"+studentId.Hex())
+}
+
+func (bs *BookingService) SaveAvailability(tutorId primitive.ObjectID, availability *Availability) (*Availability, error) {
+	if err := availability.Validate(); err != nil {
+		return nil, err
+	}
+	if availability.Weekly == nil {
+		availability.Weekly = []WeeklySlot{}
+	}
+	if availability.Exceptions == nil {
+		availability.Exceptions = []Exception{}
+	}
+	err := bs.availabilityRepo.SaveAvailability(bson.M{"tutor_id": tutorId}, bson.M{"$set": bson.M{
+		"timezone":   availability.Timezone,
+		"weekly":     availability.Weekly,
+		"exceptions": availability.Exceptions,
+		"updated_at": time.Now(),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return bs.availabilityRepo.GetAvailability(bson.M{"tutor_id": tutorId})
+}
+
+func (bs *BookingService) GetAvailability(tutorId primitive.ObjectID) (*Availability, error) {
+	availability, err := bs.availabilityRepo.GetAvailability(bson.M{"tutor_id": tutorId})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("tutor has not published availability")
+		}
+		return nil, err
+	}
+	return availability, nil
+}
+
+// GetOpenSlots returns the tutor's free windows between from and to, that is the
+// published availability minus lessons already booked.
+func (bs *BookingService) GetOpenSlots(tutorId primitive.ObjectID, from, to time.Time) ([]Window, error) {
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > 31*24*time.Hour {
+		return nil, errors.New("range cannot be longer than 31 days")
+	}
+	if earliest := time.Now().Add(bs.policy.MinNotice); from.Before(earliest) {
+		from = earliest
+	}
+	availability, err := bs.GetAvailability(tutorId)
+	if err != nil {
+		return nil, err
+	}
+	free, err := availability.Windows(from, to)
+	if err != nil {
+		return nil, err
+	}
+	booked, err := bs.bookingRepo.GetBookings(bson.M{
+		"tutor_id":  tutorId,
+		"status":    BookingConfirmed,
+		"starts_at": bson.M{"$lt": to},
+		"ends_at":   bson.M{"$gt": from},
+	})
+	if err != nil {
+		return nil, err
+	}
+	busy := []Window{}
+	for _, b := range booked {
+		busy = append(busy, Window{StartsAt: b.StartsAt, EndsAt: b.EndsAt})
+	}
+	return subtractWindows(free, busy), nil
+}
+
+// checkSlot enforces the booking policy, the tutor's availability and that
+// neither the tutor nor the student has another lesson at that time. ignore is
+// the booking being rescheduled, if any. Callers hold lockSchedules.
+func (bs *BookingService) checkSlot(tutorId, studentId primitive.ObjectID, startsAt, endsAt time.Time, ignore primitive.ObjectID) error {
+	duration := endsAt.Sub(startsAt)
+	if duration < bs.policy.MinDuration || duration > bs.policy.MaxDuration {
+		return errors.New("lesson duration must be between " + bs.policy.MinDuration.String() + " and " + bs.policy.MaxDuration.String())
+	}
+	now := time.Now()
+	if startsAt.Before(now.Add(bs.policy.MinNotice)) {
+		return errors.New("lessons must be booked at least " + bs.policy.MinNotice.String() + " in advance")
+	}
+	if bs.policy.MaxAdvance > 0 && startsAt.After(now.Add(bs.policy.MaxAdvance)) {
+		return errors.New("lessons cannot be booked more than " + bs.policy.MaxAdvance.String() + " in advance")
+	}
+	availability, err := bs.GetAvailability(tutorId)
+	if err != nil {
+		return err
+	}
+	windows, err := availability.Windows(startsAt.Add(-24*time.Hour), endsAt.Add(24*time.Hour))
+	if err != nil {
+		return err
+	}
+	available := false
+	for _, w := range windows {
+		if !startsAt.Before(w.StartsAt) && !endsAt.After(w.EndsAt) {
+			available = true
+			break
+		}
+	}
+	if !available {
+		return errors.New("tutor is not available at the requested time")
+	}
+	overlap := bson.M{
+		"_id":       bson.M{"$ne": ignore},
+		"status":    BookingConfirmed,
+		"starts_at": bson.M{"$lt": endsAt},
+		"ends_at":   bson.M{"$gt": startsAt},
+	}
+	overlap["$or"] = bson.A{bson.M{"tutor_id": tutorId}, bson.M{"student_id": studentId}}
+	conflict, err := bs.bookingRepo.BookingExists(overlap)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		return ErrBookingConflict
+	}
+	return nil
+}
+
+func (bs *BookingService) CreateBooking(booking *Booking) error {
+	registered, err := bs.studentSubjectTutorRepo.StudentSubjectTutorExists(bson.M{
+		"student_id": booking.StudentId,
+		"tutor_id":   booking.TutorId,
+		"subject_id": booking.SubjectId,
+	})
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return errors.New("tutor is not registered for this subject")
+	}
+	t, err := bs.tutorRepo.GetTutor(bson.M{"_id": booking.TutorId})
+	if err != nil {
+		return err
+	}
+	if !t.Approved || t.Suspended {
+		return errors.New("tutor is not available")
+	}
+	booking.StartsAt = booking.StartsAt.UTC()
+	booking.EndsAt = booking.EndsAt.UTC()
+	unlock, err := bs.lockSchedules(booking.TutorId, booking.StudentId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := bs.checkSlot(booking.TutorId, booking.StudentId, booking.StartsAt, booking.EndsAt, primitive.NilObjectID); err != nil {
+		return err
+	}
+	booking.Id = primitive.NewObjectID()
+	booking.Status = BookingConfirmed
+	booking.CreatedAt = time.Now()
+	booking.UpdatedAt = time.Now()
+	if err := bs.bookingRepo.CreateBooking(booking); err != nil {
+		return err
+	}
+	bs.notify(booking, bs.emailManager.SendBookingConfirmation, "")
+	return nil
+}
+
+func (bs *BookingService) GetBooking(userId primitive.ObjectID, bookingId primitive.ObjectID) (*Booking, error) {
+	booking, err := bs.bookingRepo.GetBooking(bson.M{
+		"_id": bookingId,
+		"$or": bson.A{bson.M{"student_id": userId}, bson.M{"tutor_id": userId}},
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrBookingNotFound
+		}
+		return nil, err
+	}
+	return booking, nil
+}
+
+func (bs *BookingService) GetBookings(userId primitive.ObjectID, role user.Role, status BookingStatus, upcoming bool, req *utils.ListReq) ([]*Booking, error) {
+	filter := bson.M{"student_id": userId}
+	if role == user.Tutor {
+		filter = bson.M{"tutor_id": userId}
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	if upcoming {
+		filter["ends_at"] = bson.M{"$gt": time.Now()}
+	}
+	return bs.bookingRepo.GetBookings(filter, req.Paginate(bson.D{{Key: "starts_at", Value: 1}}))
+}
+
+// RescheduleBooking moves a lesson to a new start time, keeping its duration.
+// Either party can reschedule until RescheduleCutoff before the lesson.
+func (bs *BookingService) RescheduleBooking(userId primitive.ObjectID, bookingId primitive.ObjectID, startsAt time.Time) (*Booking, error) {
+	booking, err := bs.GetBooking(userId, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := bs.lockSchedules(booking.TutorId, booking.StudentId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	// read again, the booking may have been moved while waiting for the lock
+	if booking, err = bs.GetBooking(userId, bookingId); err != nil {
+		return nil, err
+	}
+	if booking.Status != BookingConfirmed {
+		return nil, errors.New("only confirmed bookings can be rescheduled")
+	}
+	if time.Now().Add(bs.policy.RescheduleCutoff).After(booking.StartsAt) {
+		return nil, ErrPastCutoff
+	}
+	startsAt = startsAt.UTC()
+	endsAt := startsAt.Add(booking.EndsAt.Sub(booking.StartsAt))
+	if err := bs.checkSlot(booking.TutorId, booking.StudentId, startsAt, endsAt, booking.Id); err != nil {
+		return nil, err
+	}
+	previous := booking.StartsAt
+	err = bs.bookingRepo.UpdateBooking(bson.M{"_id": booking.Id, "status": BookingConfirmed}, bson.M{
+		"$set": bson.M{"starts_at": startsAt, "ends_at": endsAt, "updated_at": time.Now()},
+		"$inc": bson.M{"rescheduled": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+	booking.StartsAt = startsAt
+	booking.EndsAt = endsAt
+	booking.Rescheduled++
+	bs.notify(booking, func(email, firstname string, details utils.BookingEmail) error {
+		details.PreviousStartsAt = previous
+		return bs.emailManager.SendBookingRescheduled(email, firstname, details)
+	}, "")
+	return booking, nil
+}
+
+// CancelBooking cancels a lesson on behalf of the student or the tutor. Lessons
+// cannot be cancelled later than CancellationCutoff before they start.
+func (bs *BookingService) CancelBooking(userId primitive.ObjectID, bookingId primitive.ObjectID, reason string) (*Booking, error) {
+	booking, err := bs.GetBooking(userId, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	if booking.Status != BookingConfirmed {
+		return nil, errors.New("booking is already cancelled")
+	}
+	if time.Now().Add(bs.policy.CancellationCutoff).After(booking.StartsAt) {
+		return nil, ErrPastCutoff
+	}
+	now := time.Now()
+	err = bs.bookingRepo.UpdateBooking(bson.M{"_id": booking.Id, "status": BookingConfirmed}, bson.M{"$set": bson.M{
+		"status":        BookingCancelled,
+		"cancelled_by":  userId,
+		"cancel_reason": reason,
+		"cancelled_at":  now,
+		"updated_at":    now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	booking.Status = BookingCancelled
+	booking.CancelledBy = &userId
+	booking.CancelReason = reason
+	booking.CancelledAt = &now
+	bs.notify(booking, bs.emailManager.SendBookingCancellation, reason)
+	return booking, nil
+}
+
+// notify emails both the student and the tutor about a booking. Failures are
+// logged rather than returned because the booking itself has been saved.
+func (bs *BookingService) notify(booking *Booking, send func(email, firstname string, details utils.BookingEmail) error, reason string) {
+	s, err := bs.studentRepo.GetStudent(bson.M{"_id": booking.StudentId})
+	if err != nil {
+		log.Println("booking notification error: ", err)
+		return
+	}
+	t, err := bs.tutorRepo.GetTutor(bson.M{"_id": booking.TutorId})
+	if err != nil {
+		log.Println("booking notification error: ", err)
+		return
+	}
+	subjectName := "lesson"
+	if sub, err := bs.subjectRepo.GetSubject(bson.M{"_id": booking.SubjectId}); err == nil {
+		subjectName = sub.Name
+	}
+	timezone := "UTC"
+	if availability, err := bs.availabilityRepo.GetAvailability(bson.M{"tutor_id": booking.TutorId}); err == nil {
+		timezone = availability.Timezone
+	}
+	details := utils.BookingEmail{
+		SubjectName: subjectName,
+		StartsAt:    booking.StartsAt,
+		EndsAt:      booking.EndsAt,
+		Timezone:    timezone,
+		Reason:      reason,
+	}
+	details.With = t.Firstname + " " + t.Lastname
+	if err := send(s.Email, s.Firstname, details); err != nil {
+		log.Println("booking notification error: ", err)
+	}
+	details.With = s.Firstname + " " + s.Lastname
+	if err := send(t.Email, t.Firstname, details); err != nil {
+		log.Println("booking notification error: ", err)
+	}
+}
+
+type IBookingService interface {
+	SaveAvailability(tutorId primitive.ObjectID, availability *Availability) (*Availability, error)
+	GetAvailability(tutorId primitive.ObjectID) (*Availability, error)
+	GetOpenSlots(tutorId primitive.ObjectID, from, to time.Time) ([]Window, error)
+	CreateBooking(booking *Booking) error
+	GetBooking(userId primitive.ObjectID, bookingId primitive.ObjectID) (*Booking, error)
+	GetBookings(userId primitive.ObjectID, role user.Role, status BookingStatus, upcoming bool, req *utils.ListReq) ([]*Booking, error)
+	RescheduleBooking(userId primitive.ObjectID, bookingId primitive.ObjectID, startsAt time.Time) (*Booking, error)
+	CancelBooking(userId primitive.ObjectID, bookingId primitive.ObjectID, reason string) (*Booking, error)
+}
@@ -0,0 +1,167 @@
+package booking
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/student"
+	"github.com/ayo-ajayi/edutech/internal/subject"
+	"github.com/ayo-ajayi/edutech/internal/tutor"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type testTutors struct{ tutor *tutor.Tutor }
+
+func (tt testTutors) GetTutor(filter interface{}) (*tutor.Tutor, error) { return tt.tutor, nil }
+
+type testStudents struct{ student *student.Student }
+
+func (ts testStudents) GetStudent(filter interface{}) (*student.Student, error) {
+	return ts.student, nil
+}
+
+type testSubjects struct{}
+
+func (testSubjects) GetSubject(filter interface{}) (*subject.Subject, error) {
+	return nil, mongo.ErrNoDocuments
+}
+
+type testRegistrations struct{}
+
+func (testRegistrations) StudentSubjectTutorExists(filter interface{}) (bool, error) {
+	return true, nil
+}
+
+// testEmails only implements the booking notifications.
+type testEmails struct{ utils.IEmailManager }
+
+func (testEmails) SendBookingConfirmation(email, firstname string, booking utils.BookingEmail) error {
+	return nil
+}
+
+func (testEmails) SendBookingRescheduled(email, firstname string, booking utils.BookingEmail) error {
+	return nil
+}
+
+func (testEmails) SendBookingCancellation(email, firstname string, booking utils.BookingEmail) error {
+	return nil
+}
+
+// newTestBookingService returns a service on the in-memory database for a
+// tutor who is available from 09:00 to 12:00 UTC every day, and the midnight
+// three days from now to book lessons on.
+func newTestBookingService(t *testing.T) (*BookingService, *Booking, time.Time) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	tutorUser := &user.User{Id: primitive.NewObjectID(), Email: "tutor@x.io", Firstname: "Ada"}
+	studentUser := &user.User{Id: primitive.NewObjectID(), Email: "student@x.io", Firstname: "Bola"}
+	bs := NewBookingService(
+		NewBookingRepo(store.Collection("bookings")),
+		NewAvailabilityRepo(store.Collection("availabilities")),
+		testStudents{&student.Student{Id: studentUser.Id, User: studentUser}},
+		testTutors{&tutor.Tutor{Id: tutorUser.Id, User: tutorUser, Approved: true}},
+		testSubjects{}, testRegistrations{}, testEmails{},
+		utils.NewLocker(store.Collection("locks"), 30*time.Second, 5*time.Second),
+		BookingPolicy{
+			MinNotice:          time.Hour,
+			MaxAdvance:         90 * 24 * time.Hour,
+			MinDuration:        30 * time.Minute,
+			MaxDuration:        3 * time.Hour,
+			CancellationCutoff: 24 * time.Hour,
+			RescheduleCutoff:   24 * time.Hour,
+		})
+	weekly := []WeeklySlot{}
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		weekly = append(weekly, WeeklySlot{Weekday: weekday, Start: "09:00", End: "12:00"})
+	}
+	if _, err := bs.SaveAvailability(tutorUser.Id, &Availability{Timezone: "UTC", Weekly: weekly}); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 3)
+	lesson := &Booking{StudentId: studentUser.Id, TutorId: tutorUser.Id, SubjectId: primitive.NewObjectID()}
+	return bs, lesson, day
+}
+
+func newLesson(template *Booking, startsAt, endsAt time.Time) *Booking {
+	return &Booking{StudentId: template.StudentId, TutorId: template.TutorId, SubjectId: template.SubjectId, StartsAt: startsAt, EndsAt: endsAt}
+}
+
+func TestCreateBookingChecksSlot(t *testing.T) {
+	bs, template, day := newTestBookingService(t)
+	notAvailable := errors.New("tutor is not available at the requested time")
+	// the cases run in order against the same schedule
+	tests := []struct {
+		name     string
+		from, to time.Duration
+		want     error
+	}{
+		{"first lesson", 10 * time.Hour, 11 * time.Hour, nil},
+		{"overlapping a lesson", 9*time.Hour + 30*time.Minute, 10*time.Hour + 30*time.Minute, ErrBookingConflict},
+		{"inside a lesson", 10*time.Hour + 15*time.Minute, 10*time.Hour + 45*time.Minute, ErrBookingConflict},
+		{"back to back before it", 9 * time.Hour, 10 * time.Hour, nil},
+		{"crossing the start of the window", 8*time.Hour + 30*time.Minute, 9*time.Hour + 30*time.Minute, notAvailable},
+		{"crossing the end of the window", 11*time.Hour + 30*time.Minute, 12*time.Hour + 30*time.Minute, notAvailable},
+		{"back to back after it up to the end of the window", 11 * time.Hour, 12 * time.Hour, nil},
+		{"outside the window", 13 * time.Hour, 14 * time.Hour, notAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bs.CreateBooking(newLesson(template, day.Add(tt.from), day.Add(tt.to)))
+			if fmt.Sprint(err) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelledBookingFreesSlot(t *testing.T) {
+	bs, template, day := newTestBookingService(t)
+	lesson := newLesson(template, day.Add(9*time.Hour), day.Add(10*time.Hour))
+	if err := bs.CreateBooking(lesson); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.CancelBooking(template.StudentId, lesson.Id, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.CreateBooking(newLesson(template, day.Add(9*time.Hour), day.Add(10*time.Hour))); err != nil {
+		t.Errorf("booking the freed slot: %v", err)
+	}
+}
+
+func TestBookingCutoffs(t *testing.T) {
+	tests := []struct {
+		name     string
+		startsIn func(day time.Time) time.Duration
+		want     error
+	}{
+		{"in two hours", func(time.Time) time.Duration { return 2 * time.Hour }, ErrPastCutoff},
+		{"just inside the cutoff", func(time.Time) time.Duration { return 23*time.Hour + 59*time.Minute }, ErrPastCutoff},
+		{"well before the cutoff", func(day time.Time) time.Duration { return time.Until(day.Add(9 * time.Hour)) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs, template, day := newTestBookingService(t)
+			// stored directly, lessons this close could not be booked any more
+			startsAt := time.Now().Add(tt.startsIn(day)).UTC().Truncate(time.Minute)
+			lesson := newLesson(template, startsAt, startsAt.Add(time.Hour))
+			lesson.Id = primitive.NewObjectID()
+			lesson.Status = BookingConfirmed
+			if err := bs.bookingRepo.CreateBooking(lesson); err != nil {
+				t.Fatal(err)
+			}
+			// moving a lesson by half an hour overlaps its old time, which is allowed
+			if _, err := bs.RescheduleBooking(template.StudentId, lesson.Id, startsAt.Add(30*time.Minute)); err != tt.want {
+				t.Errorf("reschedule: got %v, want %v", err, tt.want)
+			}
+			if _, err := bs.CancelBooking(template.TutorId, lesson.Id, "ill"); err != tt.want {
+				t.Errorf("cancel: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,11 +13,60 @@ type UserController struct {
 	userService IUserService
 }
 
+func NewUserController(userService IUserService) *UserController {
+	return &UserController{userService: userService}
+}
+
+// GetTutors is the public tutor directory, which only lists approved tutors.
 func (uc *UserController) GetTutors(c *gin.Context) {
-	tutors, err := uc.userService.GetTutors()
+	uc.tutorDirectory(c, false)
+}
+
+// GetTutorDirectory is the tutor directory for admins, who can also list
+// tutors by approval status.
+func (uc *UserController) GetTutorDirectory(c *gin.Context) {
+	uc.tutorDirectory(c, true)
+}
+
+func (uc *UserController) tutorDirectory(c *gin.Context, admin bool) {
+	req := utils.TutorDirectoryReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	tutors, next, err := uc.userService.GetTutors(&req, admin)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidSubject) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		if errors.Is(err, ErrApprovalFilterForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"tutors":      tutors,
+		"next_cursor": next,
+	}, "tutors retrieved successfully"))
+}
+
+// GetAvatar serves an avatar. Avatars get a new URL when they change, so they
+// can be cached for good.
+func (uc *UserController) GetAvatar(c *gin.Context) {
+	data, contentType, err := uc.userService.GetAvatar(c.Param("key"))
 	if err != nil {
+		if errors.Is(err, utils.ErrBlobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": "avatar not found"}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
-	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutors, "tutors retrieved successfully"))
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", contentType)
+	c.Data(http.StatusOK, contentType, data)
 }
@@ -1,28 +1,223 @@
 package common
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"time"
+
 	"github.com/ayo-ajayi/edutech/internal/student"
 	"github.com/ayo-ajayi/edutech/internal/tutor"
+	"github.com/ayo-ajayi/edutech/internal/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrInvalidSubject = errors.New("invalid subject id")
+
+	ErrApprovalFilterForbidden = errors.New("only admins can list tutors by approval status")
+)
+
+const maxDirectoryLimit = 100
+
 type UserService struct {
-	tutorRepo   tutor.ITutorRepo
-	studentRepo student.IStudentRepo
+	tutorRepo     tutor.ITutorRepo
+	studentRepo   student.IStudentRepo
+	avatarManager utils.IAvatarManager
+}
+
+func NewUserService(tutorRepo tutor.ITutorRepo, studentRepo student.IStudentRepo, avatarManager utils.IAvatarManager) *UserService {
+	return &UserService{tutorRepo: tutorRepo, studentRepo: studentRepo, avatarManager: avatarManager}
+}
+
+// directorySorts maps the public sort names to the tutor field and its default direction.
+var directorySorts = map[string]struct {
+	field     string
+	direction int
+}{
+	"rating": {"rating.average", -1},
+	"name":   {"user.firstname", 1},
+	"newest": {"user.created_at", -1},
+}
+
+// directoryCursor marks the last tutor of a page: the value of the sort field and
+// the tutor id, which breaks ties between tutors sharing the same value.
+type directoryCursor struct {
+	Value interface{} `json:"v"`
+	Id    string      `json:"id"`
+}
+
+// GetTutors lists the tutors students are allowed to see: verified, approved and
+// not suspended. Admins may ask for tutors by approval status instead, with
+// admin set. It returns the cursor of the next page, or "" on the last page.
+func (us *UserService) GetTutors(req *utils.TutorDirectoryReq, admin bool) ([]*utils.TutorDirectoryRes, string, error) {
+	if req.Approval == "" {
+		req.Approval = "approved"
+	}
+	if req.Approval != "approved" && !admin {
+		return nil, "", ErrApprovalFilterForbidden
+	}
+	if req.Sort == "" {
+		req.Sort = "rating"
+	}
+	if req.Limit <= 0 || req.Limit > maxDirectoryLimit {
+		req.Limit = 20
+	}
+	sortBy := directorySorts[req.Sort]
+	direction := sortBy.direction
+	switch req.Order {
+	case "asc":
+		direction = 1
+	case "desc":
+		direction = -1
+	}
+
+	conditions := bson.A{bson.M{
+		"user.is_verified": true,
+		"user.suspended":   bson.M{"$ne": true},
+	}}
+	switch req.Approval {
+	case "approved":
+		conditions = append(conditions, bson.M{"approved": true})
+	case "pending", "rejected":
+		conditions = append(conditions, bson.M{"approved": bson.M{"$ne": true}, "application.status": req.Approval})
+	}
+	if req.Subject != "" {
+		subjectId, err := primitive.ObjectIDFromHex(req.Subject)
+		if err != nil {
+			return nil, "", ErrInvalidSubject
+		}
+		conditions = append(conditions, bson.M{"subject": subjectId})
+	}
+	if req.MinRating > 0 {
+		conditions = append(conditions, bson.M{"rating.average": bson.M{"$gte": req.MinRating}})
+	}
+	if req.Search != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(req.Search), "$options": "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"user.firstname": pattern},
+			bson.M{"user.lastname": pattern},
+		}})
+	}
+	if req.Cursor != "" {
+		after, err := cursorCondition(req.Cursor, req.Sort, sortBy.field, direction)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, after)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: sortBy.field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(req.Limit + 1)
+	tutors, err := us.tutorRepo.GetTutors(bson.M{"$and": conditions}, findOptions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if int64(len(tutors)) > req.Limit {
+		tutors = tutors[:req.Limit]
+		next, err = encodeCursor(tutors[len(tutors)-1], req.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	res := []*utils.TutorDirectoryRes{}
+	for _, t := range tutors {
+		approval := ""
+		if admin {
+			approval = approvalStatus(t)
+		}
+		res = append(res, &utils.TutorDirectoryRes{
+			TutorId:     t.Id,
+			FirstName:   t.Firstname,
+			LastName:    t.Lastname,
+			SubjectId:   t.Subject,
+			Rating:      t.Rating.Average,
+			RatingCount: t.Rating.Count,
+			Profile:     t.Profile.Public(),
+			JoinedAt:    t.CreatedAt,
+			Approval:    approval,
+		})
+	}
+	return res, next, nil
+}
+
+// approvalStatus is "approved", the status of the tutor's application, or
+// "none" if they have not applied yet.
+func approvalStatus(t *tutor.Tutor) string {
+	if t.Approved {
+		return string(tutor.ApplicationApproved)
+	}
+	if t.Application != nil {
+		return string(t.Application.Status)
+	}
+	return "none"
 }
 
-func NewUserService(tutorRepo tutor.ITutorRepo, studentRepo student.IStudentRepo) *UserService {
-	return &UserService{tutorRepo: tutorRepo, studentRepo: studentRepo}
+func encodeCursor(t *tutor.Tutor, sort string) (string, error) {
+	cursor := directoryCursor{Id: t.Id.Hex()}
+	switch sort {
+	case "rating":
+		cursor.Value = t.Rating.Average
+	case "name":
+		cursor.Value = t.Firstname
+	case "newest":
+		cursor.Value = t.CreatedAt.UnixMilli()
+	}
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func (us *UserService) GetTutors() ([]*tutor.Tutor, error) {
-	return us.tutorRepo.GetTutors(bson.M{})
+func cursorCondition(encoded, sort, field string, direction int) (bson.M, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor directoryCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(cursor.Id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var value interface{}
+	switch v := cursor.Value.(type) {
+	case float64:
+		value = v
+		if sort == "newest" {
+			value = time.UnixMilli(int64(v))
+		}
+	case string:
+		value = v
+	default:
+		return nil, ErrInvalidCursor
+	}
+	op := "$gt"
+	if direction < 0 {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: value}},
+		bson.M{field: value, "_id": bson.M{op: id}},
+	}}, nil
 }
 
-func (us *UserService) GetTutorsBySubjectId(subjectId string) ([]*tutor.Tutor, error) {
-	return us.tutorRepo.GetTutors(bson.M{"subject": subjectId})
+// GetAvatar returns the avatar stored under key and its content type.
+func (us *UserService) GetAvatar(key string) ([]byte, string, error) {
+	return us.avatarManager.GetAvatar(key)
 }
 
 type IUserService interface {
-	GetTutors() ([]*tutor.Tutor, error)
+	GetTutors(req *utils.TutorDirectoryReq, admin bool) ([]*utils.TutorDirectoryRes, string, error)
+	GetAvatar(key string) ([]byte, string, error)
 }
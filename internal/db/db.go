@@ -55,6 +55,18 @@ func (db *Database) DeleteOne(ctx context.Context, filter interface{}, opts ...*
 	return db.collection.DeleteOne(ctx, filter, opts...)
 }
 
+func (db *Database) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return db.collection.DeleteMany(ctx, filter, opts...)
+}
+
+func (db *Database) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	return db.collection.Aggregate(ctx, pipeline, opts...)
+}
+
+func (db *Database) CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error) {
+	return db.collection.Indexes().CreateOne(ctx, model)
+}
+
 type IDatabase interface {
 	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
 	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
@@ -62,4 +74,7 @@ type IDatabase interface {
 	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+	CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error)
 }
@@ -0,0 +1,317 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MemoryDatabase is an IDatabase kept entirely in process memory. It supports the
+// filter and update subset used by the repos and is meant for tests and local
+// development.
+type MemoryDatabase struct {
+	mu        sync.RWMutex
+	documents []bson.D
+	indexes   []memoryIndex
+	// store resolves the collections named by $lookup stages
+	store *MemoryStore
+}
+
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{}
+}
+
+// MemoryStore hands out one MemoryDatabase per collection name.
+type MemoryStore struct {
+	mu          sync.Mutex
+	collections map[string]*MemoryDatabase
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{collections: map[string]*MemoryDatabase{}}
+}
+
+func (ms *MemoryStore) Collection(name string) *MemoryDatabase {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	collection, ok := ms.collections[name]
+	if !ok {
+		collection = NewMemoryDatabase()
+		collection.store = ms
+		ms.collections[name] = collection
+	}
+	return collection
+}
+
+func duplicateKeyError(key string) error {
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    11000,
+		Message: "E11000 duplicate key error dup key: " + key,
+	}}}
+}
+
+func (mdb *MemoryDatabase) insert(document interface{}) (interface{}, error) {
+	doc, err := normalize(document)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := getField(doc, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+	for _, existing := range mdb.documents {
+		if existingId, _ := getField(existing, "_id"); equal(existingId, id) {
+			return nil, duplicateKeyError("_id")
+		}
+	}
+	if err := mdb.checkIndexes(doc, -1); err != nil {
+		return nil, err
+	}
+	mdb.documents = append(mdb.documents, doc)
+	return id, nil
+}
+
+func (mdb *MemoryDatabase) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mdb.expire()
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	id, err := mdb.insert(document)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+func (mdb *MemoryDatabase) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mdb.expire()
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	ids := []interface{}{}
+	for _, document := range documents {
+		id, err := mdb.insert(document)
+		if err != nil {
+			return &mongo.InsertManyResult{InsertedIDs: ids}, err
+		}
+		ids = append(ids, id)
+	}
+	return &mongo.InsertManyResult{InsertedIDs: ids}, nil
+}
+
+// find returns the indexes of the matching documents, sorted and paginated.
+func (mdb *MemoryDatabase) find(filter interface{}, sortSpec interface{}, skip, limit *int64) ([]int, error) {
+	f, err := normalize(filter)
+	if err != nil {
+		return nil, err
+	}
+	found := []int{}
+	for i, doc := range mdb.documents {
+		ok, err := matches(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, i)
+		}
+	}
+	if sortSpec != nil {
+		keys, err := normalize(sortSpec)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(found, func(i, j int) bool {
+			return compareDocuments(mdb.documents[found[i]], mdb.documents[found[j]], keys) < 0
+		})
+	}
+	if skip != nil && *skip > 0 {
+		if int(*skip) >= len(found) {
+			return []int{}, nil
+		}
+		found = found[*skip:]
+	}
+	if limit != nil && *limit > 0 && int(*limit) < len(found) {
+		found = found[:*limit]
+	}
+	return found, nil
+}
+
+// compareDocuments orders a and b by the sort keys, as in {"field": 1 or -1}.
+func compareDocuments(a, b bson.D, keys bson.D) int {
+	for _, key := range keys {
+		path := strings.Split(key.Key, ".")
+		x, _ := getPath(a, path)
+		y, _ := getPath(b, path)
+		c := sortValue(x, y)
+		if direction, _ := toFloat(key.Value); direction < 0 {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (mdb *MemoryDatabase) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	if err := ctx.Err(); err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	mdb.expire()
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+	o := options.MergeFindOneOptions(opts...)
+	one := int64(1)
+	found, err := mdb.find(filter, o.Sort, o.Skip, &one)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if len(found) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(mdb.documents[found[0]], nil, nil)
+}
+
+func (mdb *MemoryDatabase) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mdb.expire()
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+	o := options.MergeFindOptions(opts...)
+	found, err := mdb.find(filter, o.Sort, o.Skip, o.Limit)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]interface{}, 0, len(found))
+	for _, i := range found {
+		docs = append(docs, mdb.documents[i])
+	}
+	return mongo.NewCursorFromDocuments(docs, nil, nil)
+}
+
+func (mdb *MemoryDatabase) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mdb.expire()
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	u, err := normalize(update)
+	if err != nil {
+		return nil, err
+	}
+	one := int64(1)
+	found, err := mdb.find(filter, nil, nil, &one)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		o := options.MergeUpdateOptions(opts...)
+		if o.Upsert == nil || !*o.Upsert {
+			return &mongo.UpdateResult{}, nil
+		}
+		f, err := normalize(filter)
+		if err != nil {
+			return nil, err
+		}
+		seed, err := upsertSeed(f)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := applyUpdate(seed, u, true)
+		if err != nil {
+			return nil, err
+		}
+		id, err := mdb.insert(doc)
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.UpdateResult{UpsertedCount: 1, UpsertedID: id}, nil
+	}
+	i := found[0]
+	before, err := bson.Marshal(mdb.documents[i])
+	if err != nil {
+		return nil, err
+	}
+	current, err := normalize(mdb.documents[i])
+	if err != nil {
+		return nil, err
+	}
+	doc, err := applyUpdate(current, u, false)
+	if err != nil {
+		return nil, err
+	}
+	after, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	// like MongoDB, an update leaving the document as it was matches it
+	// without modifying it
+	if bytes.Equal(before, after) {
+		return &mongo.UpdateResult{MatchedCount: 1}, nil
+	}
+	if err := mdb.checkIndexes(doc, i); err != nil {
+		return nil, err
+	}
+	mdb.documents[i] = doc
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (mdb *MemoryDatabase) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mdb.expire()
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	one := int64(1)
+	found, err := mdb.find(filter, nil, nil, &one)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return &mongo.DeleteResult{}, nil
+	}
+	i := found[0]
+	mdb.documents = append(mdb.documents[:i], mdb.documents[i+1:]...)
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+func (mdb *MemoryDatabase) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mdb.expire()
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	found, err := mdb.find(filter, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	remove := map[int]bool{}
+	for _, i := range found {
+		remove[i] = true
+	}
+	kept := []bson.D{}
+	for i, doc := range mdb.documents {
+		if !remove[i] {
+			kept = append(kept, doc)
+		}
+	}
+	mdb.documents = kept
+	return &mongo.DeleteResult{DeletedCount: int64(len(found))}, nil
+}
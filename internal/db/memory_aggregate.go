@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Aggregate runs the pipeline stages the repos use: $match, $lookup (with
+// localField/foreignField), $unwind, $sort, $skip and $limit.
+func (mdb *MemoryDatabase) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stages, err := normalizePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	docs := mdb.snapshot()
+	for _, stage := range stages {
+		if len(stage) != 1 {
+			return nil, errors.New("memory: a pipeline stage must have exactly one field")
+		}
+		if docs, err = mdb.runStage(docs, stage[0]); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		out = append(out, doc)
+	}
+	return mongo.NewCursorFromDocuments(out, nil, nil)
+}
+
+// snapshot copies the current documents so a pipeline can run, and look up
+// other collections, without holding the lock.
+func (mdb *MemoryDatabase) snapshot() []bson.D {
+	mdb.expire()
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+	return append([]bson.D{}, mdb.documents...)
+}
+
+func normalizePipeline(pipeline interface{}) ([]bson.D, error) {
+	wrapped, err := normalize(bson.M{"pipeline": pipeline})
+	if err != nil {
+		return nil, err
+	}
+	value, _ := getField(wrapped, "pipeline")
+	list, ok := value.(bson.A)
+	if !ok {
+		return nil, errors.New("memory: pipeline must be an array")
+	}
+	stages := []bson.D{}
+	for _, item := range list {
+		stage, ok := item.(bson.D)
+		if !ok {
+			return nil, errors.New("memory: pipeline stages must be documents")
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+func (mdb *MemoryDatabase) runStage(docs []bson.D, stage bson.E) ([]bson.D, error) {
+	switch stage.Key {
+	case "$match":
+		filter, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, errors.New("memory: $match must be a document")
+		}
+		kept := []bson.D{}
+		for _, doc := range docs {
+			ok, err := matches(doc, filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				kept = append(kept, doc)
+			}
+		}
+		return kept, nil
+	case "$lookup":
+		return mdb.lookupStage(docs, stage.Value)
+	case "$unwind":
+		return unwindStage(docs, stage.Value)
+	case "$sort":
+		keys, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, errors.New("memory: $sort must be a document")
+		}
+		sort.SliceStable(docs, func(i, j int) bool {
+			return compareDocuments(docs[i], docs[j], keys) < 0
+		})
+		return docs, nil
+	case "$skip":
+		n, ok := toFloat(stage.Value)
+		if !ok {
+			return nil, errors.New("memory: $skip must be a number")
+		}
+		if int(n) >= len(docs) {
+			return []bson.D{}, nil
+		}
+		return docs[int(n):], nil
+	case "$limit":
+		n, ok := toFloat(stage.Value)
+		if !ok {
+			return nil, errors.New("memory: $limit must be a number")
+		}
+		if int(n) < len(docs) {
+			return docs[:int(n)], nil
+		}
+		return docs, nil
+	}
+	return nil, fmt.Errorf("memory: unsupported pipeline stage %s", stage.Key)
+}
+
+func (mdb *MemoryDatabase) lookupStage(docs []bson.D, spec interface{}) ([]bson.D, error) {
+	d, ok := spec.(bson.D)
+	if !ok {
+		return nil, errors.New("memory: $lookup must be a document")
+	}
+	from, _ := getField(d, "from")
+	localField, _ := getField(d, "localField")
+	foreignField, _ := getField(d, "foreignField")
+	as, _ := getField(d, "as")
+	fromName, ok1 := from.(string)
+	local, ok2 := localField.(string)
+	foreign, ok3 := foreignField.(string)
+	asPath, ok4 := as.(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("memory: $lookup needs from, localField, foreignField and as")
+	}
+	if mdb.store == nil {
+		return nil, errors.New("memory: $lookup needs a collection created by a MemoryStore")
+	}
+	foreignDocs := mdb.store.Collection(fromName).snapshot()
+	out := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		value, _ := getPath(doc, strings.Split(local, "."))
+		joined := bson.A{}
+		for _, other := range foreignDocs {
+			if anyEqual(lookup(other, strings.Split(foreign, ".")), value) {
+				joined = append(joined, other)
+			}
+		}
+		next, err := normalize(doc)
+		if err != nil {
+			return nil, err
+		}
+		if next, err = setPath(next, strings.Split(asPath, "."), joined); err != nil {
+			return nil, err
+		}
+		out = append(out, next)
+	}
+	return out, nil
+}
+
+func unwindStage(docs []bson.D, spec interface{}) ([]bson.D, error) {
+	field := ""
+	preserve := false
+	switch s := spec.(type) {
+	case string:
+		field = s
+	case bson.D:
+		path, _ := getField(s, "path")
+		field, _ = path.(string)
+		p, _ := getField(s, "preserveNullAndEmptyArrays")
+		preserve, _ = p.(bool)
+	}
+	if !strings.HasPrefix(field, "$") {
+		return nil, errors.New("memory: $unwind path must start with $")
+	}
+	path := strings.Split(field[1:], ".")
+	out := []bson.D{}
+	for _, doc := range docs {
+		value, found := getPath(doc, path)
+		items, isArray := value.(bson.A)
+		if !isArray {
+			if found && value != nil || preserve {
+				out = append(out, doc)
+			}
+			continue
+		}
+		if len(items) == 0 {
+			if preserve {
+				next, err := normalize(doc)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, unsetPath(next, path))
+			}
+			continue
+		}
+		for _, item := range items {
+			// normalize copies doc, setPath changes nested documents in place
+			next, err := normalize(doc)
+			if err != nil {
+				return nil, err
+			}
+			if next, err = setPath(next, path, item); err != nil {
+				return nil, err
+			}
+			out = append(out, next)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryIndex mirrors the two index behaviours the application relies on:
+// unique keys and TTL expiry.
+type memoryIndex struct {
+	name        string
+	keys        []string
+	unique      bool
+	expireAfter *time.Duration
+}
+
+func (mdb *MemoryDatabase) CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	keys, err := normalize(model.Keys)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", errors.New("index keys must not be empty")
+	}
+	index := memoryIndex{}
+	names := []string{}
+	for _, key := range keys {
+		index.keys = append(index.keys, key.Key)
+		direction := "1"
+		if d, _ := toFloat(key.Value); d < 0 {
+			direction = "-1"
+		}
+		names = append(names, key.Key, direction)
+	}
+	index.name = strings.Join(names, "_")
+	if o := model.Options; o != nil {
+		if o.Name != nil {
+			index.name = *o.Name
+		}
+		if o.Unique != nil {
+			index.unique = *o.Unique
+		}
+		if o.ExpireAfterSeconds != nil {
+			expireAfter := time.Duration(*o.ExpireAfterSeconds) * time.Second
+			index.expireAfter = &expireAfter
+		}
+	}
+
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	for _, existing := range mdb.indexes {
+		if existing.name == index.name {
+			return index.name, nil
+		}
+	}
+	if index.unique {
+		for i := range mdb.documents {
+			if err := mdb.checkUnique(index, mdb.documents[i], i); err != nil {
+				return "", err
+			}
+		}
+	}
+	mdb.indexes = append(mdb.indexes, index)
+	return index.name, nil
+}
+
+func (index memoryIndex) values(doc bson.D) []interface{} {
+	values := []interface{}{}
+	for _, key := range index.keys {
+		// like MongoDB, a missing field is indexed as null
+		value, _ := getPath(doc, strings.Split(key, "."))
+		values = append(values, value)
+	}
+	return values
+}
+
+// checkUnique reports a duplicate key error if another document than the one at
+// position self has the same values for the index keys. self is -1 for new
+// documents.
+func (mdb *MemoryDatabase) checkUnique(index memoryIndex, doc bson.D, self int) error {
+	want := index.values(doc)
+	for i, other := range mdb.documents {
+		if i == self {
+			continue
+		}
+		got := index.values(other)
+		same := true
+		for k := range want {
+			if !(want[k] == nil && got[k] == nil) && !equal(want[k], got[k]) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return duplicateKeyError(index.name)
+		}
+	}
+	return nil
+}
+
+func (mdb *MemoryDatabase) checkIndexes(doc bson.D, self int) error {
+	for _, index := range mdb.indexes {
+		if index.unique {
+			if err := mdb.checkUnique(index, doc, self); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expire drops the documents whose TTL index date has passed. MongoDB does the
+// same in a background task; here it runs before every operation.
+func (mdb *MemoryDatabase) expire() {
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	now := time.Now()
+	for _, index := range mdb.indexes {
+		if index.expireAfter == nil || len(index.keys) != 1 {
+			continue
+		}
+		path := strings.Split(index.keys[0], ".")
+		kept := mdb.documents[:0]
+		for _, doc := range mdb.documents {
+			value, _ := getPath(doc, path)
+			if at, ok := value.(primitive.DateTime); ok && !at.Time().Add(*index.expireAfter).After(now) {
+				continue
+			}
+			kept = append(kept, doc)
+		}
+		mdb.documents = kept
+	}
+}
@@ -0,0 +1,549 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normalize round-trips v through the bson codec so that filters, updates and
+// stored documents all share the same representation (primitive.D, primitive.A,
+// primitive.DateTime, int32/int64...) before they are compared.
+func normalize(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func getField(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lookup resolves a dotted path such as "user.email". Arrays met on the way are
+// fanned out, so the result holds every value reachable through the path.
+func lookup(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+	switch v := value.(type) {
+	case bson.D:
+		child, ok := getField(v, path[0])
+		if !ok {
+			return nil
+		}
+		return lookup(child, path[1:])
+	case bson.A:
+		values := []interface{}{}
+		for _, item := range v {
+			if _, ok := item.(bson.D); ok {
+				values = append(values, lookup(item, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func matches(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			clauses, ok := e.Value.(bson.A)
+			if !ok {
+				return false, fmt.Errorf("memory: %s must be an array", e.Key)
+			}
+			matched := 0
+			for _, clause := range clauses {
+				sub, ok := clause.(bson.D)
+				if !ok {
+					return false, fmt.Errorf("memory: %s entries must be documents", e.Key)
+				}
+				ok, err := matches(doc, sub)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					matched++
+				}
+			}
+			if e.Key == "$and" && matched != len(clauses) {
+				return false, nil
+			}
+			if e.Key == "$or" && matched == 0 {
+				return false, nil
+			}
+			if e.Key == "$nor" && matched > 0 {
+				return false, nil
+			}
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				return false, fmt.Errorf("memory: unsupported top level operator %s", e.Key)
+			}
+			ok, err := matchField(lookup(doc, strings.Split(e.Key, ".")), e.Value)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func isOperatorDoc(v interface{}) bool {
+	d, ok := v.(bson.D)
+	return ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+func matchField(values []interface{}, condition interface{}) (bool, error) {
+	if re, ok := condition.(primitive.Regex); ok {
+		return matchField(values, bson.D{{Key: "$regex", Value: re}})
+	}
+	if !isOperatorDoc(condition) {
+		return anyEqual(values, condition), nil
+	}
+	ops := condition.(bson.D)
+	for _, op := range ops {
+		var ok bool
+		switch op.Key {
+		case "$eq":
+			ok = anyEqual(values, op.Value)
+		case "$ne":
+			ok = !anyEqual(values, op.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = anyCompare(values, op.Value, op.Key)
+		case "$in", "$nin":
+			candidates, isArray := op.Value.(bson.A)
+			if !isArray {
+				return false, fmt.Errorf("memory: %s needs an array", op.Key)
+			}
+			for _, c := range candidates {
+				if anyEqual(values, c) {
+					ok = true
+					break
+				}
+			}
+			if op.Key == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			want, _ := op.Value.(bool)
+			ok = (len(values) > 0) == want
+		case "$regex":
+			options, _ := getField(ops, "$options")
+			re, err := compileRegex(op.Value, options)
+			if err != nil {
+				return false, err
+			}
+			for _, v := range values {
+				if s, isString := v.(string); isString && re.MatchString(s) {
+					ok = true
+					break
+				}
+			}
+		case "$elemMatch":
+			inner, isDoc := op.Value.(bson.D)
+			if !isDoc {
+				return false, fmt.Errorf("memory: $elemMatch needs a document")
+			}
+			for _, v := range values {
+				items, isArray := v.(bson.A)
+				if !isArray {
+					continue
+				}
+				for _, item := range items {
+					doc, isDoc := item.(bson.D)
+					if !isDoc {
+						continue
+					}
+					matched, err := matches(doc, inner)
+					if err != nil {
+						return false, err
+					}
+					if matched {
+						ok = true
+						break
+					}
+				}
+				if ok {
+					break
+				}
+			}
+		case "$options":
+			continue
+		case "$not":
+			inner, err := matchField(values, op.Value)
+			if err != nil {
+				return false, err
+			}
+			ok = !inner
+		default:
+			return false, fmt.Errorf("memory: unsupported operator %s", op.Key)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func compileRegex(pattern interface{}, options interface{}) (*regexp.Regexp, error) {
+	var expr, flags string
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case primitive.Regex:
+		expr, flags = p.Pattern, p.Options
+	default:
+		return nil, errors.New("memory: $regex needs a string")
+	}
+	if o, ok := options.(string); ok {
+		flags += o
+	}
+	if strings.Contains(flags, "i") {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func anyEqual(values []interface{}, want interface{}) bool {
+	if want == nil && len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if equal(v, want) {
+			return true
+		}
+		if arr, ok := v.(bson.A); ok {
+			for _, item := range arr {
+				if equal(item, want) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func anyCompare(values []interface{}, bound interface{}, op string) bool {
+	for _, v := range values {
+		c, ok := compare(v, bound)
+		if !ok {
+			continue
+		}
+		switch {
+		case op == "$gt" && c > 0, op == "$gte" && c >= 0, op == "$lt" && c < 0, op == "$lte" && c <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// typeRank follows the MongoDB comparison order for the BSON types we store.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null:
+		return 1
+	case int32, int64, float64:
+		return 2
+	case string:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	}
+	return 10
+}
+
+// compare orders two scalar values; ok is false when they cannot be compared.
+func compare(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case nil, primitive.Null:
+		return 0, typeRank(b) == 1
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:]), true
+		}
+	case primitive.DateTime:
+		if y, ok := b.(primitive.DateTime); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// sortValue is used by the sort stage, where values of different types still
+// need a stable order.
+func sortValue(a, b interface{}) int {
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	ra, rb := typeRank(a), typeRank(b)
+	switch {
+	case ra < rb:
+		return -1
+	case ra > rb:
+		return 1
+	}
+	return 0
+}
+
+func setPath(doc bson.D, path []string, value interface{}) (bson.D, error) {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc, nil
+		}
+		child, ok := e.Value.(bson.D)
+		if !ok {
+			if e.Value != nil {
+				return nil, fmt.Errorf("memory: cannot create field %s in non-document", path[1])
+			}
+			child = bson.D{}
+		}
+		child, err := setPath(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = child
+		return doc, nil
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: value}), nil
+	}
+	child, err := setPath(bson.D{}, path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	return append(doc, bson.E{Key: path[0], Value: child}), nil
+}
+
+func unsetPath(doc bson.D, path []string) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(doc[:i], doc[i+1:]...)
+		}
+		if child, ok := e.Value.(bson.D); ok {
+			doc[i].Value = unsetPath(child, path[1:])
+		}
+		return doc
+	}
+	return doc
+}
+
+func getPath(doc bson.D, path []string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, key := range path {
+		d, ok := current.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = getField(d, key); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// applyUpdate applies the update operators supported by the in-memory store.
+// insert is true when the document is being created through an upsert.
+func applyUpdate(doc bson.D, update bson.D, insert bool) (bson.D, error) {
+	if len(update) == 0 || !strings.HasPrefix(update[0].Key, "$") {
+		return nil, errors.New("update document must contain key beginning with '$'")
+	}
+	var err error
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory: %s needs a document", op.Key)
+		}
+		for _, f := range fields {
+			path := strings.Split(f.Key, ".")
+			switch op.Key {
+			case "$set":
+				doc, err = setPath(doc, path, f.Value)
+			case "$setOnInsert":
+				if insert {
+					doc, err = setPath(doc, path, f.Value)
+				}
+			case "$unset":
+				doc = unsetPath(doc, path)
+			case "$inc":
+				current, _ := getPath(doc, path)
+				doc, err = setPath(doc, path, increment(current, f.Value))
+			case "$push", "$addToSet":
+				current, _ := getPath(doc, path)
+				arr, _ := current.(bson.A)
+				items := bson.A{f.Value}
+				if each, ok := f.Value.(bson.D); ok {
+					if v, ok := getField(each, "$each"); ok {
+						items, _ = v.(bson.A)
+					}
+				}
+				for _, item := range items {
+					if op.Key == "$addToSet" && anyEqual([]interface{}{arr}, item) {
+						continue
+					}
+					arr = append(arr, item)
+				}
+				doc, err = setPath(doc, path, arr)
+			case "$pull":
+				current, _ := getPath(doc, path)
+				arr, _ := current.(bson.A)
+				kept := bson.A{}
+				for _, item := range arr {
+					var remove bool
+					if cond, ok := f.Value.(bson.D); ok && !isOperatorDoc(cond) {
+						sub, _ := item.(bson.D)
+						remove, err = matches(sub, cond)
+					} else {
+						remove, err = matchField([]interface{}{item}, f.Value)
+					}
+					if err != nil {
+						return nil, err
+					}
+					if !remove {
+						kept = append(kept, item)
+					}
+				}
+				doc, err = setPath(doc, path, kept)
+			default:
+				return nil, fmt.Errorf("memory: unsupported update operator %s", op.Key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+func increment(current, by interface{}) interface{} {
+	switch c := current.(type) {
+	case int32:
+		if b, ok := by.(int32); ok {
+			return c + b
+		}
+	case int64:
+		switch b := by.(type) {
+		case int32:
+			return c + int64(b)
+		case int64:
+			return c + b
+		}
+	case nil:
+		return by
+	}
+	fc, _ := toFloat(current)
+	fb, _ := toFloat(by)
+	return fc + fb
+}
+
+// upsertSeed builds the base document of an upsert from the equality clauses of
+// the filter, as MongoDB does.
+func upsertSeed(filter bson.D) (bson.D, error) {
+	doc := bson.D{}
+	var err error
+	for _, e := range filter {
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		value := e.Value
+		if isOperatorDoc(value) {
+			eq, ok := getField(value.(bson.D), "$eq")
+			if !ok {
+				continue
+			}
+			value = eq
+		}
+		if doc, err = setPath(doc, strings.Split(e.Key, "."), value); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
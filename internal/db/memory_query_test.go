@@ -0,0 +1,547 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testLesson struct {
+	Topic  string `bson:"topic"`
+	Rating int    `bson:"rating"`
+}
+
+type testPerson struct {
+	Id       primitive.ObjectID `bson:"_id"`
+	Name     string             `bson:"name"`
+	Age      int                `bson:"age"`
+	Email    string             `bson:"email,omitempty"`
+	Tags     []string           `bson:"tags"`
+	Address  testAddress        `bson:"address"`
+	Lessons  []testLesson       `bson:"lessons"`
+	JoinedAt time.Time          `bson:"joined_at"`
+}
+
+type testAddress struct {
+	City string `bson:"city"`
+}
+
+var testJoined = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testPeople are stored through InsertOne, so every filter below runs against
+// documents that went through the bson codec.
+func testPeople() []testPerson {
+	return []testPerson{
+		{
+			Id: primitive.NewObjectID(), Name: "ada", Age: 36, Email: "ada@x.io",
+			Tags: []string{"maths", "physics"}, Address: testAddress{City: "London"},
+			Lessons:  []testLesson{{Topic: "algebra", Rating: 5}, {Topic: "calculus", Rating: 3}},
+			JoinedAt: testJoined,
+		},
+		{
+			Id: primitive.NewObjectID(), Name: "bola", Age: 24,
+			Tags: []string{"english"}, Address: testAddress{City: "Lagos"},
+			Lessons:  []testLesson{{Topic: "grammar", Rating: 4}},
+			JoinedAt: testJoined.AddDate(0, 1, 0),
+		},
+		{
+			Id: primitive.NewObjectID(), Name: "chidi", Age: 30, Email: "chidi@x.io",
+			Tags: []string{}, Address: testAddress{City: "lagos"},
+			Lessons:  []testLesson{},
+			JoinedAt: testJoined.AddDate(0, 2, 0),
+		},
+	}
+}
+
+func seedPeople(t *testing.T) (*MemoryDatabase, []testPerson) {
+	t.Helper()
+	mdb := NewMemoryDatabase()
+	people := testPeople()
+	for _, p := range people {
+		if _, err := mdb.InsertOne(context.Background(), p); err != nil {
+			t.Fatalf("insert %s: %v", p.Name, err)
+		}
+	}
+	return mdb, people
+}
+
+func findNames(t *testing.T, mdb *MemoryDatabase, filter interface{}, opts ...*options.FindOptions) []string {
+	t.Helper()
+	cursor, err := mdb.Find(context.Background(), filter, opts...)
+	if err != nil {
+		t.Fatalf("find %v: %v", filter, err)
+	}
+	var found []testPerson
+	if err := cursor.All(context.Background(), &found); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	names := []string{}
+	for _, p := range found {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestMemoryFilterOperators(t *testing.T) {
+	mdb, people := seedPeople(t)
+	tests := []struct {
+		name   string
+		filter interface{}
+		want   []string
+	}{
+		{"implicit equality", bson.M{"name": "ada"}, []string{"ada"}},
+		{"object id", bson.M{"_id": people[1].Id}, []string{"bola"}},
+		{"dotted path", bson.M{"address.city": "Lagos"}, []string{"bola"}},
+		{"array contains", bson.M{"tags": "physics"}, []string{"ada"}},
+		{"array of documents path", bson.M{"lessons.topic": "grammar"}, []string{"bola"}},
+		{"$eq", bson.M{"age": bson.M{"$eq": 30}}, []string{"chidi"}},
+		{"$eq across int types", bson.M{"age": bson.M{"$eq": int64(24)}}, []string{"bola"}},
+		{"$ne", bson.M{"name": bson.M{"$ne": "ada"}}, []string{"bola", "chidi"}},
+		{"$gt", bson.M{"age": bson.M{"$gt": 30}}, []string{"ada"}},
+		{"$gte", bson.M{"age": bson.M{"$gte": 30}}, []string{"ada", "chidi"}},
+		{"$lt", bson.M{"age": bson.M{"$lt": 30}}, []string{"bola"}},
+		{"$lte", bson.M{"age": bson.M{"$lte": 30.0}}, []string{"bola", "chidi"}},
+		{"range", bson.M{"age": bson.M{"$gt": 24, "$lt": 36}}, []string{"chidi"}},
+		{"dates", bson.M{"joined_at": bson.M{"$gt": testJoined}}, []string{"bola", "chidi"}},
+		{"$in", bson.M{"name": bson.M{"$in": []string{"ada", "chidi", "dayo"}}}, []string{"ada", "chidi"}},
+		{"$in on arrays", bson.M{"tags": bson.M{"$in": bson.A{"english", "art"}}}, []string{"bola"}},
+		{"$nin", bson.M{"name": bson.M{"$nin": bson.A{"ada"}}}, []string{"bola", "chidi"}},
+		{"$exists true", bson.M{"email": bson.M{"$exists": true}}, []string{"ada", "chidi"}},
+		{"$exists false", bson.M{"email": bson.M{"$exists": false}}, []string{"bola"}},
+		{"missing equals null", bson.M{"email": nil}, []string{"bola"}},
+		{"$regex", bson.M{"name": bson.M{"$regex": "^[ab]"}}, []string{"ada", "bola"}},
+		{"$regex with $options", bson.M{"address.city": bson.M{"$regex": "^lagos$", "$options": "i"}}, []string{"bola", "chidi"}},
+		{"$regex as primitive.Regex", bson.M{"address.city": primitive.Regex{Pattern: "^LAG", Options: "i"}}, []string{"bola", "chidi"}},
+		{"$regex case sensitive", bson.M{"address.city": bson.M{"$regex": "^lag"}}, []string{"chidi"}},
+		{"$not", bson.M{"age": bson.M{"$not": bson.M{"$gt": 24}}}, []string{"bola"}},
+		{"$elemMatch", bson.M{"lessons": bson.M{"$elemMatch": bson.M{"topic": "calculus", "rating": bson.M{"$gte": 3}}}}, []string{"ada"}},
+		{"$elemMatch needs one element", bson.M{"lessons": bson.M{"$elemMatch": bson.M{"topic": "algebra", "rating": 3}}}, []string{}},
+		{"$and", bson.M{"$and": bson.A{bson.M{"age": bson.M{"$gt": 24}}, bson.M{"email": bson.M{"$exists": true}}}}, []string{"ada", "chidi"}},
+		{"$or", bson.M{"$or": bson.A{bson.M{"name": "ada"}, bson.M{"age": 24}}}, []string{"ada", "bola"}},
+		{"$nor", bson.M{"$nor": bson.A{bson.M{"name": "ada"}, bson.M{"age": 24}}}, []string{"chidi"}},
+		{"empty filter", bson.M{}, []string{"ada", "bola", "chidi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findNames(t, mdb, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryFilterErrors(t *testing.T) {
+	mdb, _ := seedPeople(t)
+	tests := []struct {
+		name   string
+		filter interface{}
+	}{
+		{"unknown operator", bson.M{"age": bson.M{"$mod": bson.A{2, 0}}}},
+		{"unknown top level operator", bson.M{"$where": "true"}},
+		{"$in without array", bson.M{"age": bson.M{"$in": 1}}},
+		{"$or without array", bson.M{"$or": bson.M{"age": 1}}},
+		{"$elemMatch without document", bson.M{"lessons": bson.M{"$elemMatch": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mdb.Find(context.Background(), tt.filter); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMemoryFindOptions(t *testing.T) {
+	mdb, _ := seedPeople(t)
+	tests := []struct {
+		name string
+		opts *options.FindOptions
+		want []string
+	}{
+		{"sort ascending", options.Find().SetSort(bson.D{{Key: "age", Value: 1}}), []string{"bola", "chidi", "ada"}},
+		{"sort descending", options.Find().SetSort(bson.D{{Key: "joined_at", Value: -1}}), []string{"chidi", "bola", "ada"}},
+		{"sort on nested field then name", options.Find().SetSort(bson.D{{Key: "address.city", Value: 1}, {Key: "name", Value: -1}}), []string{"bola", "ada", "chidi"}},
+		{"skip", options.Find().SetSort(bson.D{{Key: "age", Value: 1}}).SetSkip(1), []string{"chidi", "ada"}},
+		{"limit", options.Find().SetSort(bson.D{{Key: "age", Value: 1}}).SetLimit(2), []string{"bola", "chidi"}},
+		{"skip and limit", options.Find().SetSort(bson.D{{Key: "age", Value: 1}}).SetSkip(1).SetLimit(1), []string{"chidi"}},
+		{"skip past the end", options.Find().SetSkip(5), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findNames(t, mdb, bson.M{}, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// findDoc returns the stored document with _id id, normalized for comparison.
+func findDoc(t *testing.T, mdb *MemoryDatabase, id interface{}) bson.D {
+	t.Helper()
+	var doc bson.D
+	if err := mdb.FindOne(context.Background(), bson.M{"_id": id}).Decode(&doc); err != nil {
+		t.Fatalf("find %v: %v", id, err)
+	}
+	doc, err := normalize(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestMemoryUpdateOperators(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    bson.D
+		update interface{}
+		want   bson.D
+	}{
+		{
+			"$set",
+			bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "ada"}},
+			bson.M{"$set": bson.M{"name": "bola", "age": 30}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "bola"}, {Key: "age", Value: 30}},
+		},
+		{
+			"$set dotted path creates documents",
+			bson.D{{Key: "_id", Value: 1}},
+			bson.M{"$set": bson.M{"profile.address.city": "Lagos"}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "profile", Value: bson.D{{Key: "address", Value: bson.D{{Key: "city", Value: "Lagos"}}}}}},
+		},
+		{
+			"$unset",
+			bson.D{{Key: "_id", Value: 1}, {Key: "profile", Value: bson.D{{Key: "bio", Value: "hi"}, {Key: "timezone", Value: "UTC"}}}},
+			bson.M{"$unset": bson.M{"profile.bio": ""}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "profile", Value: bson.D{{Key: "timezone", Value: "UTC"}}}},
+		},
+		{
+			"$inc",
+			bson.D{{Key: "_id", Value: 1}, {Key: "count", Value: 2}},
+			bson.M{"$inc": bson.M{"count": 3, "missing": 1}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "count", Value: 5}, {Key: "missing", Value: 1}},
+		},
+		{
+			"$setOnInsert is ignored on update",
+			bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "ada"}},
+			bson.M{"$setOnInsert": bson.M{"name": "bola"}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "ada"}},
+		},
+		{
+			"$push",
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a"}}},
+			bson.M{"$push": bson.M{"tags": "a"}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a", "a"}}},
+		},
+		{
+			"$push to a missing field",
+			bson.D{{Key: "_id", Value: 1}},
+			bson.M{"$push": bson.M{"tags": "a"}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a"}}},
+		},
+		{
+			"$push $each",
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a"}}},
+			bson.M{"$push": bson.M{"tags": bson.M{"$each": bson.A{"b", "c"}}}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a", "b", "c"}}},
+		},
+		{
+			"$addToSet",
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a"}}},
+			bson.M{"$addToSet": bson.M{"tags": "a"}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a"}}},
+		},
+		{
+			"$addToSet $each",
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a"}}},
+			bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": bson.A{"a", "b"}}}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a", "b"}}},
+		},
+		{
+			"$addToSet object ids",
+			bson.D{{Key: "_id", Value: 1}, {Key: "ids", Value: bson.A{primitive.ObjectID{1}}}},
+			bson.M{"$addToSet": bson.M{"ids": primitive.ObjectID{1}}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "ids", Value: bson.A{primitive.ObjectID{1}}}},
+		},
+		{
+			"$pull value",
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"a", "b", "a"}}},
+			bson.M{"$pull": bson.M{"tags": "a"}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "tags", Value: bson.A{"b"}}},
+		},
+		{
+			"$pull condition",
+			bson.D{{Key: "_id", Value: 1}, {Key: "scores", Value: bson.A{1, 5, 9}}},
+			bson.M{"$pull": bson.M{"scores": bson.M{"$gte": 5}}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "scores", Value: bson.A{1}}},
+		},
+		{
+			"$pull matching documents",
+			bson.D{{Key: "_id", Value: 1}, {Key: "lessons", Value: bson.A{
+				bson.D{{Key: "topic", Value: "algebra"}, {Key: "rating", Value: 5}},
+				bson.D{{Key: "topic", Value: "grammar"}, {Key: "rating", Value: 2}},
+			}}},
+			bson.M{"$pull": bson.M{"lessons": bson.M{"rating": bson.M{"$lt": 3}}}},
+			bson.D{{Key: "_id", Value: 1}, {Key: "lessons", Value: bson.A{
+				bson.D{{Key: "topic", Value: "algebra"}, {Key: "rating", Value: 5}},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdb := NewMemoryDatabase()
+			if _, err := mdb.InsertOne(context.Background(), tt.doc); err != nil {
+				t.Fatal(err)
+			}
+			result, err := mdb.UpdateOne(context.Background(), bson.M{"_id": 1}, tt.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MatchedCount != 1 {
+				t.Errorf("matched %d documents, want 1", result.MatchedCount)
+			}
+			want, err := normalize(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := findDoc(t, mdb, 1); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMemoryUpdateErrors(t *testing.T) {
+	mdb := NewMemoryDatabase()
+	if _, err := mdb.InsertOne(context.Background(), bson.M{"_id": 1, "name": "ada"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		update interface{}
+	}{
+		{"replacement document", bson.M{"name": "bola"}},
+		{"unknown operator", bson.M{"$rename": bson.M{"name": "first_name"}}},
+		{"field in a non-document", bson.M{"$set": bson.M{"name.first": "ada"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mdb.UpdateOne(context.Background(), bson.M{"_id": 1}, tt.update); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMemoryUpdateNoMatch(t *testing.T) {
+	mdb := NewMemoryDatabase()
+	result, err := mdb.UpdateOne(context.Background(), bson.M{"_id": 1}, bson.M{"$set": bson.M{"name": "ada"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MatchedCount != 0 || result.ModifiedCount != 0 || result.UpsertedCount != 0 {
+		t.Errorf("got %+v, want nothing matched", result)
+	}
+}
+
+func TestMemoryUpdateModifiedCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		update   bson.M
+		modified int64
+	}{
+		{"new value", bson.M{"$set": bson.M{"name": "grace"}}, 1},
+		{"same value", bson.M{"$set": bson.M{"name": "ada"}}, 0},
+		{"same nested value", bson.M{"$set": bson.M{"address.city": "london"}}, 0},
+		{"new field", bson.M{"$set": bson.M{"age": int32(36)}}, 1},
+		{"unset missing field", bson.M{"$unset": bson.M{"age": ""}}, 0},
+		{"pull missing value", bson.M{"$pull": bson.M{"tags": "c"}}, 0},
+		{"add existing value to set", bson.M{"$addToSet": bson.M{"tags": "a"}}, 0},
+		{"inc by zero", bson.M{"$inc": bson.M{"logins": int32(0)}}, 0},
+		{"inc", bson.M{"$inc": bson.M{"logins": int32(1)}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdb := NewMemoryDatabase()
+			doc := bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "ada"}, {Key: "address", Value: bson.D{{Key: "city", Value: "london"}}}, {Key: "tags", Value: bson.A{"a", "b"}}, {Key: "logins", Value: int32(2)}}
+			if _, err := mdb.InsertOne(context.Background(), doc); err != nil {
+				t.Fatal(err)
+			}
+			result, err := mdb.UpdateOne(context.Background(), bson.M{"_id": 1}, tt.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MatchedCount != 1 || result.ModifiedCount != tt.modified {
+				t.Errorf("got %+v, want 1 matched and %d modified", result, tt.modified)
+			}
+		})
+	}
+}
+
+func TestMemoryUpsert(t *testing.T) {
+	mdb := NewMemoryDatabase()
+	filter := bson.M{"email": "ada@x.io", "role": bson.M{"$eq": "student"}, "age": bson.M{"$gt": 1}}
+	update := bson.M{
+		"$set":         bson.M{"name": "ada"},
+		"$setOnInsert": bson.M{"created": true},
+		"$inc":         bson.M{"logins": 1},
+	}
+	upsert := options.Update().SetUpsert(true)
+
+	result, err := mdb.UpdateOne(context.Background(), filter, update, upsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UpsertedCount != 1 || result.UpsertedID == nil {
+		t.Fatalf("got %+v, want one upserted document", result)
+	}
+	id := result.UpsertedID
+	doc := findDoc(t, mdb, id)
+	// the seed keeps the equality clauses of the filter, not the ranges
+	for key, want := range map[string]interface{}{"email": "ada@x.io", "role": "student", "name": "ada", "created": true, "logins": int32(1)} {
+		if got, _ := getField(doc, key); !equal(got, want) {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if _, ok := getField(doc, "age"); ok {
+		t.Error("age should not be seeded from a range")
+	}
+
+	if _, err := mdb.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{"age": 36}}); err != nil {
+		t.Fatal(err)
+	}
+	result, err = mdb.UpdateOne(context.Background(), filter, bson.M{"$setOnInsert": bson.M{"created": false}, "$inc": bson.M{"logins": 1}}, upsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MatchedCount != 1 || result.UpsertedCount != 0 {
+		t.Fatalf("got %+v, want the existing document updated", result)
+	}
+	doc = findDoc(t, mdb, id)
+	if got, _ := getField(doc, "created"); got != true {
+		t.Errorf("created = %v, $setOnInsert must not run on update", got)
+	}
+	if got, _ := getField(doc, "logins"); !equal(got, int32(2)) {
+		t.Errorf("logins = %v, want 2", got)
+	}
+}
+
+func TestMemoryDelete(t *testing.T) {
+	mdb, people := seedPeople(t)
+	result, err := mdb.DeleteOne(context.Background(), bson.M{"_id": people[0].Id})
+	if err != nil || result.DeletedCount != 1 {
+		t.Fatalf("delete one: %+v, %v", result, err)
+	}
+	result, err = mdb.DeleteMany(context.Background(), bson.M{"address.city": bson.M{"$regex": "^lagos$", "$options": "i"}})
+	if err != nil || result.DeletedCount != 2 {
+		t.Fatalf("delete many: %+v, %v", result, err)
+	}
+	if got := findNames(t, mdb, bson.M{}); len(got) != 0 {
+		t.Errorf("left %v", got)
+	}
+}
+
+func TestMemoryUniqueIndex(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemoryDatabase()
+	_, err := mdb.CreateIndex(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "student_id", Value: 1}, {Key: "tutor_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	student, tutor, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	if _, err := mdb.InsertOne(ctx, bson.M{"_id": 1, "student_id": student, "tutor_id": tutor}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.InsertOne(ctx, bson.M{"_id": 2, "student_id": student, "tutor_id": other}); err != nil {
+		t.Fatalf("a different key must be accepted: %v", err)
+	}
+
+	_, err = mdb.InsertOne(ctx, bson.M{"_id": 3, "student_id": student, "tutor_id": tutor})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("insert: got %v, want a duplicate key error", err)
+	}
+	_, err = mdb.InsertMany(ctx, []interface{}{bson.M{"_id": 4, "student_id": other, "tutor_id": tutor}, bson.M{"_id": 5, "student_id": other, "tutor_id": tutor}})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("insert many: got %v, want a duplicate key error", err)
+	}
+	_, err = mdb.InsertOne(ctx, bson.M{"_id": 1})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("insert with a used _id: got %v, want a duplicate key error", err)
+	}
+
+	_, err = mdb.UpdateOne(ctx, bson.M{"_id": 2}, bson.M{"$set": bson.M{"tutor_id": tutor}})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("update: got %v, want a duplicate key error", err)
+	}
+	if got, _ := getField(findDoc(t, mdb, 2), "tutor_id"); !equal(got, other) {
+		t.Error("a rejected update must leave the document unchanged")
+	}
+	if _, err := mdb.UpdateOne(ctx, bson.M{"_id": 1}, bson.M{"$set": bson.M{"note": "x"}}); err != nil {
+		t.Errorf("a document must not conflict with itself: %v", err)
+	}
+	_, err = mdb.UpdateOne(ctx, bson.M{"_id": 9, "student_id": student, "tutor_id": tutor}, bson.M{"$set": bson.M{"note": "x"}}, options.Update().SetUpsert(true))
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("upsert: got %v, want a duplicate key error", err)
+	}
+
+	// missing fields are indexed as null, so only one document may lack them
+	if _, err := mdb.InsertOne(ctx, bson.M{"_id": 6}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.InsertOne(ctx, bson.M{"_id": 7}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("missing keys: got %v, want a duplicate key error", err)
+	}
+}
+
+func TestMemoryUniqueIndexOnExistingDuplicates(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemoryDatabase()
+	for i := 0; i < 2; i++ {
+		if _, err := mdb.InsertOne(ctx, bson.M{"email": "ada@x.io"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := mdb.CreateIndex(ctx, mongo.IndexModel{Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true)})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("got %v, want a duplicate key error", err)
+	}
+}
+
+func TestMemoryTTLIndex(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemoryDatabase()
+	_, err := mdb.CreateIndex(ctx, mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []interface{}{
+		bson.M{"name": "expired", "expires_at": time.Now().Add(-time.Minute)},
+		bson.M{"name": "live", "expires_at": time.Now().Add(time.Hour)},
+		bson.M{"name": "no date"},
+	}
+	if _, err := mdb.InsertMany(ctx, docs); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := mdb.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].Name != "live" || found[1].Name != "no date" {
+		t.Errorf("got %v, want the expired document gone", found)
+	}
+}
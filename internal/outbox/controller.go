@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxController struct {
+	outboxService IOutboxService
+}
+
+func NewOutboxController(outboxService IOutboxService) *OutboxController {
+	return &OutboxController{outboxService: outboxService}
+}
+
+func (oc *OutboxController) GetMessages(c *gin.Context) {
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	status := Status(c.Query("status"))
+	switch status {
+	case "", Pending, Sending, Sent, Dead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid status"}})
+		return
+	}
+	messages, err := oc.outboxService.GetMessages(status, c.Query("to"), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"emails": messages,
+		"page":   req.Page,
+		"limit":  req.Limit,
+	}, "emails retrieved successfully"))
+}
+
+func (oc *OutboxController) GetMessage(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid email id"}})
+		return
+	}
+	message, err := oc.outboxService.GetMessage(id)
+	if err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(message, "email retrieved successfully"))
+}
+
+func (oc *OutboxController) RetryMessage(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid email id"}})
+		return
+	}
+	message, err := oc.outboxService.RetryMessage(id)
+	if err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(message, "email queued for delivery"))
+}
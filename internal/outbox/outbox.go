@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Status string
+
+const (
+	Pending Status = "pending"
+	Sending Status = "sending"
+	Sent    Status = "sent"
+	// Dead messages ran out of delivery attempts and wait for an admin to retry
+	// them.
+	Dead Status = "dead"
+)
+
+// Message is an email waiting in, or delivered from, the outbox. The bodies
+// carry verification links, so they are never included in API responses.
+type Message struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FromName      string             `json:"from_name" bson:"from_name"`
+	FromEmail     string             `json:"from_email" bson:"from_email"`
+	ToName        string             `json:"to_name" bson:"to_name"`
+	ToEmail       string             `json:"to_email" bson:"to_email"`
+	Subject       string             `json:"subject" bson:"subject"`
+	Text          string             `json:"-" bson:"text"`
+	HTML          string             `json:"-" bson:"html"`
+	Status        Status             `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	LastError     string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil   *time.Time         `json:"-" bson:"locked_until,omitempty"`
+	SentAt        *time.Time         `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OutboxRepo struct {
+	db db.IDatabase
+}
+
+func NewOutboxRepo(db db.IDatabase) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+func (obr *OutboxRepo) CreateMessage(message *Message) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := obr.db.InsertOne(ctx, message)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (obr *OutboxRepo) UpdateMessage(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := obr.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClaimMessage applies update if filter still matches and reports whether it
+// did, so only one worker picks up a message.
+func (obr *OutboxRepo) ClaimMessage(filter interface{}, update interface{}) (bool, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	res, err := obr.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (obr *OutboxRepo) GetMessage(filter interface{}) (*Message, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var message Message
+	err := obr.db.FindOne(ctx, filter).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (obr *OutboxRepo) GetMessages(filter interface{}, opts ...*options.FindOptions) ([]*Message, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	messages := []*Message{}
+	cursor, err := obr.db.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &messages)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+type IOutboxRepo interface {
+	CreateMessage(message *Message) error
+	UpdateMessage(filter interface{}, update interface{}) error
+	ClaimMessage(filter interface{}, update interface{}) (bool, error)
+	GetMessage(filter interface{}) (*Message, error)
+	GetMessages(filter interface{}, opts ...*options.FindOptions) ([]*Message, error)
+}
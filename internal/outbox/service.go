@@ -0,0 +1,226 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrMessageNotFound = errors.New("message not found")
+
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int64
+	MaxAttempts  int
+	// the n-th retry waits BaseBackoff * 2^(n-1), capped at MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// LockTimeout is how long a claimed message may stay in sending before
+	// another worker assumes the first one died and takes it over.
+	LockTimeout time.Duration
+}
+
+// OutboxService stores emails and delivers them in the background through
+// the configured transport. It is a utils.Mailer, so EmailManager enqueues
+// instead of sending inside the request.
+type OutboxService struct {
+	outboxRepo IOutboxRepo
+	mailer     utils.Mailer
+	config     OutboxConfig
+	wake       chan struct{}
+}
+
+func NewOutboxService(outboxRepo IOutboxRepo, mailer utils.Mailer, config OutboxConfig) *OutboxService {
+	return &OutboxService{outboxRepo: outboxRepo, mailer: mailer, config: config, wake: make(chan struct{}, 1)}
+}
+
+func (obs *OutboxService) Send(message *utils.EmailMessage) error {
+	now := time.Now()
+	err := obs.outboxRepo.CreateMessage(&Message{
+		FromName:      message.FromName,
+		FromEmail:     message.FromEmail,
+		ToName:        message.ToName,
+		ToEmail:       message.ToEmail,
+		Subject:       message.Subject,
+		Text:          message.Text,
+		HTML:          message.HTML,
+		Status:        Pending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case obs.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers due messages until ctx is cancelled. New messages wake the
+// worker immediately; retries are picked up on the next poll.
+func (obs *OutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(obs.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := obs.deliverDue()
+			if err != nil {
+				log.Println("email outbox error: ", err)
+				break
+			}
+			if n < obs.config.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-obs.wake:
+		}
+	}
+}
+
+// deliverDue attempts one batch of due messages and returns how many were
+// found.
+func (obs *OutboxService) deliverDue() (int64, error) {
+	now := time.Now()
+	due := bson.M{"$or": bson.A{
+		bson.M{"status": Pending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"status": Sending, "locked_until": bson.M{"$lte": now}},
+	}}
+	messages, err := obs.outboxRepo.GetMessages(due, options.Find().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetLimit(obs.config.BatchSize))
+	if err != nil {
+		return 0, err
+	}
+	for _, message := range messages {
+		lockedUntil := time.Now().Add(obs.config.LockTimeout)
+		claimed, err := obs.outboxRepo.ClaimMessage(
+			bson.M{"_id": message.Id, "status": message.Status, "attempts": message.Attempts},
+			bson.M{"$set": bson.M{"status": Sending, "locked_until": lockedUntil, "updated_at": time.Now()}, "$inc": bson.M{"attempts": 1}},
+		)
+		if err != nil {
+			return 0, err
+		}
+		if !claimed {
+			continue
+		}
+		message.Attempts++
+		if err := obs.deliver(message); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(messages)), nil
+}
+
+func (obs *OutboxService) deliver(message *Message) error {
+	sendErr := obs.mailer.Send(&utils.EmailMessage{
+		FromName:  message.FromName,
+		FromEmail: message.FromEmail,
+		ToName:    message.ToName,
+		ToEmail:   message.ToEmail,
+		Subject:   message.Subject,
+		Text:      message.Text,
+		HTML:      message.HTML,
+	})
+	now := time.Now()
+	if sendErr == nil {
+		return obs.outboxRepo.UpdateMessage(bson.M{"_id": message.Id}, bson.M{
+			"$set":   bson.M{"status": Sent, "sent_at": now, "updated_at": now},
+			"$unset": bson.M{"locked_until": "", "last_error": ""},
+		})
+	}
+	log.Printf("email delivery to %s failed (attempt %d): %v\n", message.ToEmail, message.Attempts, sendErr)
+	update := bson.M{"last_error": sendErr.Error(), "updated_at": now}
+	if message.Attempts >= obs.config.MaxAttempts {
+		update["status"] = Dead
+	} else {
+		update["status"] = Pending
+		update["next_attempt_at"] = now.Add(obs.backoff(message.Attempts))
+	}
+	return obs.outboxRepo.UpdateMessage(bson.M{"_id": message.Id}, bson.M{
+		"$set":   update,
+		"$unset": bson.M{"locked_until": ""},
+	})
+}
+
+func (obs *OutboxService) backoff(attempts int) time.Duration {
+	delay := obs.config.BaseBackoff
+	for i := 1; i < attempts && delay < obs.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > obs.config.MaxBackoff {
+		delay = obs.config.MaxBackoff
+	}
+	return delay
+}
+
+func (obs *OutboxService) GetMessages(status Status, to string, req *utils.ListReq) ([]*Message, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if to != "" {
+		filter["to_email"] = to
+	}
+	return obs.outboxRepo.GetMessages(filter, req.Paginate(bson.D{{Key: "created_at", Value: -1}}))
+}
+
+func (obs *OutboxService) GetMessage(id primitive.ObjectID) (*Message, error) {
+	message, err := obs.outboxRepo.GetMessage(bson.M{"_id": id})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// RetryMessage puts a dead message back in the queue with a fresh set of
+// attempts.
+func (obs *OutboxService) RetryMessage(id primitive.ObjectID) (*Message, error) {
+	message, err := obs.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+	if message.Status != Dead {
+		return nil, errors.New("only dead messages can be retried")
+	}
+	now := time.Now()
+	claimed, err := obs.outboxRepo.ClaimMessage(bson.M{"_id": id, "status": Dead}, bson.M{"$set": bson.M{
+		"status":          Pending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errors.New("only dead messages can be retried")
+	}
+	select {
+	case obs.wake <- struct{}{}:
+	default:
+	}
+	return obs.GetMessage(id)
+}
+
+type IOutboxService interface {
+	GetMessages(status Status, to string, req *utils.ListReq) ([]*Message, error)
+	GetMessage(id primitive.ObjectID) (*Message, error)
+	RetryMessage(id primitive.ObjectID) (*Message, error)
+}
@@ -0,0 +1,124 @@
+package rbac
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RoleController struct {
+	roleService IRoleService
+}
+
+func NewRoleController(roleService IRoleService) *RoleController {
+	return &RoleController{roleService: roleService}
+}
+
+func (rc *RoleController) GetRoles(c *gin.Context) {
+	roles, err := rc.roleService.GetRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"roles":       roles,
+		"permissions": Permissions,
+	}, "roles retrieved successfully"))
+}
+
+func (rc *RoleController) SaveRole(c *gin.Context) {
+	req := struct {
+		Permissions []Permission `json:"permissions" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	role, err := rc.roleService.SaveRole(user.Role(c.Param("name")), req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(role, "role saved successfully"))
+}
+
+func (rc *RoleController) SetTwoFactorRequired(c *gin.Context) {
+	req := struct {
+		Required *bool `json:"required" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	role, err := rc.roleService.SetTwoFactorRequired(user.Role(c.Param("name")), *req.Required)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	message := "two-factor authentication is no longer required for " + string(role.Name)
+	if role.RequireTwoFactor {
+		message = "two-factor authentication is now required for " + string(role.Name)
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(role, message))
+}
+
+func (rc *RoleController) SetMagicLinkAllowed(c *gin.Context) {
+	req := struct {
+		Allowed *bool `json:"allowed" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	role, err := rc.roleService.SetMagicLinkAllowed(user.Role(c.Param("name")), *req.Allowed)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	message := "magic link login is now disabled for " + string(role.Name)
+	if role.AllowMagicLink {
+		message = "magic link login is now enabled for " + string(role.Name)
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(role, message))
+}
+
+func (rc *RoleController) SetUserRoles(c *gin.Context) {
+	userId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return
+	}
+	req := struct {
+		Roles []user.Role `json:"roles" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	u, err := rc.roleService.SetUserRoles(userId, req.Roles)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"id":    userId,
+		"email": u.Email,
+		"roles": u.Roles,
+	}, "user roles updated successfully"))
+}
@@ -0,0 +1,81 @@
+package rbac
+
+import (
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+)
+
+// Permission is one action a role grants, named resource:action.
+type Permission string
+
+const (
+	// the portal permissions let an account use the endpoints for its own
+	// student, tutor or admin profile
+	StudentPortal Permission = "portal:student"
+	TutorPortal   Permission = "portal:tutor"
+	AdminPortal   Permission = "portal:admin"
+
+	SubjectsCreate  Permission = "subjects:create"
+	SubjectsUpdate  Permission = "subjects:update"
+	StudentsRead    Permission = "students:read"
+	StudentsSuspend Permission = "students:suspend"
+	TutorsRead      Permission = "tutors:read"
+	TutorsApprove   Permission = "tutors:approve"
+	TutorsSuspend   Permission = "tutors:suspend"
+	ReviewsRead     Permission = "reviews:read"
+	ReviewsModerate Permission = "reviews:moderate"
+	EmailsRead      Permission = "emails:read"
+	EmailsRetry     Permission = "emails:retry"
+	AccountsRead    Permission = "accounts:read"
+	AccountsUnlock  Permission = "accounts:unlock"
+	RolesManage     Permission = "roles:manage"
+	ApiKeysManage   Permission = "apikeys:manage"
+)
+
+// Permissions lists every permission a role can be given.
+var Permissions = []Permission{
+	StudentPortal, TutorPortal, AdminPortal,
+	SubjectsCreate, SubjectsUpdate,
+	StudentsRead, StudentsSuspend,
+	TutorsRead, TutorsApprove, TutorsSuspend,
+	ReviewsRead, ReviewsModerate,
+	EmailsRead, EmailsRetry,
+	AccountsRead, AccountsUnlock,
+	RolesManage,
+	ApiKeysManage,
+}
+
+// DefaultRoles are the built-in roles and the permissions they always have.
+// Admins can grant them more but not take these away.
+var DefaultRoles = map[user.Role][]Permission{
+	user.Student: {StudentPortal},
+	user.Tutor:   {TutorPortal},
+	user.Admin:   Permissions[2:],
+}
+
+// RoleDefinition maps a role to its permissions. Role definitions are stored
+// in the database so admins can change them and add roles such as a
+// moderator without a deploy.
+type RoleDefinition struct {
+	Name        user.Role    `json:"name" bson:"_id"`
+	Permissions []Permission `json:"permissions" bson:"permissions"`
+	BuiltIn     bool         `json:"built_in" bson:"built_in"`
+	// RequireTwoFactor makes accounts with this role enroll in two-factor
+	// authentication before they can sign in.
+	RequireTwoFactor bool `json:"require_two_factor" bson:"require_two_factor"`
+	// AllowMagicLink lets accounts with this role log in with an emailed link
+	// instead of their password.
+	AllowMagicLink bool      `json:"allow_magic_link" bson:"allow_magic_link"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+func isPermission(p Permission) bool {
+	for _, known := range Permissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package rbac
+
+import (
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RoleRepo struct {
+	db db.IDatabase
+}
+
+func NewRoleRepo(db db.IDatabase) *RoleRepo {
+	return &RoleRepo{db: db}
+}
+
+// SaveRole applies update to the role matching filter, creating it if needed.
+func (rr *RoleRepo) SaveRole(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := rr.db.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rr *RoleRepo) GetRole(filter interface{}) (*RoleDefinition, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var role RoleDefinition
+	err := rr.db.FindOne(ctx, filter).Decode(&role)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (rr *RoleRepo) GetRoles(filter interface{}, opts ...*options.FindOptions) ([]*RoleDefinition, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	roles := []*RoleDefinition{}
+	cursor, err := rr.db.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &roles)
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+type IRoleRepo interface {
+	SaveRole(filter interface{}, update interface{}) error
+	GetRole(filter interface{}) (*RoleDefinition, error)
+	GetRoles(filter interface{}, opts ...*options.FindOptions) ([]*RoleDefinition, error)
+}
@@ -0,0 +1,242 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+var roleName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+type RoleService struct {
+	roleRepo           IRoleRepo
+	userRepo           user.IUserRepo
+	accessTokenManager utils.IAccessTokenManager
+}
+
+// NewRoleService makes sure the built-in roles exist with at least their
+// default permissions.
+func NewRoleService(roleRepo IRoleRepo, userRepo user.IUserRepo, accessTokenManager utils.IAccessTokenManager) (*RoleService, error) {
+	for name, permissions := range DefaultRoles {
+		err := roleRepo.SaveRole(bson.M{"_id": name}, bson.M{
+			"$set":         bson.M{"built_in": true},
+			"$setOnInsert": bson.M{"created_at": time.Now(), "updated_at": time.Now()},
+			"$addToSet":    bson.M{"permissions": bson.M{"$each": permissions}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &RoleService{roleRepo: roleRepo, userRepo: userRepo, accessTokenManager: accessTokenManager}, nil
+}
+
+func (rs *RoleService) GetRoles() ([]*RoleDefinition, error) {
+	return rs.roleRepo.GetRoles(bson.M{}, options.Find().SetSort(bson.D{primitive.E{Key: "_id", Value: 1}}))
+}
+
+// SaveRole creates the role or replaces its permissions. Built-in roles keep
+// their default permissions.
+func (rs *RoleService) SaveRole(name user.Role, permissions []Permission) (*RoleDefinition, error) {
+	if !roleName.MatchString(string(name)) {
+		return nil, errors.New("role name must be lowercase letters, digits, - or _ and at most 32 characters")
+	}
+	permissions = uniquePermissions(permissions)
+	for _, p := range permissions {
+		if !isPermission(p) {
+			return nil, errors.New("unknown permission: " + string(p))
+		}
+	}
+	for _, p := range DefaultRoles[name] {
+		if !hasPermission(permissions, p) {
+			return nil, errors.New("built-in role " + string(name) + " must keep permission " + string(p))
+		}
+	}
+	err := rs.roleRepo.SaveRole(bson.M{"_id": name}, bson.M{
+		"$set":         bson.M{"permissions": permissions, "updated_at": time.Now()},
+		"$setOnInsert": bson.M{"built_in": false, "created_at": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rs.roleRepo.GetRole(bson.M{"_id": name})
+}
+
+// SetTwoFactorRequired turns the two-factor requirement of a role on or off.
+// Users with the role who have not enrolled are asked to at their next login,
+// and their current sessions stop refreshing.
+func (rs *RoleService) SetTwoFactorRequired(name user.Role, required bool) (*RoleDefinition, error) {
+	if _, err := rs.roleRepo.GetRole(bson.M{"_id": name}); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	err := rs.roleRepo.SaveRole(bson.M{"_id": name}, bson.M{"$set": bson.M{"require_two_factor": required, "updated_at": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	return rs.roleRepo.GetRole(bson.M{"_id": name})
+}
+
+// SetMagicLinkAllowed turns magic link login for a role on or off. Links that
+// were already sent stop working once it is off.
+func (rs *RoleService) SetMagicLinkAllowed(name user.Role, allowed bool) (*RoleDefinition, error) {
+	if _, err := rs.roleRepo.GetRole(bson.M{"_id": name}); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	err := rs.roleRepo.SaveRole(bson.M{"_id": name}, bson.M{"$set": bson.M{"allow_magic_link": allowed, "updated_at": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	return rs.roleRepo.GetRole(bson.M{"_id": name})
+}
+
+// MagicLinkAllowed reports whether every one of roles allows magic link login,
+// so a role that does not allow it cannot be reached through another one.
+func (rs *RoleService) MagicLinkAllowed(roles []user.Role) (bool, error) {
+	roles = uniqueRoles(roles)
+	definitions, err := rs.roleRepo.GetRoles(bson.M{"_id": bson.M{"$in": roles}, "allow_magic_link": true})
+	if err != nil {
+		return false, err
+	}
+	return len(roles) > 0 && len(definitions) == len(roles), nil
+}
+
+// TwoFactorRequired reports whether any of roles requires two-factor
+// authentication.
+func (rs *RoleService) TwoFactorRequired(roles []user.Role) (bool, error) {
+	definitions, err := rs.roleRepo.GetRoles(bson.M{"_id": bson.M{"$in": roles}, "require_two_factor": true})
+	if err != nil {
+		return false, err
+	}
+	return len(definitions) > 0, nil
+}
+
+// SetUserRoles replaces the roles of a user. Every user keeps the role they
+// signed up with, and the student and tutor roles cannot be granted on top of
+// another one since they need a profile. Sessions are ended when roles are
+// taken away; roles that are added show up at the next token refresh.
+func (rs *RoleService) SetUserRoles(userId primitive.ObjectID, roles []user.Role) (*user.User, error) {
+	u, err := rs.userRepo.GetUser(bson.M{"_id": userId})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	roles = uniqueRoles(roles)
+	if !hasRole(roles, u.Role) {
+		return nil, errors.New("user must keep the " + string(u.Role) + " role")
+	}
+	for _, role := range roles {
+		if role != u.Role && (role == user.Student || role == user.Tutor) {
+			return nil, errors.New("the " + string(role) + " role cannot be granted to another account")
+		}
+		if _, err := rs.roleRepo.GetRole(bson.M{"_id": role}); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+			}
+			return nil, err
+		}
+	}
+	removed := false
+	for _, role := range u.GetRoles() {
+		if !hasRole(roles, role) {
+			removed = true
+		}
+	}
+	if err := rs.userRepo.UpdateUser(bson.M{"_id": userId}, bson.M{"$set": bson.M{"roles": roles, "updated_at": time.Now()}}); err != nil {
+		return nil, err
+	}
+	if removed {
+		if _, err := rs.accessTokenManager.DeleteAccessTokens(bson.M{"user_id": userId}); err != nil {
+			return nil, err
+		}
+	}
+	u.Roles = roles
+	return u, nil
+}
+
+// Permissions returns every permission granted by any of roles, sorted.
+func (rs *RoleService) Permissions(roles []user.Role) ([]Permission, error) {
+	definitions, err := rs.roleRepo.GetRoles(bson.M{"_id": bson.M{"$in": roles}})
+	if err != nil {
+		return nil, err
+	}
+	permissions := []Permission{}
+	for _, definition := range definitions {
+		permissions = append(permissions, definition.Permissions...)
+	}
+	permissions = uniquePermissions(permissions)
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions, nil
+}
+
+func uniquePermissions(permissions []Permission) []Permission {
+	unique := []Permission{}
+	for _, p := range permissions {
+		if !hasPermission(unique, p) {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+func hasPermission(permissions []Permission, p Permission) bool {
+	for _, have := range permissions {
+		if have == p {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueRoles(roles []user.Role) []user.Role {
+	unique := []user.Role{}
+	for _, role := range roles {
+		if !hasRole(unique, role) {
+			unique = append(unique, role)
+		}
+	}
+	return unique
+}
+
+func hasRole(roles []user.Role, role user.Role) bool {
+	for _, have := range roles {
+		if have == role {
+			return true
+		}
+	}
+	return false
+}
+
+type IRoleService interface {
+	GetRoles() ([]*RoleDefinition, error)
+	SaveRole(name user.Role, permissions []Permission) (*RoleDefinition, error)
+	SetUserRoles(userId primitive.ObjectID, roles []user.Role) (*user.User, error)
+	SetTwoFactorRequired(name user.Role, required bool) (*RoleDefinition, error)
+	SetMagicLinkAllowed(name user.Role, allowed bool) (*RoleDefinition, error)
+}
+
+type IAuthRoleService interface {
+	Permissions(roles []user.Role) ([]Permission, error)
+	TwoFactorRequired(roles []user.Role) (bool, error)
+	MagicLinkAllowed(roles []user.Role) (bool, error)
+}
@@ -0,0 +1,193 @@
+package review
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReviewController struct {
+	reviewService IReviewService
+}
+
+func NewReviewController(reviewService IReviewService) *ReviewController {
+	return &ReviewController{reviewService: reviewService}
+}
+
+func reviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrReviewNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, ErrInvalidRating):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, ErrAlreadyReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+	}
+}
+
+func (rc *ReviewController) CreateReview(c *gin.Context) {
+	tutorId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid tutor id"}})
+		return
+	}
+	req := struct {
+		Rating int    `json:"rating" binding:"required"`
+		Text   string `json:"text" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	review := &Review{
+		TutorId:   tutorId,
+		StudentId: c.MustGet("user_id").(primitive.ObjectID),
+		Rating:    req.Rating,
+		Text:      req.Text,
+	}
+	if err := rc.reviewService.CreateReview(review); err != nil {
+		reviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(review, "review created successfully"))
+}
+
+func (rc *ReviewController) UpdateReview(c *gin.Context) {
+	reviewId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid review id"}})
+		return
+	}
+	req := struct {
+		Rating int    `json:"rating" binding:"required"`
+		Text   string `json:"text" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	studentId := c.MustGet("user_id").(primitive.ObjectID)
+	review, err := rc.reviewService.UpdateReview(studentId, reviewId, req.Rating, req.Text)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(review, "review updated successfully"))
+}
+
+func (rc *ReviewController) DeleteReview(c *gin.Context) {
+	reviewId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid review id"}})
+		return
+	}
+	studentId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := rc.reviewService.DeleteReview(studentId, reviewId); err != nil {
+		reviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, "review deleted successfully"))
+}
+
+func (rc *ReviewController) ReplyToReview(c *gin.Context) {
+	reviewId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid review id"}})
+		return
+	}
+	req := struct {
+		Text string `json:"text" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	tutorId := c.MustGet("user_id").(primitive.ObjectID)
+	review, err := rc.reviewService.ReplyToReview(tutorId, reviewId, req.Text)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(review, "reply saved successfully"))
+}
+
+func (rc *ReviewController) GetTutorReviews(c *gin.Context) {
+	tutorId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid tutor id"}})
+		return
+	}
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	reviews, err := rc.reviewService.GetTutorReviews(tutorId, &req)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"reviews": reviews,
+		"page":    req.Page,
+		"limit":   req.Limit,
+	}, "reviews retrieved successfully"))
+}
+
+func (rc *ReviewController) GetReviews(c *gin.Context) {
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	var hidden *bool
+	if h := c.Query("hidden"); h != "" {
+		value, err := strconv.ParseBool(h)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid hidden value"}})
+			return
+		}
+		hidden = &value
+	}
+	reviews, err := rc.reviewService.GetReviews(hidden, &req)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"reviews": reviews,
+		"page":    req.Page,
+		"limit":   req.Limit,
+	}, "reviews retrieved successfully"))
+}
+
+func (rc *ReviewController) SetReviewHidden(c *gin.Context) {
+	reviewId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid review id"}})
+		return
+	}
+	req := struct {
+		Hidden *bool  `json:"hidden" binding:"required"`
+		Reason string `json:"reason"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := rc.reviewService.SetReviewHidden(reviewId, *req.Hidden, req.Reason); err != nil {
+		reviewError(c, err)
+		return
+	}
+	message := "review restored successfully"
+	if *req.Hidden {
+		message = "review hidden successfully"
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, message))
+}
@@ -0,0 +1,101 @@
+package review
+
+import (
+	"errors"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReviewRepo struct {
+	db db.IDatabase
+}
+
+func NewReviewRepo(db db.IDatabase) *ReviewRepo {
+	return &ReviewRepo{db: db}
+}
+
+// InitReviewIndex allows one review per student and tutor.
+func InitReviewIndex(database db.IDatabase) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "tutor_id", Value: 1}}, Options: options.Index().SetUnique(true),
+	}
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := database.CreateIndex(ctx, indexModel)
+	if err != nil {
+		return errors.New("Error creating unique student and tutor index for reviews collection:" + err.Error())
+	}
+	return nil
+}
+
+// CreateReview stores review. It returns ErrAlreadyReviewed if the student has
+// already reviewed the tutor.
+func (rr *ReviewRepo) CreateReview(review *Review) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := rr.db.InsertOne(ctx, review)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyReviewed
+		}
+		return err
+	}
+	return nil
+}
+
+func (rr *ReviewRepo) UpdateReview(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := rr.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rr *ReviewRepo) DeleteReview(filter interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := rr.db.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rr *ReviewRepo) GetReview(filter interface{}) (*Review, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var review Review
+	err := rr.db.FindOne(ctx, filter).Decode(&review)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (rr *ReviewRepo) GetReviews(filter interface{}, opts ...*options.FindOptions) ([]*Review, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	reviews := []*Review{}
+	cursor, err := rr.db.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &reviews)
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+type IReviewRepo interface {
+	CreateReview(review *Review) error
+	UpdateReview(filter interface{}, update interface{}) error
+	DeleteReview(filter interface{}) error
+	GetReview(filter interface{}) (*Review, error)
+	GetReviews(filter interface{}, opts ...*options.FindOptions) ([]*Review, error)
+}
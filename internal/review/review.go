@@ -1,3 +1,29 @@
 package review
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
 //tutor reviews
+
+type Review struct {
+	Id           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TutorId      primitive.ObjectID `json:"tutor_id" bson:"tutor_id"`
+	StudentId    primitive.ObjectID `json:"student_id" bson:"student_id"`
+	Rating       int                `json:"rating" bson:"rating"`
+	Text         string             `json:"text" bson:"text"`
+	Reply        *Reply             `json:"reply,omitempty" bson:"reply,omitempty"`
+	Hidden       bool               `json:"hidden" bson:"hidden"`
+	HiddenReason string             `json:"hidden_reason,omitempty" bson:"hidden_reason,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Reply is the tutor's public answer to a review.
+type Reply struct {
+	Text      string    `json:"text" bson:"text"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,185 @@
+package review
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/subject"
+	"github.com/ayo-ajayi/edutech/internal/tutor"
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrReviewNotFound = errors.New("review not found")
+	ErrInvalidRating  = errors.New("rating must be between 1 and 5")
+	// ErrAlreadyReviewed is enforced by the index of InitReviewIndex, so two
+	// requests at once cannot both create a review.
+	ErrAlreadyReviewed = errors.New("you have already reviewed this tutor")
+)
+
+type ReviewService struct {
+	reviewRepo              IReviewRepo
+	tutorRepo               tutor.IReviewTutorRepo
+	studentSubjectTutorRepo subject.IReviewStudentSubjectTutorRepo
+}
+
+func NewReviewService(reviewRepo IReviewRepo, tutorRepo tutor.IReviewTutorRepo, studentSubjectTutorRepo subject.IReviewStudentSubjectTutorRepo) *ReviewService {
+	return &ReviewService{reviewRepo: reviewRepo, tutorRepo: tutorRepo, studentSubjectTutorRepo: studentSubjectTutorRepo}
+}
+
+// CreateReview lets a student review a tutor they have registered. A student can
+// only review each tutor once; later changes go through UpdateReview.
+func (rs *ReviewService) CreateReview(review *Review) error {
+	if review.Rating < 1 || review.Rating > 5 {
+		return ErrInvalidRating
+	}
+	registered, err := rs.studentSubjectTutorRepo.StudentSubjectTutorExists(bson.M{"student_id": review.StudentId, "tutor_id": review.TutorId})
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return errors.New("you can only review tutors you have registered")
+	}
+	review.Id = primitive.NewObjectID()
+	review.Hidden = false
+	review.CreatedAt = time.Now()
+	review.UpdatedAt = time.Now()
+	if err := rs.reviewRepo.CreateReview(review); err != nil {
+		return err
+	}
+	return rs.updateTutorRating(review.TutorId)
+}
+
+func (rs *ReviewService) UpdateReview(studentId primitive.ObjectID, reviewId primitive.ObjectID, rating int, text string) (*Review, error) {
+	if rating < 1 || rating > 5 {
+		return nil, ErrInvalidRating
+	}
+	review, err := rs.getReview(bson.M{"_id": reviewId, "student_id": studentId})
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.reviewRepo.UpdateReview(bson.M{"_id": reviewId}, bson.M{"$set": bson.M{"rating": rating, "text": text, "updated_at": time.Now()}}); err != nil {
+		return nil, err
+	}
+	if err := rs.updateTutorRating(review.TutorId); err != nil {
+		return nil, err
+	}
+	return rs.getReview(bson.M{"_id": reviewId})
+}
+
+func (rs *ReviewService) DeleteReview(studentId primitive.ObjectID, reviewId primitive.ObjectID) error {
+	review, err := rs.getReview(bson.M{"_id": reviewId, "student_id": studentId})
+	if err != nil {
+		return err
+	}
+	if err := rs.reviewRepo.DeleteReview(bson.M{"_id": reviewId}); err != nil {
+		return err
+	}
+	return rs.updateTutorRating(review.TutorId)
+}
+
+func (rs *ReviewService) ReplyToReview(tutorId primitive.ObjectID, reviewId primitive.ObjectID, text string) (*Review, error) {
+	review, err := rs.getReview(bson.M{"_id": reviewId, "tutor_id": tutorId})
+	if err != nil {
+		return nil, err
+	}
+	reply := &Reply{Text: text, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if review.Reply != nil {
+		reply.CreatedAt = review.Reply.CreatedAt
+	}
+	if err := rs.reviewRepo.UpdateReview(bson.M{"_id": reviewId}, bson.M{"$set": bson.M{"reply": reply}}); err != nil {
+		return nil, err
+	}
+	review.Reply = reply
+	return review, nil
+}
+
+func (rs *ReviewService) GetTutorReviews(tutorId primitive.ObjectID, req *utils.ListReq) ([]*Review, error) {
+	return rs.reviewRepo.GetReviews(bson.M{"tutor_id": tutorId, "hidden": false}, req.Paginate(bson.D{{Key: "created_at", Value: -1}}))
+}
+
+func (rs *ReviewService) GetReviews(hidden *bool, req *utils.ListReq) ([]*Review, error) {
+	filter := bson.M{}
+	if hidden != nil {
+		filter["hidden"] = *hidden
+	}
+	return rs.reviewRepo.GetReviews(filter, req.Paginate(bson.D{{Key: "created_at", Value: -1}}))
+}
+
+// SetReviewHidden is used by admins to moderate abusive reviews. Hidden reviews
+// are not shown to students and do not count towards the tutor's rating.
+func (rs *ReviewService) SetReviewHidden(reviewId primitive.ObjectID, hidden bool, reason string) error {
+	review, err := rs.getReview(bson.M{"_id": reviewId})
+	if err != nil {
+		return err
+	}
+	if !hidden {
+		reason = ""
+	}
+	if err := rs.reviewRepo.UpdateReview(bson.M{"_id": reviewId}, bson.M{"$set": bson.M{"hidden": hidden, "hidden_reason": reason}}); err != nil {
+		return err
+	}
+	return rs.updateTutorRating(review.TutorId)
+}
+
+func (rs *ReviewService) getReview(filter interface{}) (*Review, error) {
+	review, err := rs.reviewRepo.GetReview(filter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	return review, nil
+}
+
+// updateTutorRating recomputes the rating of a tutor from their visible
+// reviews. The rating is only written if no one else wrote it since it was
+// read; otherwise the reviews may have changed in between and it is computed
+// again, so concurrent review changes cannot leave a stale average behind.
+func (rs *ReviewService) updateTutorRating(tutorId primitive.ObjectID) error {
+	for {
+		t, err := rs.tutorRepo.GetTutor(bson.M{"_id": tutorId})
+		if err != nil {
+			return err
+		}
+		reviews, err := rs.reviewRepo.GetReviews(bson.M{"tutor_id": tutorId, "hidden": false})
+		if err != nil {
+			return err
+		}
+		rating := tutor.Rating{Count: len(reviews), Version: t.Rating.Version + 1}
+		if len(reviews) > 0 {
+			total := 0
+			for _, review := range reviews {
+				total += review.Rating
+			}
+			rating.Average = math.Round(float64(total)/float64(len(reviews))*100) / 100
+		}
+		// ratings written before versions existed have none
+		version := bson.M{"$eq": t.Rating.Version}
+		if t.Rating.Version == 0 {
+			version = bson.M{"$in": bson.A{0, nil}}
+		}
+		modified, err := rs.tutorRepo.UpdateTutorCount(bson.M{"_id": tutorId, "rating.version": version}, bson.M{"$set": bson.M{"rating": rating}})
+		if err != nil {
+			return err
+		}
+		if modified == 1 {
+			return nil
+		}
+	}
+}
+
+type IReviewService interface {
+	CreateReview(review *Review) error
+	UpdateReview(studentId primitive.ObjectID, reviewId primitive.ObjectID, rating int, text string) (*Review, error)
+	DeleteReview(studentId primitive.ObjectID, reviewId primitive.ObjectID) error
+	ReplyToReview(tutorId primitive.ObjectID, reviewId primitive.ObjectID, text string) (*Review, error)
+	GetTutorReviews(tutorId primitive.ObjectID, req *utils.ListReq) ([]*Review, error)
+	GetReviews(hidden *bool, req *utils.ListReq) ([]*Review, error)
+	SetReviewHidden(reviewId primitive.ObjectID, hidden bool, reason string) error
+}
@@ -1,6 +1,7 @@
 package student
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/ayo-ajayi/edutech/internal/user"
@@ -35,6 +36,15 @@ func (sc *StudentController) SignUp(c *gin.Context) {
 		}}
 	err := sc.studentService.SignUpStudent(student)
 	if err != nil {
+		if errors.Is(err, user.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		var policyErr *utils.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "password does not meet the policy", "violations": policyErr.Violations}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
@@ -51,26 +61,67 @@ func (sc *StudentController) Profile(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(student, "student retrieved successfully"))
 }
 
-//admin
-// func (sc *StudentController) GetStudent(c *gin.Context) {
-// 	id := c.Param("id")
-// 	if id == "" {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "id is required"}})
-// 		return
-// 	}
-
-// 	studentId, err := primitive.ObjectIDFromHex(id)
-// 	if err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
-// 		return
-// 	}
-// 	student, err := sc.studentService.GetStudent(studentId)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
-// 		return
-// 	}
-// 	c.JSON(http.StatusOK, utils.NewSuccessResponse(student, "student retrieved successfully"))
-// }
+func (sc *StudentController) GetStudent(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "id is required"}})
+		return
+	}
+
+	studentId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return
+	}
+	student, err := sc.studentService.GetStudent(studentId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(student, "student retrieved successfully"))
+}
+
+func (sc *StudentController) GetStudents(c *gin.Context) {
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	students, err := sc.studentService.GetStudents(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"students": students,
+		"page":     req.Page,
+		"limit":    req.Limit,
+	}, "students retrieved successfully"))
+}
+
+func (sc *StudentController) SetStudentSuspended(c *gin.Context) {
+	studentId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return
+	}
+	req := struct {
+		Suspended *bool `json:"suspended" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := sc.studentService.SetStudentSuspended(studentId, *req.Suspended); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	message := "student reinstated successfully"
+	if *req.Suspended {
+		message = "student suspended successfully"
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, message))
+}
 
 func (sc *StudentController) RegisterSubject(c *gin.Context) {
 	req := struct {
@@ -136,3 +187,56 @@ func (sc *StudentController) GetRegisteredTutors(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutors, "student's tutors retrieved successfully"))
 }
+
+func (sc *StudentController) UpdateProfile(c *gin.Context) {
+	req := utils.UpdateStudentProfileReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	student, err := sc.studentService.UpdateProfile(id, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(student, "profile updated successfully"))
+}
+
+func (sc *StudentController) UploadAvatar(c *gin.Context) {
+	data, err := utils.ReadUpload(c.Writer, c.Request, "avatar", utils.MaxAvatarBytes)
+	if err != nil {
+		avatarError(c, err)
+		return
+	}
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	student, err := sc.studentService.SetAvatar(id, data)
+	if err != nil {
+		avatarError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(student, "avatar updated successfully"))
+}
+
+func (sc *StudentController) DeleteAvatar(c *gin.Context) {
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	student, err := sc.studentService.DeleteAvatar(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(student, "avatar removed successfully"))
+}
+
+func avatarError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrUploadTooLarge), errors.Is(err, utils.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, utils.ErrUploadMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "avatar file is required"}})
+	case errors.Is(err, utils.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+	}
+}
@@ -0,0 +1,73 @@
+package student
+
+import (
+	"log"
+	"strings"
+
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateProfile changes the profile fields set in req and returns the student.
+func (ss *StudentService) UpdateProfile(id primitive.ObjectID, req *utils.UpdateStudentProfileReq) (*Student, error) {
+	set := bson.M{}
+	if req.Bio != nil {
+		set["profile.bio"] = strings.TrimSpace(*req.Bio)
+	}
+	if req.Timezone != nil {
+		set["profile.timezone"] = *req.Timezone
+	}
+	if req.Languages != nil {
+		set["profile.languages"] = *req.Languages
+	}
+	if req.GradeLevel != nil {
+		set["profile.grade_level"] = *req.GradeLevel
+	}
+	if len(set) > 0 {
+		if err := ss.studentRepo.UpdateStudent(bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+	}
+	return ss.GetStudent(id)
+}
+
+// SetAvatar replaces the student's avatar with the image in data.
+func (ss *StudentService) SetAvatar(id primitive.ObjectID, data []byte) (*Student, error) {
+	student, err := ss.GetStudent(id)
+	if err != nil {
+		return nil, err
+	}
+	avatarUrl, err := ss.avatarManager.SaveAvatar(id, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.studentRepo.UpdateStudent(bson.M{"_id": id}, bson.M{"$set": bson.M{"profile.avatar_url": avatarUrl}}); err != nil {
+		ss.avatarManager.DeleteAvatar(avatarUrl)
+		return nil, err
+	}
+	if err := ss.avatarManager.DeleteAvatar(student.Profile.AvatarUrl); err != nil {
+		log.Println("avatar delete error: ", err)
+	}
+	student.Profile.AvatarUrl = avatarUrl
+	return student, nil
+}
+
+// DeleteAvatar removes the student's avatar.
+func (ss *StudentService) DeleteAvatar(id primitive.ObjectID) (*Student, error) {
+	student, err := ss.GetStudent(id)
+	if err != nil {
+		return nil, err
+	}
+	if student.Profile.AvatarUrl == "" {
+		return student, nil
+	}
+	if err := ss.studentRepo.UpdateStudent(bson.M{"_id": id}, bson.M{"$unset": bson.M{"profile.avatar_url": ""}}); err != nil {
+		return nil, err
+	}
+	if err := ss.avatarManager.DeleteAvatar(student.Profile.AvatarUrl); err != nil {
+		log.Println("avatar delete error: ", err)
+	}
+	student.Profile.AvatarUrl = ""
+	return student, nil
+}
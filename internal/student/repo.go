@@ -2,31 +2,36 @@ package student
 
 import (
 	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type StudentRepo struct {
-	db db.IDatabase
+	db    db.IDatabase
+	users db.IDatabase
 }
 
-func NewStudentRepo(db db.IDatabase) *StudentRepo {
-	return &StudentRepo{db: db}
+// NewStudentRepo stores the student profiles in db and their identities in users.
+func NewStudentRepo(db db.IDatabase, users db.IDatabase) *StudentRepo {
+	return &StudentRepo{db: db, users: users}
 }
 
-func (sr *StudentRepo) CreateStudent(Student *Student) error {
-	ctx, cancel := db.DBReqContext(5)
-	defer cancel()
-	_, err := sr.db.InsertOne(ctx, Student)
-	if err != nil {
-		return err
+// CreateStudent stores the user and the student profile linked to it. It returns
+// user.ErrEmailTaken if the email already belongs to an account.
+func (sr *StudentRepo) CreateStudent(student *Student) error {
+	if student.Id.IsZero() {
+		student.Id = primitive.NewObjectID()
 	}
-	return nil
+	student.User.Id = student.Id
+	profile := *student
+	profile.User = nil
+	return user.CreateWithProfile(sr.users, sr.db, student.User, &profile)
 }
 
 func (sr *StudentRepo) StudentExists(filter interface{}) (bool, error) {
-	ctx, cancel := db.DBReqContext(5)
-	defer cancel()
-	err := sr.db.FindOne(ctx, filter).Err()
+	_, err := sr.GetStudent(filter)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return false, nil
@@ -47,14 +52,31 @@ func (sr *StudentRepo) UpdateStudent(filter interface{}, update interface{}) err
 }
 
 func (sr *StudentRepo) GetStudent(filter interface{}) (*Student, error) {
+	students, err := sr.GetStudents(filter, options.Find().SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(students) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return students[0], nil
+}
+
+// GetStudents finds student profiles together with their users, so filter and
+// opts can refer to user fields such as "user.email".
+func (sr *StudentRepo) GetStudents(filter interface{}, opts ...*options.FindOptions) ([]*Student, error) {
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
-	var student Student
-	err := sr.db.FindOne(ctx, filter).Decode(&student)
+	students := []*Student{}
+	cursor, err := sr.db.Aggregate(ctx, user.JoinPipeline(filter, opts...))
 	if err != nil {
 		return nil, err
 	}
-	return &student, nil
+	err = cursor.All(ctx, &students)
+	if err != nil {
+		return nil, err
+	}
+	return students, nil
 }
 
 type IStudentRepo interface {
@@ -62,8 +84,13 @@ type IStudentRepo interface {
 	StudentExists(filter interface{}) (bool, error)
 	UpdateStudent(filter interface{}, update interface{}) error
 	GetStudent(filter interface{}) (*Student, error)
+	GetStudents(filter interface{}, opts ...*options.FindOptions) ([]*Student, error)
 }
 
 type IMiddlewareStudentRepo interface {
 	GetStudent(filter interface{}) (*Student, error)
 }
+
+type IBookingStudentRepo interface {
+	GetStudent(filter interface{}) (*Student, error)
+}
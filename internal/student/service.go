@@ -16,34 +16,36 @@ type StudentService struct {
 	verificationTokenManager utils.IVerificationTokenManager
 	accessTokenManager       utils.IAccessTokenManager
 	studentRepo              IStudentRepo
+	userRepo                 user.IUserRepo
 	emailManager             utils.IEmailManager
 	subjectRepo              subject.IStudentSubjectRepo
 	tutorRepo                tutor.IStudentTutorRepo
 	studentSubjectTutorRepo  subject.IStudentSubjectTutorRepo
+	passwordPolicy           utils.IPasswordPolicy
+	avatarManager            utils.IAvatarManager
 	baseUrl                  string
 }
 
 func NewStudentService(
 	studentRepo IStudentRepo,
+	userRepo user.IUserRepo,
 	verificationTokenManager utils.IVerificationTokenManager,
 	accessTokenManager utils.IAccessTokenManager,
 	emailManager utils.IEmailManager,
 	subjectRepo subject.IStudentSubjectRepo,
 	tutorRepo tutor.IStudentTutorRepo,
 	studentSubjectTutorRepo subject.IStudentSubjectTutorRepo,
+	passwordPolicy utils.IPasswordPolicy,
+	avatarManager utils.IAvatarManager,
 	baseUrl string,
 ) *StudentService {
-	return &StudentService{studentRepo: studentRepo, verificationTokenManager: verificationTokenManager, accessTokenManager: accessTokenManager, emailManager: emailManager, baseUrl: baseUrl, subjectRepo: subjectRepo, tutorRepo: tutorRepo, studentSubjectTutorRepo: studentSubjectTutorRepo}
+	return &StudentService{studentRepo: studentRepo, userRepo: userRepo, verificationTokenManager: verificationTokenManager, accessTokenManager: accessTokenManager, emailManager: emailManager, baseUrl: baseUrl, subjectRepo: subjectRepo, tutorRepo: tutorRepo, studentSubjectTutorRepo: studentSubjectTutorRepo, passwordPolicy: passwordPolicy, avatarManager: avatarManager}
 }
 
 func (ss *StudentService) SignUpStudent(student *Student) error {
-	exists, err := ss.studentRepo.StudentExists(bson.M{"email": student.Email})
-	if err != nil {
+	if err := ss.passwordPolicy.Check(student.Password, student.Email, student.Firstname, student.Lastname); err != nil {
 		return err
 	}
-	if exists {
-		return errors.New("student already exists")
-	}
 	passwordHash, err := utils.HashPassword(student.Password)
 	if err != nil {
 		return err
@@ -51,6 +53,7 @@ func (ss *StudentService) SignUpStudent(student *Student) error {
 	if passwordHash == "" {
 		return errors.New("password hash is empty")
 	}
+	student.Email = user.NormalizeEmail(student.Email)
 	student.Password = passwordHash
 	student.CreatedAt = time.Now()
 	student.UpdatedAt = time.Now()
@@ -60,9 +63,11 @@ func (ss *StudentService) SignUpStudent(student *Student) error {
 		return err
 	}
 
-	verificationToken := utils.CreateVerificationToken()
-
-	if err := ss.verificationTokenManager.SaveVerificationToken(student.Email, verificationToken); err != nil {
+	verificationToken, err := utils.CreateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := ss.verificationTokenManager.SaveVerificationToken(student.Email, utils.PurposeSignup, verificationToken); err != nil {
 		return err
 	}
 	verificationLink, err := utils.ConstructVerificationLink(ss.baseUrl, "verify", verificationToken, student.Email)
@@ -100,7 +105,7 @@ func (ss *StudentService) RegisterSubject(subjectId primitive.ObjectID, userId p
 		}
 	}
 	student.Subjects = append(student.Subjects, subjectId)
-	return ss.studentRepo.UpdateStudent(bson.M{"_id": userId}, student)
+	return ss.studentRepo.UpdateStudent(bson.M{"_id": userId}, bson.M{"$set": bson.M{"subjects": student.Subjects}})
 }
 func (ss *StudentService) GetRegisteredSubjects(userId primitive.ObjectID) ([]*subject.Subject, error) {
 	student, err := ss.studentRepo.GetStudent(bson.M{"_id": userId})
@@ -117,6 +122,9 @@ func (ss *StudentService) RegisterTutor(tutorId primitive.ObjectID, userId primi
 	if err != nil {
 		return err
 	}
+	if !tutor.Approved || tutor.Suspended {
+		return errors.New("tutor is not available")
+	}
 	subjects, err := ss.GetRegisteredSubjects(userId)
 	if err != nil {
 		return err
@@ -131,7 +139,7 @@ func (ss *StudentService) RegisterTutor(tutorId primitive.ObjectID, userId primi
 	if !registered {
 		return errors.New("tutor's subject not registered by student")
 	}
-	exists, err := ss.studentSubjectTutorRepo.StudentSubjectTutorExists(bson.M{"student": userId, "tutor": tutorId})
+	exists, err := ss.studentSubjectTutorRepo.StudentSubjectTutorExists(bson.M{"student_id": userId, "tutor_id": tutorId})
 	if err != nil {
 		return err
 	}
@@ -154,7 +162,7 @@ func (ss *StudentService) RegisterTutor(tutorId primitive.ObjectID, userId primi
 }
 
 func (ss *StudentService) GetRegisteredTutors(userId primitive.ObjectID) ([]*utils.StudentRegisteredTutorRes, error) {
-	studentSubjectTutors, err := ss.studentSubjectTutorRepo.GetStudentSubjectTutors(bson.M{"student": userId})
+	studentSubjectTutors, err := ss.studentSubjectTutorRepo.GetStudentSubjectTutors(bson.M{"student_id": userId})
 	if err != nil {
 		return nil, err
 	}
@@ -165,23 +173,59 @@ func (ss *StudentService) GetRegisteredTutors(userId primitive.ObjectID) ([]*uti
 		if err != nil {
 			return nil, err
 		}
+		if !tutor.Approved || tutor.Suspended {
+			continue
+		}
 		tutors = append(tutors, &utils.StudentRegisteredTutorRes{
 			TutorId:      tutor.Id,
 			SubjectId:    studentSubjectTutor.SubjectId,
 			Email:        tutor.Email,
 			FirstName:    tutor.Firstname,
 			LastName:     tutor.Lastname,
+			Rating:       tutor.Rating.Average,
+			RatingCount:  tutor.Rating.Count,
+			Profile:      tutor.Profile.Public(),
 			RegisteredAt: studentSubjectTutor.CreatedAt,
 		})
 	}
 	return tutors, nil
 }
 
+func (ss *StudentService) GetStudents(req *utils.ListReq) ([]*Student, error) {
+	return ss.studentRepo.GetStudents(utils.UserSearchFilter(req.Search), req.FindOptions())
+}
+
+// SetStudentSuspended suspends or reinstates a student. Suspending also ends all of the
+// student's sessions.
+func (ss *StudentService) SetStudentSuspended(id primitive.ObjectID, suspended bool) error {
+	exists, err := ss.studentRepo.StudentExists(bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("student does not exist")
+	}
+	if err := ss.userRepo.UpdateUser(bson.M{"_id": id}, bson.M{"$set": bson.M{"suspended": suspended, "updated_at": time.Now()}}); err != nil {
+		return err
+	}
+	if suspended {
+		if _, err := ss.accessTokenManager.DeleteAccessTokens(bson.M{"user_id": id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type IStudentService interface {
 	SignUpStudent(student *Student) error
 	GetStudent(id primitive.ObjectID) (*Student, error)
+	GetStudents(req *utils.ListReq) ([]*Student, error)
+	SetStudentSuspended(id primitive.ObjectID, suspended bool) error
 	RegisterSubject(subjectId primitive.ObjectID, userId primitive.ObjectID) error
 	GetRegisteredSubjects(userId primitive.ObjectID) ([]*subject.Subject, error)
 	RegisterTutor(tutorId primitive.ObjectID, userId primitive.ObjectID) error
 	GetRegisteredTutors(userId primitive.ObjectID) ([]*utils.StudentRegisteredTutorRes, error)
+	UpdateProfile(id primitive.ObjectID, req *utils.UpdateStudentProfileReq) (*Student, error)
+	SetAvatar(id primitive.ObjectID, data []byte) (*Student, error)
+	DeleteAvatar(id primitive.ObjectID) (*Student, error)
 }
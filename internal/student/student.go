@@ -6,7 +6,18 @@ import (
 )
 
 type Student struct {
-	Id primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	*user.User
-	Subjects []primitive.ObjectID `json:"subjects" bson:"subjects"`
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	*user.User `bson:"user,omitempty"`
+	Subjects   []primitive.ObjectID `json:"subjects" bson:"subjects"`
+	Profile    Profile              `json:"profile" bson:"profile"`
+}
+
+// Profile is what a student tells about themselves. It is only shown to the
+// student and to admins.
+type Profile struct {
+	Bio        string   `json:"bio,omitempty" bson:"bio,omitempty"`
+	AvatarUrl  string   `json:"avatar_url,omitempty" bson:"avatar_url,omitempty"`
+	Timezone   string   `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	Languages  []string `json:"languages,omitempty" bson:"languages,omitempty"`
+	GradeLevel string   `json:"grade_level,omitempty" bson:"grade_level,omitempty"`
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ayo-ajayi/edutech/internal/utils"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type SubjectController struct {
@@ -32,3 +33,38 @@ func (sc *SubjectController) CreateSubject(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(subject, "subject successfully created"))
 }
+
+func (sc *SubjectController) GetSubjects(c *gin.Context) {
+	subjects, err := sc.subjectService.GetSubjects()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(subjects, "subjects retrieved successfully"))
+}
+
+func (sc *SubjectController) UpdateSubject(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid subject id"}})
+		return
+	}
+	req := struct {
+		Name       *string `json:"name"`
+		Compulsory *bool   `json:"compulsory"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if req.Name != nil && *req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "name cannot be empty"}})
+		return
+	}
+	subject, err := sc.subjectService.UpdateSubject(id, req.Name, req.Compulsory)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(subject, "subject successfully updated"))
+}
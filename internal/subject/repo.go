@@ -100,6 +100,10 @@ type IStudentSubjectRepo interface {
 	GetSubject(filter interface{}) (*Subject, error)
 }
 
+type ITutorSubjectRepo interface {
+	GetSubject(filter interface{}) (*Subject, error)
+}
+
 type StudentSubjectTutorRepo struct {
 	db db.IDatabase
 }
@@ -162,3 +166,15 @@ type IStudentSubjectTutorRepo interface {
 	StudentSubjectTutorExists(filter interface{}) (bool, error)
 	GetStudentSubjectTutors(filter interface{}) ([]*StudentSubjectTutor, error)
 }
+
+type IReviewStudentSubjectTutorRepo interface {
+	StudentSubjectTutorExists(filter interface{}) (bool, error)
+}
+
+type IBookingSubjectRepo interface {
+	GetSubject(filter interface{}) (*Subject, error)
+}
+
+type IBookingStudentSubjectTutorRepo interface {
+	StudentSubjectTutorExists(filter interface{}) (bool, error)
+}
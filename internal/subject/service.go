@@ -1,6 +1,7 @@
 package subject
 
 import (
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -38,17 +39,58 @@ func NewSubjectService(subjectRepo ISubjectRepo, compulsorySubjects ...string) (
 }
 
 func (ss *SubjectService) CreateSubject(subject *Subject) error {
+	exists, err := ss.subjectRepo.SubjectExists(bson.M{"name": subject.Name})
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("subject already exists")
+	}
 	subject.Id = primitive.NewObjectID()
 	subject.CreatedAt = time.Now()
 	subject.UpdatedAt = time.Now()
 
-	err := ss.subjectRepo.CreateSubject(subject)
+	err = ss.subjectRepo.CreateSubject(subject)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (ss *SubjectService) GetSubjects() ([]*Subject, error) {
+	return ss.subjectRepo.GetSubjects(bson.M{})
+}
+
+func (ss *SubjectService) UpdateSubject(id primitive.ObjectID, name *string, compulsory *bool) (*Subject, error) {
+	exists, err := ss.subjectRepo.SubjectExists(bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New("subject does not exist")
+	}
+	set := bson.M{"updated_at": time.Now()}
+	if name != nil {
+		taken, err := ss.subjectRepo.SubjectExists(bson.M{"name": *name, "_id": bson.M{"$ne": id}})
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, errors.New("subject already exists")
+		}
+		set["name"] = *name
+	}
+	if compulsory != nil {
+		set["compulsory"] = *compulsory
+	}
+	if err := ss.subjectRepo.UpdateSubject(bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+	return ss.subjectRepo.GetSubject(bson.M{"_id": id})
+}
+
 type ISubjectService interface {
 	CreateSubject(subject *Subject) error
+	GetSubjects() ([]*Subject, error)
+	UpdateSubject(id primitive.ObjectID, name *string, compulsory *bool) (*Subject, error)
 }
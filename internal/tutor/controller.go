@@ -1,6 +1,7 @@
 package tutor
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/ayo-ajayi/edutech/internal/user"
@@ -35,6 +36,15 @@ func (tc *TutorController) SignUp(c *gin.Context) {
 		}}
 	err := tc.tutorService.SignUpTutor(tutor)
 	if err != nil {
+		if errors.Is(err, user.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"message": err.Error()}})
+			return
+		}
+		var policyErr *utils.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "password does not meet the policy", "violations": policyErr.Violations}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
 		return
 	}
@@ -51,23 +61,196 @@ func (tc *TutorController) Profile(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutor, "tutor retrieved successfully"))
 }
 
-//admin
-// func (tc *TutorController) GetTutor(c *gin.Context) {
-// 	id := c.Param("id")
-// 	if id == "" {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "id is required"}})
-// 		return
-// 	}
-
-// 	tutorId, err := primitive.ObjectIDFromHex(id)
-// 	if err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
-// 		return
-// 	}
-// 	tutor, err := tc.tutorService.GetTutor(tutorId)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
-// 		return
-// 	}
-// 	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutor, "tutor retrieved successfully"))
-// }
+func (tc *TutorController) GetTutor(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "id is required"}})
+		return
+	}
+
+	tutorId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return
+	}
+	tutor, err := tc.tutorService.GetTutor(tutorId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutor, "tutor retrieved successfully"))
+}
+
+func (tc *TutorController) GetTutors(c *gin.Context) {
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	tutors, err := tc.tutorService.GetTutors(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"tutors": tutors,
+		"page":   req.Page,
+		"limit":  req.Limit,
+	}, "tutors retrieved successfully"))
+}
+
+func (tc *TutorController) SetTutorSuspended(c *gin.Context) {
+	tutorId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return
+	}
+	req := struct {
+		Suspended *bool `json:"suspended" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	if err := tc.tutorService.SetTutorSuspended(tutorId, *req.Suspended); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	message := "tutor reinstated successfully"
+	if *req.Suspended {
+		message = "tutor suspended successfully"
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, message))
+}
+
+func (tc *TutorController) SubmitApplication(c *gin.Context) {
+	req := struct {
+		Bio            string   `json:"bio" binding:"required"`
+		Qualifications []string `json:"qualifications" binding:"required,min=1"`
+		SubjectId      string   `json:"subject_id" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	subjectId, err := primitive.ObjectIDFromHex(req.SubjectId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid subject id"}})
+		return
+	}
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	application := &Application{
+		Bio:            req.Bio,
+		Qualifications: req.Qualifications,
+		Subject:        subjectId,
+	}
+	if err := tc.tutorService.SubmitApplication(id, application); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(application, "application submitted successfully"))
+}
+
+func (tc *TutorController) GetApplications(c *gin.Context) {
+	req := utils.ListReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	status := ApplicationStatus(c.Query("status"))
+	switch status {
+	case "", ApplicationPending, ApplicationApproved, ApplicationRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid status"}})
+		return
+	}
+	tutors, err := tc.tutorService.GetApplications(status, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(gin.H{
+		"tutors": tutors,
+		"page":   req.Page,
+		"limit":  req.Limit,
+	}, "applications retrieved successfully"))
+}
+
+func (tc *TutorController) ReviewApplication(c *gin.Context) {
+	tutorId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid id"}})
+		return
+	}
+	req := struct {
+		Approved *bool  `json:"approved" binding:"required"`
+		Reason   string `json:"reason"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	adminId := c.MustGet("user_id").(primitive.ObjectID)
+	if err := tc.tutorService.ReviewApplication(tutorId, adminId, *req.Approved, req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	message := "application rejected successfully"
+	if *req.Approved {
+		message = "application approved successfully"
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(nil, message))
+}
+
+func (tc *TutorController) UpdateProfile(c *gin.Context) {
+	req := utils.UpdateTutorProfileReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	tutor, err := tc.tutorService.UpdateProfile(id, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutor, "profile updated successfully"))
+}
+
+func (tc *TutorController) UploadAvatar(c *gin.Context) {
+	data, err := utils.ReadUpload(c.Writer, c.Request, "avatar", utils.MaxAvatarBytes)
+	if err != nil {
+		avatarError(c, err)
+		return
+	}
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	tutor, err := tc.tutorService.SetAvatar(id, data)
+	if err != nil {
+		avatarError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutor, "avatar updated successfully"))
+}
+
+func (tc *TutorController) DeleteAvatar(c *gin.Context) {
+	id := c.MustGet("user_id").(primitive.ObjectID)
+	tutor, err := tc.tutorService.DeleteAvatar(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewSuccessResponse(tutor, "avatar removed successfully"))
+}
+
+func avatarError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrUploadTooLarge), errors.Is(err, utils.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": gin.H{"message": err.Error()}})
+	case errors.Is(err, utils.ErrUploadMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "avatar file is required"}})
+	case errors.Is(err, utils.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+	}
+}
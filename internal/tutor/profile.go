@@ -0,0 +1,73 @@
+package tutor
+
+import (
+	"log"
+	"strings"
+
+	"github.com/ayo-ajayi/edutech/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateProfile changes the profile fields set in req and returns the tutor.
+func (ts *TutorService) UpdateProfile(id primitive.ObjectID, req *utils.UpdateTutorProfileReq) (*Tutor, error) {
+	set := bson.M{}
+	if req.Bio != nil {
+		set["profile.bio"] = strings.TrimSpace(*req.Bio)
+	}
+	if req.Timezone != nil {
+		set["profile.timezone"] = *req.Timezone
+	}
+	if req.Languages != nil {
+		set["profile.languages"] = *req.Languages
+	}
+	if req.Qualifications != nil {
+		set["profile.qualifications"] = *req.Qualifications
+	}
+	if len(set) > 0 {
+		if err := ts.tutorRepo.UpdateTutor(bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+	}
+	return ts.GetTutor(id)
+}
+
+// SetAvatar replaces the tutor's avatar with the image in data.
+func (ts *TutorService) SetAvatar(id primitive.ObjectID, data []byte) (*Tutor, error) {
+	tutor, err := ts.GetTutor(id)
+	if err != nil {
+		return nil, err
+	}
+	avatarUrl, err := ts.avatarManager.SaveAvatar(id, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.tutorRepo.UpdateTutor(bson.M{"_id": id}, bson.M{"$set": bson.M{"profile.avatar_url": avatarUrl}}); err != nil {
+		ts.avatarManager.DeleteAvatar(avatarUrl)
+		return nil, err
+	}
+	if err := ts.avatarManager.DeleteAvatar(tutor.Profile.AvatarUrl); err != nil {
+		log.Println("avatar delete error: ", err)
+	}
+	tutor.Profile.AvatarUrl = avatarUrl
+	return tutor, nil
+}
+
+// DeleteAvatar removes the tutor's avatar.
+func (ts *TutorService) DeleteAvatar(id primitive.ObjectID) (*Tutor, error) {
+	tutor, err := ts.GetTutor(id)
+	if err != nil {
+		return nil, err
+	}
+	if tutor.Profile.AvatarUrl == "" {
+		return tutor, nil
+	}
+	if err := ts.tutorRepo.UpdateTutor(bson.M{"_id": id}, bson.M{"$unset": bson.M{"profile.avatar_url": ""}}); err != nil {
+		return nil, err
+	}
+	if err := ts.avatarManager.DeleteAvatar(tutor.Profile.AvatarUrl); err != nil {
+		log.Println("avatar delete error: ", err)
+	}
+	tutor.Profile.AvatarUrl = ""
+	return tutor, nil
+}
@@ -2,31 +2,36 @@ package tutor
 
 import (
 	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/ayo-ajayi/edutech/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type TutorRepo struct {
-	db db.IDatabase
+	db    db.IDatabase
+	users db.IDatabase
 }
 
-func NewTutorRepo(db db.IDatabase) *TutorRepo {
-	return &TutorRepo{db: db}
+// NewTutorRepo stores the tutor profiles in db and their identities in users.
+func NewTutorRepo(db db.IDatabase, users db.IDatabase) *TutorRepo {
+	return &TutorRepo{db: db, users: users}
 }
 
+// CreateTutor stores the user and the tutor profile linked to it. It returns
+// user.ErrEmailTaken if the email already belongs to an account.
 func (tr *TutorRepo) CreateTutor(tutor *Tutor) error {
-	ctx, cancel := db.DBReqContext(5)
-	defer cancel()
-	_, err := tr.db.InsertOne(ctx, tutor)
-	if err != nil {
-		return err
+	if tutor.Id.IsZero() {
+		tutor.Id = primitive.NewObjectID()
 	}
-	return nil
+	tutor.User.Id = tutor.Id
+	profile := *tutor
+	profile.User = nil
+	return user.CreateWithProfile(tr.users, tr.db, tutor.User, &profile)
 }
 
 func (tr *TutorRepo) TutorExists(filter interface{}) (bool, error) {
-	ctx, cancel := db.DBReqContext(5)
-	defer cancel()
-	err := tr.db.FindOne(ctx, filter).Err()
+	_, err := tr.GetTutor(filter)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return false, nil
@@ -46,22 +51,36 @@ func (tr *TutorRepo) UpdateTutor(filter interface{}, update interface{}) error {
 	return nil
 }
 
-func (tr *TutorRepo) GetTutor(filter interface{}) (*Tutor, error) {
+// UpdateTutorCount is UpdateTutor for conditional writes: it returns how many
+// tutors were modified, which is 0 when the filter no longer matches.
+func (tr *TutorRepo) UpdateTutorCount(filter interface{}, update interface{}) (int64, error) {
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
-	var tutor Tutor
-	err := tr.db.FindOne(ctx, filter).Decode(&tutor)
+	result, err := tr.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (tr *TutorRepo) GetTutor(filter interface{}) (*Tutor, error) {
+	tutors, err := tr.GetTutors(filter, options.Find().SetLimit(1))
 	if err != nil {
 		return nil, err
 	}
-	return &tutor, nil
+	if len(tutors) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return tutors[0], nil
 }
 
-func (sr *TutorRepo) GetTutors(filter interface{}) ([]*Tutor, error) {
+// GetTutors finds tutor profiles together with their users, so filter and
+// opts can refer to user fields such as "user.email".
+func (tr *TutorRepo) GetTutors(filter interface{}, opts ...*options.FindOptions) ([]*Tutor, error) {
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
-	var tutors []*Tutor
-	cursor, err := sr.db.Find(ctx, filter)
+	tutors := []*Tutor{}
+	cursor, err := tr.db.Aggregate(ctx, user.JoinPipeline(filter, opts...))
 	if err != nil {
 		return nil, err
 	}
@@ -77,14 +96,23 @@ type ITutorRepo interface {
 	TutorExists(filter interface{}) (bool, error)
 	UpdateTutor(filter interface{}, update interface{}) error
 	GetTutor(filter interface{}) (*Tutor, error)
-	GetTutors(filter interface{}) ([]*Tutor, error)
+	GetTutors(filter interface{}, opts ...*options.FindOptions) ([]*Tutor, error)
 }
 
 type IStudentTutorRepo interface {
-	GetTutors(filter interface{}) ([]*Tutor, error)
+	GetTutors(filter interface{}, opts ...*options.FindOptions) ([]*Tutor, error)
 	GetTutor(filter interface{}) (*Tutor, error)
 }
 
 type IMiddlewareTutorRepo interface {
 	GetTutor(filter interface{}) (*Tutor, error)
 }
+
+type IReviewTutorRepo interface {
+	GetTutor(filter interface{}) (*Tutor, error)
+	UpdateTutorCount(filter interface{}, update interface{}) (int64, error)
+}
+
+type IBookingTutorRepo interface {
+	GetTutor(filter interface{}) (*Tutor, error)
+}
@@ -4,32 +4,34 @@ import (
 	"errors"
 	"time"
 
+	"github.com/ayo-ajayi/edutech/internal/subject"
 	"github.com/ayo-ajayi/edutech/internal/user"
 	"github.com/ayo-ajayi/edutech/internal/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type TutorService struct {
 	verificationTokenManager utils.IVerificationTokenManager
 	accessTokenManager       utils.IAccessTokenManager
 	tutorRepo                ITutorRepo
+	userRepo                 user.IUserRepo
+	subjectRepo              subject.ITutorSubjectRepo
 	emailManager             utils.IEmailManager
+	passwordPolicy           utils.IPasswordPolicy
+	avatarManager            utils.IAvatarManager
 	baseUrl                  string
 }
 
-func NewTutorService(tutorRepo ITutorRepo, verificationTokenManager utils.IVerificationTokenManager, accessTokenManager utils.IAccessTokenManager, emailManager utils.IEmailManager, baseUrl string) *TutorService {
-	return &TutorService{tutorRepo: tutorRepo, verificationTokenManager: verificationTokenManager, accessTokenManager: accessTokenManager, emailManager: emailManager, baseUrl: baseUrl}
+func NewTutorService(tutorRepo ITutorRepo, userRepo user.IUserRepo, subjectRepo subject.ITutorSubjectRepo, verificationTokenManager utils.IVerificationTokenManager, accessTokenManager utils.IAccessTokenManager, emailManager utils.IEmailManager, passwordPolicy utils.IPasswordPolicy, avatarManager utils.IAvatarManager, baseUrl string) *TutorService {
+	return &TutorService{tutorRepo: tutorRepo, userRepo: userRepo, subjectRepo: subjectRepo, verificationTokenManager: verificationTokenManager, accessTokenManager: accessTokenManager, emailManager: emailManager, passwordPolicy: passwordPolicy, avatarManager: avatarManager, baseUrl: baseUrl}
 }
 
 func (ts *TutorService) SignUpTutor(tutor *Tutor) error {
-	exists, err := ts.tutorRepo.TutorExists(bson.M{"email": tutor.Email})
-	if err != nil {
+	if err := ts.passwordPolicy.Check(tutor.Password, tutor.Email, tutor.Firstname, tutor.Lastname); err != nil {
 		return err
 	}
-	if exists {
-		return errors.New("user already exists")
-	}
 	passwordHash, err := utils.HashPassword(tutor.Password)
 	if err != nil {
 		return err
@@ -37,6 +39,7 @@ func (ts *TutorService) SignUpTutor(tutor *Tutor) error {
 	if passwordHash == "" {
 		return errors.New("password hash is empty")
 	}
+	tutor.Email = user.NormalizeEmail(tutor.Email)
 	tutor.Password = passwordHash
 	tutor.CreatedAt = time.Now()
 	tutor.UpdatedAt = time.Now()
@@ -46,9 +49,11 @@ func (ts *TutorService) SignUpTutor(tutor *Tutor) error {
 		return err
 	}
 
-	verificationToken := utils.CreateVerificationToken()
-
-	if err := ts.verificationTokenManager.SaveVerificationToken(tutor.Email, verificationToken); err != nil {
+	verificationToken, err := utils.CreateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := ts.verificationTokenManager.SaveVerificationToken(tutor.Email, utils.PurposeSignup, verificationToken); err != nil {
 		return err
 	}
 	verificationLink, err := utils.ConstructVerificationLink(ts.baseUrl, "verify", verificationToken, tutor.Email)
@@ -70,7 +75,105 @@ func (ts *TutorService) GetTutor(id primitive.ObjectID) (*Tutor, error) {
 	return tutor, nil
 }
 
+func (ts *TutorService) GetTutors(req *utils.ListReq) ([]*Tutor, error) {
+	return ts.tutorRepo.GetTutors(utils.UserSearchFilter(req.Search), req.FindOptions())
+}
+
+// SetTutorSuspended suspends or reinstates a tutor. Suspending also ends all of the
+// tutor's sessions.
+func (ts *TutorService) SetTutorSuspended(id primitive.ObjectID, suspended bool) error {
+	exists, err := ts.tutorRepo.TutorExists(bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("tutor does not exist")
+	}
+	if err := ts.userRepo.UpdateUser(bson.M{"_id": id}, bson.M{"$set": bson.M{"suspended": suspended, "updated_at": time.Now()}}); err != nil {
+		return err
+	}
+	if suspended {
+		if _, err := ts.accessTokenManager.DeleteAccessTokens(bson.M{"user_id": id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubmitApplication stores the tutor's application for review. A rejected or
+// still pending application can be resubmitted; an approved tutor cannot apply again.
+func (ts *TutorService) SubmitApplication(tutorId primitive.ObjectID, application *Application) error {
+	tutor, err := ts.tutorRepo.GetTutor(bson.M{"_id": tutorId})
+	if err != nil {
+		return err
+	}
+	if tutor.Approved {
+		return errors.New("tutor already approved")
+	}
+	if _, err := ts.subjectRepo.GetSubject(bson.M{"_id": application.Subject}); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("subject does not exist")
+		}
+		return err
+	}
+	application.Status = ApplicationPending
+	application.SubmittedAt = time.Now()
+	application.RejectionReason = ""
+	application.ReviewedBy = nil
+	application.ReviewedAt = nil
+	return ts.tutorRepo.UpdateTutor(bson.M{"_id": tutorId}, bson.M{"$set": bson.M{"application": application}})
+}
+
+func (ts *TutorService) GetApplications(status ApplicationStatus, req *utils.ListReq) ([]*Tutor, error) {
+	filter := bson.M{"application": bson.M{"$exists": true}}
+	if status != "" {
+		filter = bson.M{"application.status": status}
+	}
+	return ts.tutorRepo.GetTutors(filter, req.FindOptions())
+}
+
+// ReviewApplication approves or rejects a tutor's application and emails the
+// tutor the decision. Rejecting an approved tutor withdraws the approval.
+func (ts *TutorService) ReviewApplication(tutorId primitive.ObjectID, adminId primitive.ObjectID, approved bool, reason string) error {
+	tutor, err := ts.tutorRepo.GetTutor(bson.M{"_id": tutorId})
+	if err != nil {
+		return err
+	}
+	if tutor.Application == nil {
+		return errors.New("tutor has not submitted an application")
+	}
+	if !approved && reason == "" {
+		return errors.New("a reason is required when rejecting an application")
+	}
+	now := time.Now()
+	set := bson.M{
+		"approved":                     approved,
+		"application.reviewed_by":      adminId,
+		"application.reviewed_at":      now,
+		"application.rejection_reason": reason,
+	}
+	if approved {
+		set["application.status"] = ApplicationApproved
+		set["application.rejection_reason"] = ""
+		set["subject"] = tutor.Application.Subject
+	} else {
+		set["application.status"] = ApplicationRejected
+	}
+	if err := ts.tutorRepo.UpdateTutor(bson.M{"_id": tutorId}, bson.M{"$set": set}); err != nil {
+		return err
+	}
+	return ts.emailManager.SendTutorApplicationDecision(tutor.Email, tutor.Firstname, approved, reason)
+}
+
 type ITutorService interface {
 	SignUpTutor(tutor *Tutor) error
 	GetTutor(id primitive.ObjectID) (*Tutor, error)
+	SubmitApplication(tutorId primitive.ObjectID, application *Application) error
+	GetApplications(status ApplicationStatus, req *utils.ListReq) ([]*Tutor, error)
+	ReviewApplication(tutorId primitive.ObjectID, adminId primitive.ObjectID, approved bool, reason string) error
+	GetTutors(req *utils.ListReq) ([]*Tutor, error)
+	SetTutorSuspended(id primitive.ObjectID, suspended bool) error
+	UpdateProfile(id primitive.ObjectID, req *utils.UpdateTutorProfileReq) (*Tutor, error)
+	SetAvatar(id primitive.ObjectID, data []byte) (*Tutor, error)
+	DeleteAvatar(id primitive.ObjectID) (*Tutor, error)
 }
@@ -1,17 +1,68 @@
 package tutor
 
 import (
+	"time"
+
 	"github.com/ayo-ajayi/edutech/internal/user"
+	"github.com/ayo-ajayi/edutech/internal/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Tutor struct {
-	Id primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	*user.User
-	Approved bool               `json:"approved" bson:"approved"`
-	Subject  primitive.ObjectID `json:"subject" bson:"subject"`
+	Id          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	*user.User  `bson:"user,omitempty"`
+	Approved    bool               `json:"approved" bson:"approved"`
+	Subject     primitive.ObjectID `json:"subject" bson:"subject"`
+	Application *Application       `json:"application,omitempty" bson:"application,omitempty"`
+	Rating      Rating             `json:"rating" bson:"rating"`
+	Profile     Profile            `json:"profile" bson:"profile"`
 }
 
-//for now a tutor can only one course
+// Profile is what a tutor tells about themselves. Students only get to see
+// the public part; the timezone is for the tutor's own use.
+type Profile struct {
+	Bio            string   `json:"bio,omitempty" bson:"bio,omitempty"`
+	AvatarUrl      string   `json:"avatar_url,omitempty" bson:"avatar_url,omitempty"`
+	Timezone       string   `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	Languages      []string `json:"languages,omitempty" bson:"languages,omitempty"`
+	Qualifications []string `json:"qualifications,omitempty" bson:"qualifications,omitempty"`
+}
+
+func (p *Profile) Public() utils.PublicTutorProfile {
+	return utils.PublicTutorProfile{
+		Bio:            p.Bio,
+		AvatarUrl:      p.AvatarUrl,
+		Languages:      p.Languages,
+		Qualifications: p.Qualifications,
+	}
+}
+
+// Rating is the aggregate of a tutor's visible reviews. Version goes up on
+// every write, so a rating computed from stale reviews can be detected.
+type Rating struct {
+	Average float64 `json:"average" bson:"average"`
+	Count   int     `json:"count" bson:"count"`
+	Version int64   `json:"-" bson:"version"`
+}
 
-//review, bio, rating, avatar
+type ApplicationStatus string
+
+const (
+	ApplicationPending  ApplicationStatus = "pending"
+	ApplicationApproved ApplicationStatus = "approved"
+	ApplicationRejected ApplicationStatus = "rejected"
+)
+
+// Application is what a tutor submits to be vetted before students can see them.
+type Application struct {
+	Bio             string              `json:"bio" bson:"bio"`
+	Qualifications  []string            `json:"qualifications" bson:"qualifications"`
+	Subject         primitive.ObjectID  `json:"subject" bson:"subject"`
+	Status          ApplicationStatus   `json:"status" bson:"status"`
+	RejectionReason string              `json:"rejection_reason,omitempty" bson:"rejection_reason,omitempty"`
+	ReviewedBy      *primitive.ObjectID `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"`
+	SubmittedAt     time.Time           `json:"submitted_at" bson:"submitted_at"`
+	ReviewedAt      *time.Time          `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+}
+
+//for now a tutor can only one course
@@ -0,0 +1,148 @@
+package user
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection is the name of the users collection, which the profile repos
+// join through $lookup.
+const Collection = "users"
+
+var ErrEmailTaken = errors.New("an account with this email already exists")
+
+type UserRepo struct {
+	db db.IDatabase
+}
+
+func NewUserRepo(db db.IDatabase) *UserRepo {
+	return &UserRepo{db: db}
+}
+
+// InitUserEmailIndex makes the email of a user unique.
+func InitUserEmailIndex(database db.IDatabase) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true),
+	}
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := database.CreateIndex(ctx, indexModel)
+	if err != nil {
+		return errors.New("Error creating unique email index for users collection:" + err.Error())
+	}
+	return nil
+}
+
+func (ur *UserRepo) GetUser(filter interface{}) (*User, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var user User
+	err := ur.db.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (ur *UserRepo) UpdateUser(filter interface{}, update interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := ur.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateUserCount is UpdateUser for conditional writes: it returns how many
+// users were modified, which is 0 when the filter no longer matches.
+func (ur *UserRepo) UpdateUserCount(filter interface{}, update interface{}) (int64, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	result, err := ur.db.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, ErrEmailTaken
+		}
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+type IUserRepo interface {
+	GetUser(filter interface{}) (*User, error)
+	UpdateUser(filter interface{}, update interface{}) error
+	UpdateUserCount(filter interface{}, update interface{}) (int64, error)
+}
+
+// CreateWithProfile stores user in the users collection and profile, which must
+// have the same _id, in its own collection. The user is removed again if the
+// profile cannot be stored, so a failed signup does not hold on to the email.
+func CreateWithProfile(users db.IDatabase, profiles db.IDatabase, user *User, profile interface{}) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	user.Email = NormalizeEmail(user.Email)
+	user.Roles = user.GetRoles()
+	if _, err := users.InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+	if _, err := profiles.InsertOne(ctx, profile); err != nil {
+		users.DeleteOne(ctx, bson.M{"_id": user.Id})
+		return err
+	}
+	return nil
+}
+
+// JoinPipeline finds profiles like Find(filter, opts) would, with the user of
+// each profile attached as "user", so filters and sorts can use user fields
+// such as "user.email". Profiles without a user are left out.
+func JoinPipeline(filter interface{}, opts ...*options.FindOptions) mongo.Pipeline {
+	join := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{"from": Collection, "localField": "_id", "foreignField": "_id", "as": "user"}}},
+		{{Key: "$unwind", Value: "$user"}},
+	}
+	var pipeline mongo.Pipeline
+	if filter == nil {
+		pipeline = join
+	} else if usesUserFields(filter) {
+		pipeline = append(join, bson.D{{Key: "$match", Value: filter}})
+	} else {
+		// match first so lookups by _id do not join the whole collection
+		pipeline = append(mongo.Pipeline{{{Key: "$match", Value: filter}}}, join...)
+	}
+	o := options.MergeFindOptions(opts...)
+	if o.Sort != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: o.Sort}})
+	}
+	if o.Skip != nil && *o.Skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: *o.Skip}})
+	}
+	if o.Limit != nil && *o.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: *o.Limit}})
+	}
+	return pipeline
+}
+
+func usesUserFields(filter interface{}) bool {
+	m, ok := filter.(bson.M)
+	if !ok {
+		return true
+	}
+	for key := range m {
+		if strings.HasPrefix(key, "user.") || strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,19 +1,70 @@
 package user
 
 import (
+	"strings"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is the identity behind every account. There is one per email, stored in
+// the users collection; the student, tutor and admin profiles share its id.
+// PendingEmail is the address the user asked to change to until it is
+// confirmed.
 type User struct {
-	Email      string    `json:"email" bson:"email"`
-	Password   string    `json:"-" bson:"password"`
-	Firstname  string    `json:"firstname" bson:"firstname"`
-	Lastname   string    `json:"lastname" bson:"lastname"`
-	IsVerified bool      `json:"is_verified" bson:"is_verified"`
-	Role       Role      `json:"role" bson:"role"`
-	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+	Id           primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	Email        string             `json:"email" bson:"email"`
+	Password     string             `json:"-" bson:"password"`
+	Firstname    string             `json:"firstname" bson:"firstname"`
+	Lastname     string             `json:"lastname" bson:"lastname"`
+	IsVerified   bool               `json:"is_verified" bson:"is_verified"`
+	Suspended    bool               `json:"suspended" bson:"suspended"`
+	Role         Role               `json:"role" bson:"role"`
+	Roles        []Role             `json:"roles" bson:"roles,omitempty"`
+	TwoFactor    *TwoFactor         `json:"two_factor,omitempty" bson:"two_factor,omitempty"`
+	Identities   []Identity         `json:"identities,omitempty" bson:"identities,omitempty"`
+	PendingEmail string             `json:"pending_email,omitempty" bson:"pending_email,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// TwoFactor is the TOTP second factor of a user. Secret is set when enrollment
+// starts and Enabled once the user has confirmed a code from their app.
+type TwoFactor struct {
+	Enabled       bool       `json:"enabled" bson:"enabled"`
+	Secret        string     `json:"-" bson:"secret"`
+	RecoveryCodes []string   `json:"-" bson:"recovery_codes"`
+	LastStep      int64      `json:"-" bson:"last_step"`
+	EnabledAt     *time.Time `json:"enabled_at,omitempty" bson:"enabled_at,omitempty"`
+}
+
+// Identity links a user to their account at an OpenID Connect provider.
+type Identity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	Email    string    `json:"email" bson:"email"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// NormalizeEmail returns the form emails are stored and looked up in, so the
+// same address in a different case is the same identity.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
+
+// GetRoles returns every role the user holds. Accounts created before users
+// could hold more than one role only have Role set.
+func (u *User) GetRoles() []Role {
+	if len(u.Roles) == 0 {
+		return []Role{u.Role}
+	}
+	return u.Roles
+}
+
 type Role string
 
 const (
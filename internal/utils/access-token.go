@@ -11,76 +11,158 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected: session revoked")
+)
+
+// AccessDetails is one login session. The access and refresh token pair of a
+// session is rotated on every refresh, and the document _id identifies the
+// token family so that a replayed refresh token revokes the whole session.
 type AccessDetails struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	AccessUuid string             `json:"access_uuid" bson:"access_uuid"`
-	UserId     primitive.ObjectID `json:"user_id" bson:"user_id"`
-	ExpireAt   time.Time          `json:"expire_at" bson:"expire_at"`
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	AccessUuid       string             `json:"access_uuid" bson:"access_uuid"`
+	RefreshUuid      string             `json:"-" bson:"refresh_uuid"`
+	UsedRefreshUuids []string           `json:"-" bson:"used_refresh_uuids"`
+	UserId           primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ExpireAt         time.Time          `json:"expire_at" bson:"expire_at"`
+	RefreshExpireAt  time.Time          `json:"refresh_expire_at" bson:"refresh_expire_at"`
+	UserAgent        string             `json:"user_agent" bson:"user_agent"`
+	Ip               string             `json:"ip" bson:"ip"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AccessClaims are the roles and permissions an access token carries, so
+// authorization does not need a database lookup on every request.
+type AccessClaims struct {
+	Roles       []string
+	Permissions []string
+}
+
+// AccessTokenMetadata is what a validated access token says about its bearer.
+type AccessTokenMetadata struct {
+	AccessUuid  string
+	UserId      primitive.ObjectID
+	Roles       []string
+	Permissions []string
 }
 
+// AccessTokenManager issues the tokens of a session. Both are signed with the
+// keyring and carry the standard iss, aud, iat and sub claims; the audience of
+// refresh tokens is the refresh endpoint, so they are not accepted as access
+// tokens by other services.
 type AccessTokenManager struct {
-	accessTokenSecret          string
-	accessTokenValidityInHours int64
+	keyring                    *Keyring
+	issuer                     string
+	audience                   string
+	accessTokenValidityInSecs  int64
+	refreshTokenValidityInSecs int64
 	db                         db.IDatabase
 }
 
 type AccessTokenDetails struct {
-	AccessToken string `json:"access_token"`
-	AcessUuid   string `json:"-"`
-	AtExpires   int64  `json:"at_expires"`
+	AccessToken  string `json:"access_token"`
+	AcessUuid    string `json:"-"`
+	AtExpires    int64  `json:"at_expires"`
+	RefreshToken string `json:"refresh_token"`
+	RefreshUuid  string `json:"-"`
+	RtExpires    int64  `json:"rt_expires"`
+}
+
+// NewTokenAccessManager issues tokens for the API at audience. The issuer is
+// where the JWKS to verify them is published.
+func NewTokenAccessManager(keyring *Keyring, issuer, audience string, accessTokenValidityInSecs int64, refreshTokenValidityInSecs int64, db db.IDatabase) *AccessTokenManager {
+	return &AccessTokenManager{keyring: keyring, issuer: issuer, audience: audience, accessTokenValidityInSecs: accessTokenValidityInSecs, refreshTokenValidityInSecs: refreshTokenValidityInSecs, db: db}
 }
 
-func NewTokenAccessManager(accessTokenSecret string, accessTokenValidityInHours int64, db db.IDatabase) *AccessTokenManager {
-	return &AccessTokenManager{accessTokenSecret: accessTokenSecret, accessTokenValidityInHours: accessTokenValidityInHours, db: db}
+func (atm *AccessTokenManager) refreshAudience() string {
+	return atm.audience + "/token/refresh"
 }
 
-func createAccessToken(userId primitive.ObjectID, uuid string, expires int64, secret string) (string, error) {
+func (atm *AccessTokenManager) createAccessToken(userId primitive.ObjectID, uuid string, access AccessClaims, expires int64) (string, error) {
 	claims := jwt.MapClaims{}
-	claims["user_id"] = userId
+	claims["iss"] = atm.issuer
+	claims["aud"] = atm.audience
+	claims["sub"] = userId.Hex()
+	claims["iat"] = time.Now().Unix()
 	claims["access_uuid"] = uuid
+	claims["roles"] = access.Roles
+	claims["permissions"] = access.Permissions
 	claims["exp"] = expires
 	claims["authorized"] = true
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return at.SignedString([]byte(secret))
+	return atm.keyring.Sign(claims)
 }
 
-func (atm *AccessTokenManager) GenerateAccessToken(userId primitive.ObjectID) (*AccessTokenDetails, error) {
+func (atm *AccessTokenManager) createRefreshToken(userId primitive.ObjectID, uuid string, expires int64) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["iss"] = atm.issuer
+	claims["aud"] = atm.refreshAudience()
+	claims["sub"] = userId.Hex()
+	claims["iat"] = time.Now().Unix()
+	claims["refresh_uuid"] = uuid
+	claims["exp"] = expires
+	return atm.keyring.Sign(claims)
+}
+
+// parse verifies a token of ours meant for audience.
+func (atm *AccessTokenManager) parse(token, audience string) (*jwt.Token, error) {
+	return atm.keyring.Parse(token, jwt.MapClaims{},
+		jwt.WithIssuer(atm.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+}
+
+// JWKS returns the keys that verify the tokens.
+func (atm *AccessTokenManager) JWKS() JSONWebKeySet {
+	return atm.keyring.JWKS()
+}
+
+func (atm *AccessTokenManager) GenerateAccessToken(userId primitive.ObjectID, claims AccessClaims) (*AccessTokenDetails, error) {
 	atd := &AccessTokenDetails{}
-	atd.AtExpires = time.Now().Add(time.Hour * time.Duration(atm.accessTokenValidityInHours)).Unix()
+	atd.AtExpires = time.Now().Add(time.Second * time.Duration(atm.accessTokenValidityInSecs)).Unix()
 	atd.AcessUuid = uuid.New().String()
+	atd.RtExpires = time.Now().Add(time.Second * time.Duration(atm.refreshTokenValidityInSecs)).Unix()
+	atd.RefreshUuid = uuid.New().String()
 
-	accessToken, err := createAccessToken(userId, atd.AcessUuid, atd.AtExpires, atm.accessTokenSecret)
+	accessToken, err := atm.createAccessToken(userId, atd.AcessUuid, claims, atd.AtExpires)
 	if err != nil {
 		return nil, err
 	}
 	if accessToken == "" {
 		return nil, errors.New("access token is empty")
 	}
-	atd.AccessToken = accessToken
-	return atd, nil
-}
-
-func (atm *AccessTokenManager) SaveAccessToken(userId primitive.ObjectID, atd *AccessTokenDetails) error {
-	exists, err := atm.accessTokenExists(userId)
+	refreshToken, err := atm.createRefreshToken(userId, atd.RefreshUuid, atd.RtExpires)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if exists {
-		if err := atm.DeleteAccessToken(bson.M{"user_id": userId}); err != nil {
-			return err
-		}
+	if refreshToken == "" {
+		return nil, errors.New("refresh token is empty")
 	}
-	return atm.saveToken(userId, atd)
+	atd.AccessToken = accessToken
+	atd.RefreshToken = refreshToken
+	return atd, nil
 }
-func (atm *AccessTokenManager) saveToken(userId primitive.ObjectID, atd *AccessTokenDetails) error {
+
+// SaveAccessToken starts a new session for the user. Existing sessions on other
+// devices are left untouched.
+func (atm *AccessTokenManager) SaveAccessToken(userId primitive.ObjectID, atd *AccessTokenDetails, client ClientInfo) error {
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
 	_, err := atm.db.InsertOne(ctx, &AccessDetails{
-		AccessUuid: atd.AcessUuid,
-		UserId:     userId,
-		ExpireAt:   time.Unix(atd.AtExpires, 0),
+		AccessUuid:       atd.AcessUuid,
+		RefreshUuid:      atd.RefreshUuid,
+		UsedRefreshUuids: []string{},
+		UserId:           userId,
+		ExpireAt:         time.Unix(atd.AtExpires, 0),
+		RefreshExpireAt:  time.Unix(atd.RtExpires, 0),
+		UserAgent:        client.UserAgent,
+		Ip:               client.Ip,
+		CreatedAt:        time.Now(),
 	})
 	return err
 }
@@ -92,18 +174,109 @@ func (atm *AccessTokenManager) DeleteAccessToken(filter interface{}) error {
 	return err
 }
 
-func (atm *AccessTokenManager) accessTokenExists(userId primitive.ObjectID) (bool, error) {
+func (atm *AccessTokenManager) DeleteAccessTokens(filter interface{}) (int64, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	res, err := atm.db.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (atm *AccessTokenManager) GetAccessTokens(filter interface{}) ([]*AccessDetails, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	var sessions []*AccessDetails
+	cursor, err := atm.db.Find(ctx, filter, options.Find().SetSort(bson.D{
+		primitive.E{Key: "created_at", Value: -1},
+	}))
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &sessions)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RefreshAccessToken exchanges a refresh token for a new token pair in the same
+// session. Presenting a refresh token that was already rotated revokes the session.
+// The claims of the new access token come from accessClaims, so role and permission
+// changes take effect on the next refresh.
+func (atm *AccessTokenManager) RefreshAccessToken(refreshToken string, accessClaims func(userId primitive.ObjectID) (AccessClaims, error)) (*AccessTokenDetails, error) {
+	token, err := atm.parse(refreshToken, atm.refreshAudience())
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidRefreshToken
+	}
+	refreshUuid, ok := claims["refresh_uuid"].(string)
+	if !ok || refreshUuid == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	userId, ok := claims["sub"].(string)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	userID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
-	err := atm.db.FindOne(ctx, bson.M{"user_id": userId}).Err()
+	var session AccessDetails
+	err = atm.db.FindOne(ctx, bson.M{"refresh_uuid": refreshUuid, "user_id": userID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		var reused AccessDetails
+		if err := atm.db.FindOne(ctx, bson.M{"used_refresh_uuids": refreshUuid, "user_id": userID}).Decode(&reused); err == nil {
+			if err := atm.DeleteAccessToken(bson.M{"_id": reused.ID}); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrInvalidRefreshToken
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return false, nil
+		return nil, err
+	}
+	if time.Now().After(session.RefreshExpireAt) {
+		if err := atm.DeleteAccessToken(bson.M{"_id": session.ID}); err != nil {
+			return nil, err
 		}
-		return false, err
+		return nil, ErrInvalidRefreshToken
+	}
+
+	access, err := accessClaims(userID)
+	if err != nil {
+		return nil, err
+	}
+	atd, err := atm.GenerateAccessToken(userID, access)
+	if err != nil {
+		return nil, err
+	}
+	res, err := atm.db.UpdateOne(ctx, bson.M{"_id": session.ID, "refresh_uuid": refreshUuid}, bson.M{
+		"$set": bson.M{
+			"access_uuid":       atd.AcessUuid,
+			"refresh_uuid":      atd.RefreshUuid,
+			"expire_at":         time.Unix(atd.AtExpires, 0),
+			"refresh_expire_at": time.Unix(atd.RtExpires, 0),
+		},
+		"$push": bson.M{"used_refresh_uuids": refreshUuid},
+	})
+	if err != nil {
+		return nil, err
 	}
-	return true, nil
+	if res.MatchedCount == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	return atd, nil
 }
+
 func (atm *AccessTokenManager) FindAccessToken(uuid string) (*AccessDetails, error) {
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
@@ -115,16 +288,11 @@ func (atm *AccessTokenManager) FindAccessToken(uuid string) (*AccessDetails, err
 	return &accessDetails, nil
 }
 
-func (atm *AccessTokenManager) ValidateAccessToken(token string, secret string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(secret), nil
-	})
+func (atm *AccessTokenManager) ValidateAccessToken(token string) (*jwt.Token, error) {
+	return atm.parse(token, atm.audience)
 }
 
-func (atm *AccessTokenManager) ExtractAccessTokenMetadata(token *jwt.Token) (*AccessDetails, error) {
+func (atm *AccessTokenManager) ExtractAccessTokenMetadata(token *jwt.Token) (*AccessTokenMetadata, error) {
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
 		return nil, errors.New("unauthorized")
@@ -135,7 +303,7 @@ func (atm *AccessTokenManager) ExtractAccessTokenMetadata(token *jwt.Token) (*Ac
 		return nil, errors.New("unauthorized")
 	}
 
-	userId, ok := claims["user_id"].(string)
+	userId, ok := claims["sub"].(string)
 	if !ok || userId == "" {
 		return nil, errors.New("unauthorized")
 	}
@@ -144,20 +312,36 @@ func (atm *AccessTokenManager) ExtractAccessTokenMetadata(token *jwt.Token) (*Ac
 		return nil, errors.New("unauthorized")
 	}
 
-	return &AccessDetails{
-		AccessUuid: accessUuid,
-		UserId:     userID,
+	return &AccessTokenMetadata{
+		AccessUuid:  accessUuid,
+		UserId:      userID,
+		Roles:       stringsClaim(claims["roles"]),
+		Permissions: stringsClaim(claims["permissions"]),
 	}, nil
 }
 
+func stringsClaim(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+	strs := []string{}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
 type IMiddlewareAccessTokenManager interface {
-	ExtractAccessTokenMetadata(token *jwt.Token) (*AccessDetails, error)
-	ValidateAccessToken(token string, secret string) (*jwt.Token, error)
+	ExtractAccessTokenMetadata(token *jwt.Token) (*AccessTokenMetadata, error)
+	ValidateAccessToken(token string) (*jwt.Token, error)
 	FindAccessToken(uuid string) (*AccessDetails, error)
 }
 
 type IAccessTokenManager interface {
-	SaveAccessToken(userId primitive.ObjectID, atd *AccessTokenDetails) error
-	GenerateAccessToken(userId primitive.ObjectID) (*AccessTokenDetails, error)
+	SaveAccessToken(userId primitive.ObjectID, atd *AccessTokenDetails, client ClientInfo) error
+	GenerateAccessToken(userId primitive.ObjectID, claims AccessClaims) (*AccessTokenDetails, error)
 	DeleteAccessToken(filter interface{}) error
+	DeleteAccessTokens(filter interface{}) (int64, error)
+	GetAccessTokens(filter interface{}) ([]*AccessDetails, error)
+	RefreshAccessToken(refreshToken string, claims func(userId primitive.ObjectID) (AccessClaims, error)) (*AccessTokenDetails, error)
 }
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// MaxAvatarBytes is the largest avatar upload accepted.
+	MaxAvatarBytes = 5 << 20
+	// avatarSize is the width and height avatars are stored at.
+	avatarSize = 256
+	// maxAvatarPixels keeps small files that decode to huge images out.
+	maxAvatarPixels = 40_000_000
+)
+
+var (
+	ErrInvalidImage  = errors.New("avatar must be a JPEG, PNG or GIF image")
+	ErrImageTooLarge = errors.New("avatar image is too large")
+)
+
+// AvatarManager stores avatars in a BlobStore and serves them from
+// <baseUrl>/avatars/<key>. Every upload gets a new key, so the URLs can be
+// cached forever.
+type AvatarManager struct {
+	store   BlobStore
+	baseUrl string
+}
+
+func NewAvatarManager(store BlobStore, baseUrl string) *AvatarManager {
+	return &AvatarManager{store: store, baseUrl: baseUrl}
+}
+
+// SaveAvatar crops the image in data to a square, scales it down to 256x256
+// and stores it as a JPEG. It returns the URL of the avatar.
+func (am *AvatarManager) SaveAvatar(userId primitive.ObjectID, data []byte) (string, error) {
+	avatar, err := resizeAvatar(data, avatarSize)
+	if err != nil {
+		return "", err
+	}
+	suffix, err := CreateSecretToken()
+	if err != nil {
+		return "", err
+	}
+	key := userId.Hex() + "-" + suffix[:12] + ".jpg"
+	if err := am.store.Put(key, avatar); err != nil {
+		return "", err
+	}
+	return am.baseUrl + "/avatars/" + key, nil
+}
+
+// DeleteAvatar removes the avatar at avatarUrl. URLs not made by SaveAvatar are
+// ignored.
+func (am *AvatarManager) DeleteAvatar(avatarUrl string) error {
+	key, ok := strings.CutPrefix(avatarUrl, am.baseUrl+"/avatars/")
+	if !ok {
+		return nil
+	}
+	return am.store.Delete(key)
+}
+
+// GetAvatar returns the avatar stored under key and its content type.
+func (am *AvatarManager) GetAvatar(key string) ([]byte, string, error) {
+	return am.store.Get(key)
+}
+
+func resizeAvatar(data []byte, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > maxAvatarPixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	// the centre square, on white so transparent images do not turn black
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), image.White, image.Point{}, draw.Src)
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	draw.Draw(square, square.Bounds(), src, origin, draw.Over)
+
+	// small images are not scaled up
+	if side < size {
+		size = side
+	}
+	// every avatar pixel is the average of the square's pixels it covers
+	avatar := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				i := square.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(square.Pix[i])
+					g += int(square.Pix[i+1])
+					b += int(square.Pix[i+2])
+					i += 4
+					n++
+				}
+			}
+			o := avatar.PixOffset(x, y)
+			avatar.Pix[o], avatar.Pix[o+1], avatar.Pix[o+2], avatar.Pix[o+3] = uint8(r/n), uint8(g/n), uint8(b/n), 255
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, avatar, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type IAvatarManager interface {
+	SaveAvatar(userId primitive.ObjectID, data []byte) (string, error)
+	DeleteAvatar(avatarUrl string) error
+	GetAvatar(key string) ([]byte, string, error)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"errors"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrBlobNotFound = errors.New("file not found")
+
+// BlobStore keeps uploaded files, such as avatars, under a key chosen by the
+// caller. The extension of the key gives the content type.
+type BlobStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, string, error)
+	Delete(key string) error
+}
+
+// LocalBlobStore keeps every blob as a file in one directory.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+// path maps key to its file, refusing keys that would leave the directory.
+func (lbs *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, ".") || strings.ContainsAny(key, `/\`) {
+		return "", ErrBlobNotFound
+	}
+	return filepath.Join(lbs.dir, key), nil
+}
+
+func (lbs *LocalBlobStore) Put(key string, data []byte) error {
+	path, err := lbs.path(key)
+	if err != nil {
+		return err
+	}
+	// written aside and renamed, so a blob is never read half written
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (lbs *LocalBlobStore) Get(key string) ([]byte, string, error) {
+	path, err := lbs.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return data, contentType, nil
+}
+
+// Delete removes the blob at key. Deleting a missing blob is not an error.
+func (lbs *LocalBlobStore) Delete(key string) error {
+	path, err := lbs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// NewBlobStore picks a blob store by name. Only "local" (the default) exists
+// so far; other stores, such as S3, only have to implement BlobStore.
+func NewBlobStore(backend string, config BlobStoreConfig) (BlobStore, error) {
+	switch backend {
+	case "", "local":
+		dir := config.Dir
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocalBlobStore(dir)
+	}
+	return nil, errors.New("unknown blob store " + backend)
+}
+
+type BlobStoreConfig struct {
+	Dir string
+}
@@ -3,35 +3,40 @@ package utils
 import (
 	"bytes"
 	"html/template"
-
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"time"
 )
 
 type EmailManager struct {
 	SenderEmail string
 	SenderName  string
-	ApiKey      string
+	mailer      Mailer
 }
 
-func NewEmailManager(senderEmail, senderName, apiKey string) *EmailManager {
+func NewEmailManager(senderEmail, senderName string, mailer Mailer) *EmailManager {
 	return &EmailManager{
 		SenderEmail: senderEmail,
 		SenderName:  senderName,
-		ApiKey:      apiKey,
+		mailer:      mailer,
 	}
 }
 func (eu *EmailManager) sendEmail(tokenUrl, subject, email, firstname, title, h1, p string) error {
-	from := mail.NewEmail(eu.SenderName, eu.SenderEmail)
-	to := mail.NewEmail(firstname, email)
 	htmlContent, err := eu.emailHTML(tokenUrl, firstname, title, h1, p)
 	if err != nil {
 		return err
 	}
-	message := mail.NewSingleEmail(from, subject, to, "", htmlContent)
-	client := sendgrid.NewSendClient(eu.ApiKey)
-	_, err = client.Send(message)
-	return err
+	textContent := "Dear " + firstname + ",\n\n" + p + "\n"
+	if tokenUrl != "" {
+		textContent += "\n" + tokenUrl + "\n"
+	}
+	return eu.mailer.Send(&EmailMessage{
+		FromName:  eu.SenderName,
+		FromEmail: eu.SenderEmail,
+		ToName:    firstname,
+		ToEmail:   email,
+		Subject:   subject,
+		Text:      textContent,
+		HTML:      htmlContent,
+	})
 }
 
 func (eu *EmailManager) emailHTML(tokenUrl, firstname, title, h1, p string) (string, error) {
@@ -89,8 +94,10 @@ func (eu *EmailManager) emailHTML(tokenUrl, firstname, title, h1, p string) (str
 				<h1>{{.H1}}</h1>
 				<p>Dear <span class="firstname">{{.Firstname}}</span>,</p>
 				<p>{{.P}}</p>
+				{{if .TokenUrl}}
 				<p>Please click the button below to confirm your email address:</p>
 				<button> <a href="{{.TokenUrl}}">Confirm Email<a/></button>
+				{{end}}
 				<p class="footer">This email was sent by {{.Sendername}}</p>
 			</div>
 		</body>
@@ -136,7 +143,106 @@ func (eu *EmailManager) SendResetPasswordToken(email, firstname, tokenUrl string
 	return eu.sendEmail(tokenUrl, subject, email, firstname, title, h1, p)
 }
 
+func (eu *EmailManager) SendAccountLocked(email, firstname, tokenUrl string) error {
+	subject := "Your " + eu.SenderName + " account has been locked"
+	title := "Account Locked"
+	h1 := "Account Locked"
+	p := "We locked your account for 30 minutes after too many failed login attempts. If this was you, use the link below to unlock it now. If it was not, someone may be guessing your password; consider changing it."
+	return eu.sendEmail(tokenUrl, subject, email, firstname, title, h1, p)
+}
+
+func (eu *EmailManager) SendMagicLink(email, firstname, tokenUrl string) error {
+	subject := "Your " + eu.SenderName + " login link"
+	title := "Login Link"
+	h1 := "Login Link"
+	p := "Use the link below to log in. It works once and expires in 15 minutes. If you did not ask for it, you can ignore this email."
+	return eu.sendEmail(tokenUrl, subject, email, firstname, title, h1, p)
+}
+
+func (eu *EmailManager) SendEmailChangeVerification(email, firstname, tokenUrl string) error {
+	subject := "Confirm your new " + eu.SenderName + " email"
+	title := "Email Change"
+	h1 := "Confirm Your New Email"
+	p := "Use the link below to make this address the email of your account. It expires in 24 hours. If you did not ask for this, you can ignore this email."
+	return eu.sendEmail(tokenUrl, subject, email, firstname, title, h1, p)
+}
+
+func (eu *EmailManager) SendEmailChangeNotice(email, firstname, newEmail string) error {
+	subject := "Your " + eu.SenderName + " email is being changed"
+	title := "Email Change"
+	h1 := "Email Change Requested"
+	p := "Someone logged in to your account asked to change its email to " + newEmail + ". Once the new address is confirmed, you will log in with it and emails will no longer be sent here. If this was not you, reset your password and log out of every session now."
+	return eu.sendEmail("", subject, email, firstname, title, h1, p)
+}
+
+func (eu *EmailManager) SendTutorApplicationDecision(email, firstname string, approved bool, reason string) error {
+	subject := "Your " + eu.SenderName + " tutor application"
+	title := "Tutor Application"
+	h1 := "Tutor Application Approved"
+	p := "Congratulations! Your tutor application has been approved and students can now find and register you."
+	if !approved {
+		h1 = "Tutor Application Rejected"
+		p = "Unfortunately your tutor application was not approved. Reason: " + reason + ". You can update your application and submit it again."
+	}
+	return eu.sendEmail("", subject, email, firstname, title, h1, p)
+}
+
+// BookingEmail describes a lesson in a booking notification. Times are shown in
+// Timezone.
+type BookingEmail struct {
+	SubjectName      string
+	With             string
+	StartsAt         time.Time
+	EndsAt           time.Time
+	PreviousStartsAt time.Time
+	Timezone         string
+	Reason           string
+}
+
+func (be BookingEmail) format(t time.Time) string {
+	loc, err := time.LoadLocation(be.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format("Mon, 02 Jan 2006 15:04 MST")
+}
+
+func (eu *EmailManager) SendBookingConfirmation(email, firstname string, booking BookingEmail) error {
+	subject := "Lesson booked: " + booking.SubjectName + " with " + booking.With
+	title := "Lesson Booked"
+	h1 := "Lesson Booked"
+	p := "Your " + booking.SubjectName + " lesson with " + booking.With + " is confirmed for " + booking.format(booking.StartsAt) + " to " + booking.format(booking.EndsAt) + "."
+	return eu.sendEmail("", subject, email, firstname, title, h1, p)
+}
+
+func (eu *EmailManager) SendBookingRescheduled(email, firstname string, booking BookingEmail) error {
+	subject := "Lesson rescheduled: " + booking.SubjectName + " with " + booking.With
+	title := "Lesson Rescheduled"
+	h1 := "Lesson Rescheduled"
+	p := "Your " + booking.SubjectName + " lesson with " + booking.With + " on " + booking.format(booking.PreviousStartsAt) + " has been moved to " + booking.format(booking.StartsAt) + " to " + booking.format(booking.EndsAt) + "."
+	return eu.sendEmail("", subject, email, firstname, title, h1, p)
+}
+
+func (eu *EmailManager) SendBookingCancellation(email, firstname string, booking BookingEmail) error {
+	subject := "Lesson cancelled: " + booking.SubjectName + " with " + booking.With
+	title := "Lesson Cancelled"
+	h1 := "Lesson Cancelled"
+	p := "Your " + booking.SubjectName + " lesson with " + booking.With + " on " + booking.format(booking.StartsAt) + " has been cancelled."
+	if booking.Reason != "" {
+		p += " Reason: " + booking.Reason
+	}
+	return eu.sendEmail("", subject, email, firstname, title, h1, p)
+}
+
 type IEmailManager interface {
 	SendSignUpVerificationToken(email, firstname, tokenUrl string) error
 	SendResetPasswordToken(email, firstname, tokenUrl string) error
+	SendAccountLocked(email, firstname, tokenUrl string) error
+	SendMagicLink(email, firstname, tokenUrl string) error
+	SendEmailChangeVerification(email, firstname, tokenUrl string) error
+	SendEmailChangeNotice(email, firstname, newEmail string) error
+	SendTutorApplicationDecision(email, firstname string, approved bool, reason string) error
+	SendBookingConfirmation(email, firstname string, booking BookingEmail) error
+	SendBookingRescheduled(email, firstname string, booking BookingEmail) error
+	SendBookingCancellation(email, firstname string, booking BookingEmail) error
 }
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a key tokens are signed with or, without PrivateKey, a retired
+// key whose tokens are still accepted. Id is sent as the kid header.
+type SigningKey struct {
+	Id         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// JSONWebKey is the public half of a SigningKey as published in the JWKS.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// Keyring signs tokens with one key and verifies them with any of its keys, so
+// a new key can take over while tokens signed with the previous one are still
+// in use.
+type Keyring struct {
+	signingKey *SigningKey
+	keys       map[string]*SigningKey
+}
+
+// NewKeyring signs with the key signingKeyId, or with the last key by id if it
+// is empty.
+func NewKeyring(keys []*SigningKey, signingKeyId string) (*Keyring, error) {
+	kr := &Keyring{keys: map[string]*SigningKey{}}
+	for _, key := range keys {
+		if _, ok := kr.keys[key.Id]; ok {
+			return nil, errors.New("duplicate signing key id " + key.Id)
+		}
+		kr.keys[key.Id] = key
+		if key.PrivateKey == nil {
+			continue
+		}
+		if key.Id == signingKeyId || (signingKeyId == "" && (kr.signingKey == nil || key.Id > kr.signingKey.Id)) {
+			kr.signingKey = key
+		}
+	}
+	if kr.signingKey == nil {
+		if signingKeyId != "" {
+			return nil, errors.New("no private key with id " + signingKeyId)
+		}
+		return nil, errors.New("no private key to sign tokens with")
+	}
+	return kr, nil
+}
+
+// LoadKeyring reads the PEM encoded keys in dir, each named <key id>.pem. PKCS#8
+// RSA and Ed25519 private keys can sign; public keys are only used to verify.
+func LoadKeyring(dir, signingKeyId string) (*Keyring, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := []*SigningKey{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseSigningKey(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, errors.New(file + ": " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyring(keys, signingKeyId)
+}
+
+// NewEphemeralKeyring returns a keyring with a fresh Ed25519 key that only
+// lives as long as the process.
+func NewEphemeralKeyring() (*Keyring, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id, err := CreateSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring([]*SigningKey{{Id: "ephemeral-" + id[:8], Method: jwt.SigningMethodEdDSA, PrivateKey: privateKey, PublicKey: publicKey}}, "")
+}
+
+// ParseSigningKey parses a PEM encoded RSA or Ed25519 key.
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported PEM block " + block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{Id: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	if rsaKey, ok := key.PublicKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must have at least 2048 bits")
+	}
+	return key, nil
+}
+
+// Sign signs claims with the current signing key.
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.signingKey.Method, claims)
+	token.Header["kid"] = kr.signingKey.Id
+	return token.SignedString(kr.signingKey.PrivateKey)
+}
+
+// Parse verifies tokenString with the key named by its kid header, which
+// must use the algorithm the token claims to be signed with.
+func (kr *Keyring) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	methods := []string{}
+	for _, key := range kr.keys {
+		methods = append(methods, key.Method.Alg())
+	}
+	opts = append(opts, jwt.WithValidMethods(methods))
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := kr.keys[kid]
+		if !ok || key.Method.Alg() != token.Method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key.PublicKey, nil
+	}, opts...)
+}
+
+// JWKS returns the public keys, so other services can verify our tokens.
+func (kr *Keyring) JWKS() JSONWebKeySet {
+	ids := []string{}
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, id := range ids {
+		key := kr.keys[id]
+		jwk := JSONWebKey{Kid: key.Id, Use: "sig", Alg: key.Method.Alg()}
+		switch k := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newRSASigningKey(t *testing.T, id string) *SigningKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SigningKey{Id: id, Method: jwt.SigningMethodRS256, PrivateKey: k, PublicKey: &k.PublicKey}
+}
+
+func newEd25519SigningKey(t *testing.T, id string) *SigningKey {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SigningKey{Id: id, Method: jwt.SigningMethodEdDSA, PrivateKey: privateKey, PublicKey: publicKey}
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "user-1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func TestNewKeyring(t *testing.T) {
+	rsaKey := newRSASigningKey(t, "2024-01")
+	edKey := newEd25519SigningKey(t, "2025-01")
+	retired := &SigningKey{Id: "2026-01", Method: edKey.Method, PublicKey: edKey.PublicKey}
+	tests := []struct {
+		name         string
+		keys         []*SigningKey
+		signingKeyId string
+		want         string
+	}{
+		{"last key by id", []*SigningKey{edKey, rsaKey}, "", "2025-01"},
+		{"chosen key", []*SigningKey{edKey, rsaKey}, "2024-01", "2024-01"},
+		{"retired keys cannot sign", []*SigningKey{rsaKey, retired}, "", "2024-01"},
+		{"duplicate id", []*SigningKey{rsaKey, rsaKey}, "", ""},
+		{"unknown signing key", []*SigningKey{rsaKey}, "2023-01", ""},
+		{"chosen key is retired", []*SigningKey{rsaKey, retired}, "2026-01", ""},
+		{"no private key", []*SigningKey{retired}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := NewKeyring(tt.keys, tt.signingKeyId)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("signs with %s, want an error", kr.signingKey.Id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kr.signingKey.Id != tt.want {
+				t.Errorf("signs with %s, want %s", kr.signingKey.Id, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringSignAndParse(t *testing.T) {
+	for _, key := range []*SigningKey{newRSASigningKey(t, "rsa"), newEd25519SigningKey(t, "ed")} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			kr, err := NewKeyring([]*SigningKey{key}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := testClaims()
+			tokenString, err := kr.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed := &jwt.RegisteredClaims{}
+			token, err := kr.Parse(tokenString, parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Header["kid"] != key.Id || parsed.Subject != claims.Subject {
+				t.Errorf("got kid %v and subject %q", token.Header["kid"], parsed.Subject)
+			}
+		})
+	}
+}
+
+// Tokens signed before a key was retired keep working until they expire,
+// while new tokens are signed with the key that took over.
+func TestKeyringRetiredKeyStillVerifies(t *testing.T) {
+	old := newEd25519SigningKey(t, "2024-01")
+	before, err := NewKeyring([]*SigningKey{old}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenString, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired := &SigningKey{Id: old.Id, Method: old.Method, PublicKey: old.PublicKey}
+	after, err := NewKeyring([]*SigningKey{retired, newRSASigningKey(t, "2025-01")}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Parse(tokenString, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("a token of the retired key was rejected: %v", err)
+	}
+	newToken, err := after.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := after.Parse(newToken, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "2025-01" {
+		t.Errorf("signed with %v, want 2025-01", token.Header["kid"])
+	}
+}
+
+func TestKeyringParseRejects(t *testing.T) {
+	rsaKey := newRSASigningKey(t, "rsa")
+	edKey := newEd25519SigningKey(t, "ed")
+	kr, err := NewKeyring([]*SigningKey{rsaKey, edKey}, "ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		tokenString, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenString
+	}
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PrivateKey.(*rsa.PrivateKey).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, token string
+	}{
+		{"RS256 token naming the Ed25519 key", sign(jwt.SigningMethodRS256, "ed", rsaKey.PrivateKey)},
+		{"EdDSA token naming the RSA key", sign(jwt.SigningMethodEdDSA, "rsa", edKey.PrivateKey)},
+		{"HS256 keyed with the RSA public key", sign(jwt.SigningMethodHS256, "rsa", rsaPublicDER)},
+		{"unknown kid", sign(jwt.SigningMethodEdDSA, "other", edKey.PrivateKey)},
+		{"no kid", sign(jwt.SigningMethodEdDSA, nil, edKey.PrivateKey)},
+		{"kid is not a string", sign(jwt.SigningMethodEdDSA, 1, edKey.PrivateKey)},
+		{"signed with another key", sign(jwt.SigningMethodEdDSA, "ed", newEd25519SigningKey(t, "ed").PrivateKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := kr.Parse(tt.token, &jwt.RegisteredClaims{}); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+}
+
+func TestKeyringJWKS(t *testing.T) {
+	rsaKey := newRSASigningKey(t, "b-rsa")
+	edKey := newEd25519SigningKey(t, "a-ed")
+	retired := newRSASigningKey(t, "c-retired")
+	retired.PrivateKey = nil
+	kr, err := NewKeyring([]*SigningKey{rsaKey, retired, edKey}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := kr.JWKS()
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("got %d keys, want 3", len(jwks.Keys))
+	}
+	for i, kid := range []string{"a-ed", "b-rsa", "c-retired"} {
+		if jwks.Keys[i].Kid != kid || jwks.Keys[i].Use != "sig" {
+			t.Errorf("key %d is %+v, want kid %s for signatures", i, jwks.Keys[i], kid)
+		}
+	}
+
+	ed := jwks.Keys[0]
+	x, _ := base64.RawURLEncoding.DecodeString(ed.X)
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || !edKey.PublicKey.(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Errorf("got %+v for the Ed25519 key", ed)
+	}
+
+	rsaJWK := jwks.Keys[1]
+	n, _ := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	published := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || !published.Equal(rsaKey.PublicKey) {
+		t.Errorf("got %+v for the RSA key", rsaJWK)
+	}
+	// what we publish must be enough to verify our tokens, signed with b-rsa
+	tokenString, err := kr.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) { return published, nil }); err != nil {
+		t.Errorf("the published RSA key does not verify our token: %v", err)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rsaKey := newRSASigningKey(t, "2024-01").PrivateKey.(*rsa.PrivateKey)
+	write("2024-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edKey := newEd25519SigningKey(t, "2025-01")
+	der, err := x509.MarshalPKCS8PrivateKey(edKey.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("2025-01.pem", "PRIVATE KEY", der)
+	retired := newEd25519SigningKey(t, "2023-01")
+	der, err = x509.MarshalPKIXPublicKey(retired.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("2023-01.pem", "PUBLIC KEY", der)
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := LoadKeyring(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.signingKey.Id != "2025-01" || len(kr.keys) != 3 {
+		t.Errorf("signs with %s out of %d keys, want 2025-01 out of 3", kr.signingKey.Id, len(kr.keys))
+	}
+	if kr.keys["2023-01"].PrivateKey != nil || kr.keys["2024-01"].Method != jwt.SigningMethodRS256 {
+		t.Errorf("keys were not parsed as written")
+	}
+	if kr, err = LoadKeyring(dir, "2024-01"); err != nil || kr.signingKey.Id != "2024-01" {
+		t.Errorf("got %v, want to sign with 2024-01", err)
+	}
+	if _, err := LoadKeyring(dir, "2023-01"); err == nil {
+		t.Error("a public key was chosen to sign with")
+	}
+	if _, err := LoadKeyring(t.TempDir(), ""); err == nil {
+		t.Error("an empty directory gave a keyring")
+	}
+}
+
+func TestParseSigningKeyRejects(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not PEM", []byte("not a key")},
+		{"unsupported block", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}})},
+		{"corrupt key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}})},
+		{"small RSA key", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(small)})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSigningKey("key", tt.data); err == nil {
+				t.Error("key was accepted")
+			}
+		})
+	}
+}
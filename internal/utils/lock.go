@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrLocked is returned when a lock is still held by someone else after
+// waiting for it.
+var ErrLocked = errors.New("another request is changing this at the moment, try again")
+
+// Lock is a lease on a key, held by Owner until ExpiresAt.
+type Lock struct {
+	Key       string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Locker hands out leases stored in the database, so a check and the write
+// depending on it run without interleaving, across requests and instances. A
+// lease ends after ttl even if its holder never releases it.
+type Locker struct {
+	db   db.IDatabase
+	ttl  time.Duration
+	wait time.Duration
+}
+
+func NewLocker(db db.IDatabase, ttl time.Duration, wait time.Duration) *Locker {
+	return &Locker{db: db, ttl: ttl, wait: wait}
+}
+
+// InitLockExpiryIndex lets the database delete leases once they end.
+func InitLockExpiryIndex(database db.IDatabase) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := database.CreateIndex(ctx, indexModel)
+	if err != nil {
+		return errors.New("Error creating TTL index for locks collection:" + err.Error())
+	}
+	return nil
+}
+
+// Lock takes the leases on keys, waiting for each up to the wait of the
+// Locker, and returns a function releasing them. Keys are taken in sorted
+// order, so callers locking the same keys cannot deadlock each other.
+func (l *Locker) Lock(keys ...string) (func(), error) {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+	owner := uuid.NewString()
+	held := []string{}
+	unlock := func() {
+		for _, key := range held {
+			if err := l.release(key, owner); err != nil {
+				log.Println("lock release error: ", err)
+			}
+		}
+	}
+	for i, key := range keys {
+		if i > 0 && key == keys[i-1] {
+			continue
+		}
+		if err := l.acquire(key, owner); err != nil {
+			unlock()
+			return nil, err
+		}
+		held = append(held, key)
+	}
+	return unlock, nil
+}
+
+func (l *Locker) acquire(key, owner string) error {
+	deadline := time.Now().Add(l.wait)
+	for {
+		ctx, cancel := db.DBReqContext(5)
+		now := time.Now()
+		// only an ended lease matches; a held one makes the upsert insert a
+		// second document with the same _id, which the database refuses
+		_, err := l.db.UpdateOne(ctx,
+			bson.M{"_id": key, "expires_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"owner": owner, "expires_at": now.Add(l.ttl)}},
+			options.Update().SetUpsert(true))
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (l *Locker) release(key, owner string) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := l.db.DeleteOne(ctx, bson.M{"_id": key, "owner": owner})
+	return err
+}
+
+type ILocker interface {
+	Lock(keys ...string) (func(), error)
+}
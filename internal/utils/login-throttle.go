@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	LoginAttemptsEmail = "email"
+	LoginAttemptsIp    = "ip"
+)
+
+// LockoutPolicy decides how long logins are held back after failed attempts.
+// The first FreeAttempts failures cost nothing, each further one doubles the
+// wait from BaseDelay up to MaxDelay, and from LockoutAfter failures on the
+// email or IP address is locked for LockoutFor. Failures are forgotten after
+// ResetAfter without one.
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	LockoutFor   time.Duration
+	ResetAfter   time.Duration
+}
+
+func (lp LockoutPolicy) delay(failures int) time.Duration {
+	if failures >= lp.LockoutAfter {
+		return lp.LockoutFor
+	}
+	if failures <= lp.FreeAttempts {
+		return 0
+	}
+	delay := lp.BaseDelay
+	for i := lp.FreeAttempts + 1; i < failures && delay < lp.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > lp.MaxDelay {
+		delay = lp.MaxDelay
+	}
+	return delay
+}
+
+// LoginAttempts are the recent failed logins for one email or IP address.
+// They are kept per email whether or not an account exists, so lockouts do not
+// reveal which emails are registered.
+type LoginAttempts struct {
+	Key           string    `json:"-" bson:"_id"`
+	Kind          string    `json:"kind" bson:"kind"`
+	Subject       string    `json:"subject" bson:"subject"`
+	Failures      int       `json:"failures" bson:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until" bson:"locked_until"`
+	ExpireAt      time.Time `json:"-" bson:"expire_at"`
+}
+
+type LoginThrottle struct {
+	db            db.IDatabase
+	accountPolicy LockoutPolicy
+	ipPolicy      LockoutPolicy
+}
+
+func NewLoginThrottle(db db.IDatabase, accountPolicy, ipPolicy LockoutPolicy) *LoginThrottle {
+	return &LoginThrottle{db: db, accountPolicy: accountPolicy, ipPolicy: ipPolicy}
+}
+
+// InitLoginAttemptsExpiryIndex lets the database delete failed attempts once
+// they are forgotten.
+func InitLoginAttemptsExpiryIndex(database db.IDatabase) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.M{"expire_at": 1}, Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := database.CreateIndex(ctx, indexModel)
+	if err != nil {
+		return errors.New("Error creating TTL index for login attempts collection:" + err.Error())
+	}
+	return nil
+}
+
+// Check returns a *RateLimitError while logins for email or from ip are held
+// back.
+func (lt *LoginThrottle) Check(email, ip string) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	cursor, err := lt.db.Find(ctx, bson.M{"_id": bson.M{"$in": bson.A{LoginAttemptsEmail + ":" + email, LoginAttemptsIp + ":" + ip}}})
+	if err != nil {
+		return err
+	}
+	attempts := []*LoginAttempts{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return err
+	}
+	var wait time.Duration
+	for _, a := range attempts {
+		if until := time.Until(a.LockedUntil); until > wait {
+			wait = until
+		}
+	}
+	if wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Failed records a failed login and reports whether it locked email out.
+func (lt *LoginThrottle) Failed(email, ip string) (bool, error) {
+	if _, err := lt.record(LoginAttemptsIp, ip, lt.ipPolicy); err != nil {
+		return false, err
+	}
+	failures, err := lt.record(LoginAttemptsEmail, email, lt.accountPolicy)
+	if err != nil {
+		return false, err
+	}
+	return failures >= lt.accountPolicy.LockoutAfter, nil
+}
+
+func (lt *LoginThrottle) record(kind, subject string, policy LockoutPolicy) (int, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	key := kind + ":" + subject
+	now := time.Now()
+	// the TTL monitor only runs once a minute, so old failures are dropped here too
+	if _, err := lt.db.DeleteOne(ctx, bson.M{"_id": key, "expire_at": bson.M{"$lte": now}}); err != nil {
+		return 0, err
+	}
+	_, err := lt.db.UpdateOne(ctx, bson.M{"_id": key}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"kind": kind, "subject": subject, "last_failure_at": now},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return 0, err
+	}
+	var attempts LoginAttempts
+	if err := lt.db.FindOne(ctx, bson.M{"_id": key}).Decode(&attempts); err != nil {
+		return 0, err
+	}
+	lockedUntil := now.Add(policy.delay(attempts.Failures))
+	_, err = lt.db.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"locked_until": lockedUntil,
+		"expire_at":    lockedUntil.Add(policy.ResetAfter),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return attempts.Failures, nil
+}
+
+// Reset forgets the failed logins for email, after a successful login or when
+// the account is unlocked.
+func (lt *LoginThrottle) Reset(email string) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := lt.db.DeleteOne(ctx, bson.M{"_id": LoginAttemptsEmail + ":" + email})
+	return err
+}
+
+// GetLockedAccounts lists the emails that are currently locked out, most
+// recently locked first.
+func (lt *LoginThrottle) GetLockedAccounts() ([]*LoginAttempts, error) {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	cursor, err := lt.db.Find(ctx, bson.M{
+		"kind":         LoginAttemptsEmail,
+		"failures":     bson.M{"$gte": lt.accountPolicy.LockoutAfter},
+		"locked_until": bson.M{"$gt": time.Now()},
+	}, options.Find().SetSort(bson.D{primitive.E{Key: "locked_until", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	attempts := []*LoginAttempts{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+type ILoginThrottle interface {
+	Check(email, ip string) error
+	Failed(email, ip string) (bool, error)
+	Reset(email string) error
+	GetLockedAccounts() ([]*LoginAttempts, error)
+}
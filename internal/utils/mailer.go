@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailMessage is a rendered email ready to be handed to a Mailer.
+type EmailMessage struct {
+	FromName  string
+	FromEmail string
+	ToName    string
+	ToEmail   string
+	Subject   string
+	Text      string
+	HTML      string
+}
+
+// Mailer delivers rendered emails. EmailManager renders the templates and
+// leaves delivery to one of the implementations below.
+type Mailer interface {
+	Send(message *EmailMessage) error
+}
+
+// Bytes encodes the message as a multipart/alternative MIME document.
+func (m *EmailMessage) Bytes() ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	from := mail.Address{Name: m.FromName, Address: m.FromEmail}
+	to := mail.Address{Name: m.ToName, Address: m.ToEmail}
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", primitive.NewObjectID().Hex(), domainOf(m.FromEmail))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func domainOf(email string) string {
+	for i := len(email) - 1; i >= 0; i-- {
+		if email[i] == '@' {
+			return email[i+1:]
+		}
+	}
+	return "localhost"
+}
+
+// SendGridMailer sends through the SendGrid API.
+type SendGridMailer struct {
+	client *sendgrid.Client
+}
+
+func NewSendGridMailer(apiKey string) *SendGridMailer {
+	return &SendGridMailer{client: sendgrid.NewSendClient(apiKey)}
+}
+
+func (sm *SendGridMailer) Send(message *EmailMessage) error {
+	from := sgmail.NewEmail(message.FromName, message.FromEmail)
+	to := sgmail.NewEmail(message.ToName, message.ToEmail)
+	res, err := sm.client.Send(sgmail.NewSingleEmail(from, message.Subject, to, message.Text, message.HTML))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		return errors.New("sendgrid: unexpected status " + strconv.Itoa(res.StatusCode) + ": " + res.Body)
+	}
+	return nil
+}
+
+// SMTPMailer sends through a plain SMTP server, upgrading to TLS with STARTTLS
+// when the server offers it. Authentication is skipped when username is empty.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port int, username, password string) *SMTPMailer {
+	sm := &SMTPMailer{addr: net.JoinHostPort(host, strconv.Itoa(port))}
+	if username != "" {
+		sm.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sm
+}
+
+func (sm *SMTPMailer) Send(message *EmailMessage) error {
+	msg, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(sm.addr, sm.auth, message.FromEmail, []string{message.ToEmail}, msg)
+}
+
+// FileMailer writes every email as an .eml file into a maildir style outbox
+// (dir/tmp, dir/new), so messages can be opened with a mail client or read by
+// tests.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (fm *FileMailer) Send(message *EmailMessage) error {
+	msg, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + primitive.NewObjectID().Hex() + ".eml"
+	tmp := filepath.Join(fm.dir, "tmp", name)
+	if err := os.WriteFile(tmp, msg, 0o644); err != nil {
+		return err
+	}
+	// a rename into new/ is atomic, so readers never see half written files
+	return os.Rename(tmp, filepath.Join(fm.dir, "new", name))
+}
+
+// LogMailer only logs emails. It never fails, which makes it handy for local
+// development where the verification links can be copied from the log.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (lm *LogMailer) Send(message *EmailMessage) error {
+	log.Printf("email to %s <%s>: %s\n%s\n", message.ToName, message.ToEmail, message.Subject, message.Text)
+	return nil
+}
+
+// NewMailer picks a transport by name: "sendgrid" (the default), "smtp",
+// "file" or "log".
+func NewMailer(transport string, config MailerConfig) (Mailer, error) {
+	switch transport {
+	case "", "sendgrid":
+		if config.SendGridApiKey == "" {
+			return nil, errors.New("sendgrid transport needs EMAIL_API_KEY")
+		}
+		return NewSendGridMailer(config.SendGridApiKey), nil
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, errors.New("smtp transport needs SMTP_HOST")
+		}
+		port := config.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		return NewSMTPMailer(config.SMTPHost, port, config.SMTPUsername, config.SMTPPassword), nil
+	case "file":
+		dir := config.OutboxDir
+		if dir == "" {
+			dir = "outbox"
+		}
+		return NewFileMailer(dir)
+	case "log":
+		return NewLogMailer(), nil
+	}
+	return nil, errors.New("unknown email transport " + transport)
+}
+
+type MailerConfig struct {
+	SendGridApiKey string
+	SMTPHost       string
+	SMTPPort       int
+	SMTPUsername   string
+	SMTPPassword   string
+	OutboxDir      string
+}
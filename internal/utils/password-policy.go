@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the most bcrypt hashes; longer passwords are rejected
+// rather than silently truncated.
+const maxPasswordBytes = 72
+
+// PasswordViolation is one rule a password failed.
+type PasswordViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError is returned when a new password does not meet the
+// policy. Violations lists every rule it failed.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := []string{}
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, ", ")
+}
+
+// PasswordPolicy decides which new passwords are accepted. Breached is
+// optional; without it passwords are not checked against known breaches.
+type PasswordPolicy struct {
+	MinLength           int
+	MinCharacterClasses int
+	RejectPersonalInfo  bool
+	Breached            *BreachedPasswords
+}
+
+// Check returns a *PasswordPolicyError if password breaks the policy. personal
+// holds the email and names of the account, which the password may not
+// contain.
+func (pp *PasswordPolicy) Check(password string, personal ...string) error {
+	violations := []PasswordViolation{}
+	violate := func(rule, message string) {
+		violations = append(violations, PasswordViolation{Field: "password", Rule: rule, Message: message})
+	}
+	if utf8.RuneCountInString(password) < pp.MinLength {
+		violate("min_length", "must be at least "+strconv.Itoa(pp.MinLength)+" characters")
+	}
+	if len(password) > maxPasswordBytes {
+		violate("max_length", "must be at most "+strconv.Itoa(maxPasswordBytes)+" bytes")
+	}
+	if characterClasses(password) < pp.MinCharacterClasses {
+		violate("character_classes", "must contain at least "+strconv.Itoa(pp.MinCharacterClasses)+" of lowercase letters, uppercase letters, digits and symbols")
+	}
+	if pp.RejectPersonalInfo && containsPersonalInfo(password, personal) {
+		violate("personal_info", "must not contain your name or email")
+	}
+	if pp.Breached != nil {
+		breached, err := pp.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violate("breached", "has appeared in a data breach, choose a different one")
+		}
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsPersonalInfo reports whether password contains any of personal or,
+// for emails, the parts of the local part, ignoring case. Parts shorter than
+// three characters are too common to reject.
+func containsPersonalInfo(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, info := range personal {
+		info = strings.ToLower(strings.TrimSpace(info))
+		parts := []string{info}
+		if local, _, ok := strings.Cut(info, "@"); ok {
+			parts = append([]string{local}, strings.FieldsFunc(local, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})...)
+		}
+		for _, part := range parts {
+			if utf8.RuneCountInString(part) >= 3 && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BreachedPasswords checks passwords against a local copy of a breached
+// password corpus in the k-anonymity range format: dir holds one file per
+// 5 character SHA-1 prefix, named <PREFIX>.txt, whose lines are the remaining
+// 35 characters of the hash and a count, as in SUFFIX:COUNT. Only the file of
+// the password's prefix is read, so the corpus never has to fit in memory.
+type BreachedPasswords struct {
+	dir string
+}
+
+func NewBreachedPasswords(dir string) (*BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	return &BreachedPasswords{dir: dir}, nil
+}
+
+// Contains reports whether password is in the corpus. A missing prefix file
+// means no breached password has that prefix.
+func (bp *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+	file, err := os.Open(filepath.Join(bp.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+type IPasswordPolicy interface {
+	Check(password string, personal ...string) error
+}
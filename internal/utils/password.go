@@ -1,14 +1,36 @@
 package utils
 
 import (
+	"errors"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// passwordCost is the bcrypt cost new hashes are created with.
+var passwordCost = 12
+
+// SetPasswordCost changes the bcrypt cost of new hashes. Existing hashes keep
+// working and are upgraded when their owner next logs in.
+func SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return errors.New("bcrypt cost must be between 4 and 31")
+	}
+	passwordCost = cost
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	return string(bytes), err
 }
 
 func CheckPasswordHash(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
+
+// PasswordNeedsRehash reports whether hash was created with a lower cost than
+// new hashes are.
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < passwordCost
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ayo-ajayi/edutech/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitError is returned when an action was attempted too often.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "too many requests, try again in " + strconv.Itoa(int(e.RetryAfter.Round(time.Second).Seconds())) + " seconds"
+}
+
+type RateLimit struct {
+	Key         string    `bson:"_id"`
+	Count       int       `bson:"count"`
+	WindowEndAt time.Time `bson:"window_end_at"`
+}
+
+// RateLimiter counts events per key in fixed windows stored in the database,
+// so limits hold across restarts and instances.
+type RateLimiter struct {
+	db db.IDatabase
+}
+
+func NewRateLimiter(db db.IDatabase) *RateLimiter {
+	return &RateLimiter{db: db}
+}
+
+// Allow records an event for key and returns a *RateLimitError if more than
+// limit events happened in the current window.
+func (rl *RateLimiter) Allow(key string, limit int, window time.Duration) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	now := time.Now()
+	res, err := rl.db.UpdateOne(ctx, bson.M{"_id": key, "window_end_at": bson.M{"$gt": now}}, bson.M{"$inc": bson.M{"count": 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		_, err := rl.db.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"count": 1, "window_end_at": now.Add(window)}}, options.Update().SetUpsert(true))
+		return err
+	}
+	var rateLimit RateLimit
+	if err := rl.db.FindOne(ctx, bson.M{"_id": key}).Decode(&rateLimit); err != nil {
+		return err
+	}
+	if rateLimit.Count > limit {
+		return &RateLimitError{RetryAfter: rateLimit.WindowEndAt.Sub(now)}
+	}
+	return nil
+}
+
+// Reset forgets the events recorded for key.
+func (rl *RateLimiter) Reset(key string) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := rl.db.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+type IRateLimiter interface {
+	Allow(key string, limit int, window time.Duration) error
+	Reset(key string) error
+}
@@ -1,5 +1,15 @@
 package utils
 
+import (
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
 type SignUpReq struct {
 	Email     string `json:"email" binding:"required"`
 	Password  string `json:"password" binding:"required"`
@@ -7,7 +17,115 @@ type SignUpReq struct {
 	LastName  string `json:"last_name" binding:"required"`
 }
 
+// UpdateStudentProfileReq changes the profile fields that are present. An
+// empty value clears a field. Languages are BCP 47 tags such as "en" or "yo".
+type UpdateStudentProfileReq struct {
+	Bio        *string   `json:"bio" binding:"omitempty,max=1000"`
+	Timezone   *string   `json:"timezone" binding:"omitempty,len=0|timezone"`
+	Languages  *[]string `json:"languages" binding:"omitempty,max=10,dive,bcp47_language_tag"`
+	GradeLevel *string   `json:"grade_level" binding:"omitempty,len=0|oneof=primary junior_secondary senior_secondary undergraduate postgraduate adult"`
+}
+
+// UpdateTutorProfileReq is UpdateStudentProfileReq for tutors, who list
+// qualifications instead of a grade level.
+type UpdateTutorProfileReq struct {
+	Bio            *string   `json:"bio" binding:"omitempty,max=1000"`
+	Timezone       *string   `json:"timezone" binding:"omitempty,len=0|timezone"`
+	Languages      *[]string `json:"languages" binding:"omitempty,max=10,dive,bcp47_language_tag"`
+	Qualifications *[]string `json:"qualifications" binding:"omitempty,max=10,dive,min=1,max=200"`
+}
+
+var (
+	ErrUploadMissing  = errors.New("file is required")
+	ErrUploadTooLarge = errors.New("file is too large")
+)
+
+// ReadUpload reads the file uploaded in field of a multipart form, refusing
+// bodies larger than maxBytes before they are read.
+func ReadUpload(w http.ResponseWriter, r *http.Request, field string, maxBytes int64) ([]byte, error) {
+	// room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+4096)
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, ErrUploadTooLarge
+		}
+		return nil, ErrUploadMissing
+	}
+	defer file.Close()
+	if header.Size > maxBytes {
+		return nil, ErrUploadTooLarge
+	}
+	return io.ReadAll(file)
+}
+
 type LoginReq struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+// TwoFactorCodeReq carries either a code from the authenticator app or one of
+// the recovery codes.
+type TwoFactorCodeReq struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// ClientInfo describes the device a session was started from.
+type ClientInfo struct {
+	UserAgent string
+	Ip        string
+}
+
+type ListReq struct {
+	Search string `form:"search"`
+	Page   int64  `form:"page"`
+	Limit  int64  `form:"limit"`
+}
+
+const maxPageLimit = 100
+
+// FindOptions turns the page/limit query into skip/limit options, newest users first.
+func (lr *ListReq) FindOptions() *options.FindOptions {
+	return lr.Paginate(bson.D{{Key: "user.created_at", Value: -1}})
+}
+
+func (lr *ListReq) Paginate(sort bson.D) *options.FindOptions {
+	if lr.Limit <= 0 || lr.Limit > maxPageLimit {
+		lr.Limit = 20
+	}
+	if lr.Page <= 0 {
+		lr.Page = 1
+	}
+	return options.Find().
+		SetSort(sort).
+		SetSkip((lr.Page - 1) * lr.Limit).
+		SetLimit(lr.Limit)
+}
+
+// UserSearchFilter matches users whose email or names contain search.
+func UserSearchFilter(search string) bson.M {
+	if search == "" {
+		return bson.M{}
+	}
+	pattern := bson.M{"$regex": regexp.QuoteMeta(search), "$options": "i"}
+	return bson.M{"$or": bson.A{
+		bson.M{"user.email": pattern},
+		bson.M{"user.firstname": pattern},
+		bson.M{"user.lastname": pattern},
+	}}
+}
+
+type TutorDirectoryReq struct {
+	Subject   string  `form:"subject"`
+	Search    string  `form:"search"`
+	MinRating float64 `form:"min_rating" binding:"min=0,max=5"`
+	Sort      string  `form:"sort" binding:"omitempty,oneof=rating name newest"`
+	Order     string  `form:"order" binding:"omitempty,oneof=asc desc"`
+	Cursor    string  `form:"cursor"`
+	Limit     int64   `form:"limit"`
+	// Approval is only accepted from admins; students only ever see
+	// approved tutors.
+	Approval string `form:"approval" binding:"omitempty,oneof=approved pending rejected all"`
+}
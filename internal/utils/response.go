@@ -35,5 +35,38 @@ type StudentRegisteredTutorRes struct {
 	FirstName    string             `json:"first_name"`
 	LastName     string             `json:"last_name"`
 	SubjectId    primitive.ObjectID `json:"subject_id"`
+	Rating       float64            `json:"rating"`
+	RatingCount  int                `json:"rating_count"`
+	Profile      PublicTutorProfile `json:"profile"`
 	RegisteredAt time.Time          `json:"registered_at"`
 }
+
+type SessionRes struct {
+	Id        primitive.ObjectID `json:"id"`
+	UserAgent string             `json:"user_agent"`
+	Ip        string             `json:"ip"`
+	Current   bool               `json:"current"`
+	CreatedAt time.Time          `json:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at"`
+}
+
+type TutorDirectoryRes struct {
+	TutorId     primitive.ObjectID `json:"tutor_id"`
+	FirstName   string             `json:"first_name"`
+	LastName    string             `json:"last_name"`
+	SubjectId   primitive.ObjectID `json:"subject_id"`
+	Rating      float64            `json:"rating"`
+	RatingCount int                `json:"rating_count"`
+	Profile     PublicTutorProfile `json:"profile"`
+	JoinedAt    time.Time          `json:"joined_at"`
+	// Approval is the application status, only shown to admins.
+	Approval string `json:"approval,omitempty"`
+}
+
+// PublicTutorProfile is the part of a tutor's profile students can see.
+type PublicTutorProfile struct {
+	Bio            string   `json:"bio,omitempty"`
+	AvatarUrl      string   `json:"avatar_url,omitempty"`
+	Languages      []string `json:"languages,omitempty"`
+	Qualifications []string `json:"qualifications,omitempty"`
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/url"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func ConstructVerificationLink(baseUrl, path, verificationToken string, email string) (string, error) {
@@ -18,6 +20,19 @@ func ConstructVerificationLink(baseUrl, path, verificationToken string, email st
 	return u.String(), nil
 }
 
-func CreateVerificationToken() string {
-	return primitive.NewObjectID().Hex()
+// CreateSecretToken returns a random, URL safe token for secrets such as the
+// tokens of emailed links and calendar feed links.
+func CreateSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSecretToken returns the SHA-256 of a token created by CreateSecretToken.
+// Unlike HashPassword the result is deterministic, so it can be looked up.
+func HashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
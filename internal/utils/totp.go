@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTP codes follow RFC 6238 with the defaults every authenticator app
+// supports: SHA-1, 6 digits and a 30 second period.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods a code may be early or late, to allow
+	// for clock drift on the phone.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// CreateTOTPSecret returns a random 160-bit secret, base32 encoded as
+// authenticator apps expect it.
+func CreateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps read from a QR
+// code to add account.
+func TOTPURI(issuer, account, secret string) string {
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + issuer + ":" + account,
+	}
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(totpPeriod))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// ValidateTOTP checks code against secret at now and returns the time step it
+// matched, so callers can refuse a code that was already used.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// CreateRecoveryCodes returns n single-use recovery codes such as
+// "k3jd9-x7qpa" and their hashes, which are what should be stored.
+func CreateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := []string{}
+	hashes := []string{}
+	for i := 0; i < n; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a recovery code the way CreateRecoveryCodes does,
+// ignoring case, spaces and dashes in what the user typed. Recovery codes are
+// random, so a fast hash is enough.
+func HashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return HashSecretToken(code)
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// The RFC lists 8 digit codes; 6 digit codes are their last 6 digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, now)
+		if !ok {
+			t.Errorf("T=%d: %s was rejected", v.unix, v.code)
+			continue
+		}
+		if step != v.unix/totpPeriod {
+			t.Errorf("T=%d: matched step %d, want %d", v.unix, step, v.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"two steps early", -2, false},
+		{"one step early", -1, true},
+		{"current step", 0, true},
+		{"one step late", 1, true},
+		{"two steps late", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current+tt.offset), now)
+			if ok != tt.ok {
+				t.Fatalf("got %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("matched step %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejects(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfc6238Secret, "287083"},
+		{"too short", rfc6238Secret, "28708"},
+		{"too long", rfc6238Secret, "94287082"},
+		{"empty", rfc6238Secret, ""},
+		{"invalid secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok {
+				t.Error("code was accepted")
+			}
+		})
+	}
+}
+
+func TestValidateTOTPNormalizesInput(t *testing.T) {
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 287082 ", time.Unix(59, 0)); !ok {
+		t.Error("a lowercase secret and a padded code should be accepted")
+	}
+}
+
+func TestCreateTOTPSecret(t *testing.T) {
+	secret, err := CreateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("got a %d byte key, %v; want 20 bytes", len(key), err)
+	}
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now); !ok {
+		t.Error("the current code of a new secret was rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(TOTPURI("Edutech", "ada@x.io", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Edutech:ada@x.io" {
+		t.Errorf("got %s", u)
+	}
+	q := u.Query()
+	for key, want := range map[string]string{"secret": rfc6238Secret, "issuer": "Edutech", "algorithm": "SHA1", "digits": "6", "period": "30"} {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := CreateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes and %d hashes, want 10", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("%q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("%q was handed out twice", code)
+		}
+		seen[code] = true
+		if hashes[i] == code {
+			t.Error("the hash is the code")
+		}
+		for _, typed := range []string{code, strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), code[:5] + " " + code[6:]} {
+			if HashRecoveryCode(typed) != hashes[i] {
+				t.Errorf("%q does not hash like %q", typed, code)
+			}
+		}
+	}
+}
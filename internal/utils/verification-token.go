@@ -11,43 +11,70 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// TokenPurpose scopes a verification token to the flow it was issued for, so
+// a password reset token cannot verify an account and the other way round.
+type TokenPurpose string
+
+const (
+	PurposeSignup        TokenPurpose = "signup"
+	PurposePasswordReset TokenPurpose = "password_reset"
+	PurposeEmailChange   TokenPurpose = "email_change"
+	PurposeInvite        TokenPurpose = "invite"
+	// PurposePasswordResetGrant is issued in exchange for an opened password
+	// reset link and is what the reset form submits.
+	PurposePasswordResetGrant TokenPurpose = "password_reset_grant"
+	// PurposeLoginChallenge is issued by a password login that still needs
+	// the second factor.
+	PurposeLoginChallenge TokenPurpose = "login_challenge"
+	PurposeAccountUnlock  TokenPurpose = "account_unlock"
+	PurposeMagicLink      TokenPurpose = "magic_link"
+)
+
 type VerificationToken struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Email     string             `json:"email" bson:"email"`
+	Purpose   TokenPurpose       `json:"purpose" bson:"purpose"`
 	Token     string             `json:"token" bson:"token"`
 	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 }
 
 type VerificationTokenManager struct {
-	db                                db.IDatabase
-	SignUpTokenValidityInSecs         uint
-	ForgotPasswordTokenValidityInSecs uint
+	db                  db.IDatabase
+	TokenValidityInSecs map[TokenPurpose]uint
 }
 
 type IVerificationTokenManager interface {
-	SaveVerificationToken(email string, verificationToken string) error
-	ValidateVerificationToken(email string, verificationToken string) (bool, error)
+	SaveVerificationToken(email string, purpose TokenPurpose, verificationToken string) error
+	ValidateVerificationToken(email string, purpose TokenPurpose, verificationToken string) (bool, error)
+	ConsumeVerificationToken(email string, purpose TokenPurpose, verificationToken string) (bool, error)
+	InvalidateVerificationTokens(email string, purpose TokenPurpose) error
 }
 
-func NewVerificationTokenManager(db db.IDatabase, signUpTokenValidityInSecs uint, forgotPasswordTokenValidityInSecs uint) *VerificationTokenManager {
-	return &VerificationTokenManager{db: db, SignUpTokenValidityInSecs: signUpTokenValidityInSecs, ForgotPasswordTokenValidityInSecs: forgotPasswordTokenValidityInSecs}
+func NewVerificationTokenManager(db db.IDatabase, tokenValidityInSecs map[TokenPurpose]uint) *VerificationTokenManager {
+	return &VerificationTokenManager{db: db, TokenValidityInSecs: tokenValidityInSecs}
 }
 
-func InitVerificationTokenExpiryIndex(collection *mongo.Collection) error {
+// InitVerificationTokenExpiryIndex lets the database delete tokens once they
+// expire.
+func InitVerificationTokenExpiryIndex(database db.IDatabase) error {
 	indexModel := mongo.IndexModel{
 		Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0),
 	}
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
-	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	_, err := database.CreateIndex(ctx, indexModel)
 	if err != nil {
 		return errors.New("Error creating TTL index for token collection:" + err.Error())
 	}
 	return nil
 }
 
-func (vtm *VerificationTokenManager) SaveVerificationToken(email string, verificationToken string) error {
+func (vtm *VerificationTokenManager) SaveVerificationToken(email string, purpose TokenPurpose, verificationToken string) error {
+	validity, ok := vtm.TokenValidityInSecs[purpose]
+	if !ok {
+		return errors.New("unknown token purpose " + string(purpose))
+	}
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
 	hashToken, err := HashPassword(verificationToken)
@@ -56,8 +83,9 @@ func (vtm *VerificationTokenManager) SaveVerificationToken(email string, verific
 	}
 	token := VerificationToken{
 		Email:     email,
+		Purpose:   purpose,
 		Token:     hashToken,
-		ExpiresAt: time.Now().Add(time.Duration(vtm.SignUpTokenValidityInSecs) * time.Second),
+		ExpiresAt: time.Now().Add(time.Duration(validity) * time.Second),
 		CreatedAt: time.Now(),
 	}
 	if _, err := vtm.db.InsertOne(ctx, token); err != nil {
@@ -65,24 +93,61 @@ func (vtm *VerificationTokenManager) SaveVerificationToken(email string, verific
 	}
 	return nil
 }
-func (vtm *VerificationTokenManager) ValidateVerificationToken(email string, verificationToken string) (bool, error) {
+
+// findVerificationToken returns the unexpired token of email and purpose that
+// matches verificationToken, or nil.
+func (vtm *VerificationTokenManager) findVerificationToken(email string, purpose TokenPurpose, verificationToken string) (*VerificationToken, error) {
 	ctx, cancel := db.DBReqContext(5)
 	defer cancel()
-	var token VerificationToken
-	findOptions := options.FindOne().SetSort(bson.D{
+	// the TTL monitor only runs once a minute, so expiry is checked here too
+	cursor, err := vtm.db.Find(ctx, bson.M{"email": email, "purpose": purpose, "expires_at": bson.M{"$gt": time.Now()}}, options.Find().SetSort(bson.D{
 		primitive.E{Key: "created_at", Value: -1},
-	})
-	err := vtm.db.FindOne(ctx, bson.M{"email": email}, findOptions).Decode(&token)
+	}))
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return false, nil
+		return nil, err
+	}
+	tokens := []*VerificationToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if CheckPasswordHash(verificationToken, token.Token) {
+			return token, nil
 		}
+	}
+	return nil, nil
+}
+
+// ValidateVerificationToken checks a token without using it up.
+func (vtm *VerificationTokenManager) ValidateVerificationToken(email string, purpose TokenPurpose, verificationToken string) (bool, error) {
+	token, err := vtm.findVerificationToken(email, purpose, verificationToken)
+	if err != nil {
 		return false, err
 	}
+	return token != nil, nil
+}
 
-	valid := CheckPasswordHash(verificationToken, token.Token)
-	if !valid {
-		return false, nil
+// ConsumeVerificationToken checks a token and deletes it. Only one of several
+// concurrent calls with the same token succeeds.
+func (vtm *VerificationTokenManager) ConsumeVerificationToken(email string, purpose TokenPurpose, verificationToken string) (bool, error) {
+	token, err := vtm.findVerificationToken(email, purpose, verificationToken)
+	if err != nil || token == nil {
+		return false, err
 	}
-	return true, nil
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	res, err := vtm.db.DeleteOne(ctx, bson.M{"_id": token.ID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount == 1, nil
+}
+
+// InvalidateVerificationTokens deletes every outstanding token of email for
+// the given purpose.
+func (vtm *VerificationTokenManager) InvalidateVerificationTokens(email string, purpose TokenPurpose) error {
+	ctx, cancel := db.DBReqContext(5)
+	defer cancel()
+	_, err := vtm.db.DeleteMany(ctx, bson.M{"email": email, "purpose": purpose})
+	return err
 }
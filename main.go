@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
 	"github.com/ayo-ajayi/edutech/internal/app"
 	"github.com/joho/godotenv"
@@ -11,5 +13,27 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file ", err.Error())
 	}
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		bootstrapAdmin(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-users" {
+		if err := app.MigrateUsers(); err != nil {
+			log.Fatal("Error migrating users ", err.Error())
+		}
+		return
+	}
 	app.NewApp(":8000", app.Router()).Start()
 }
+
+func bootstrapAdmin(args []string) {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ExitOnError)
+	email := fs.String("email", os.Getenv("ADMIN_EMAIL"), "admin email address")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "admin password")
+	firstname := fs.String("firstname", "Admin", "admin first name")
+	lastname := fs.String("lastname", "", "admin last name")
+	fs.Parse(args)
+	if err := app.BootstrapAdmin(*email, *password, *firstname, *lastname); err != nil {
+		log.Fatal("Error creating admin account ", err.Error())
+	}
+}